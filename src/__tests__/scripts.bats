@@ -82,3 +82,69 @@ setup() {
     [[ "$output" == *"::error::Template file not found"* ]]
     unset INPUT_TEMPLATE
 }
+
+mock_fetch_tools() {
+    export RUNNER_TEMP="$(mktemp -d)"
+    function uname() {
+        if [[ "$1" == "-m" ]]; then echo "x86_64"; else echo "Linux"; fi
+    }
+    function go() {
+        # go build ... -o <path> ./src
+        while [[ $# -gt 0 ]]; do
+            if [[ "$1" == "-o" ]]; then echo "built" > "$2"; fi
+            shift
+        done
+    }
+    function curl() {
+        local dest url
+        while [[ $# -gt 0 ]]; do
+            case "$1" in
+                -o) dest="$2"; shift ;;
+                http*) url="$1" ;;
+            esac
+            shift
+        done
+        [[ -n "${CURL_FAIL:-}" ]] && return 22
+        if [[ "$url" == *checksums.txt ]]; then
+            (cd "$RUNNER_TEMP/agentic-audits-bin" && sha256sum agentic-audits_linux_amd64 > "$dest")
+            [[ -n "${BAD_CHECKSUM:-}" ]] && echo "0000000000000000000000000000000000000000000000000000000000000000  agentic-audits_linux_amd64" > "$dest"
+        else
+            echo "prebuilt" > "$dest"
+        fi
+        return 0
+    }
+    export -f uname go curl
+}
+
+@test "fetch-binary.sh: builds from source for non-release refs" {
+    mock_fetch_tools
+    run bash "$SRC_DIR/fetch-binary.sh" "$SRC_DIR/.." "main"
+    [ "$status" -eq 0 ]
+    [[ "$output" == *"$RUNNER_TEMP/agentic-audits-bin/agentic-audits" ]]
+    grep -q "built" "$RUNNER_TEMP/agentic-audits-bin/agentic-audits"
+}
+
+@test "fetch-binary.sh: uses verified prebuilt binary for release tags" {
+    mock_fetch_tools
+    run bash "$SRC_DIR/fetch-binary.sh" "$SRC_DIR/.." "v1.2.3"
+    [ "$status" -eq 0 ]
+    grep -q "prebuilt" "$RUNNER_TEMP/agentic-audits-bin/agentic-audits"
+}
+
+@test "fetch-binary.sh: falls back to source when the release has no asset" {
+    mock_fetch_tools
+    export CURL_FAIL=1
+    run bash "$SRC_DIR/fetch-binary.sh" "$SRC_DIR/.." "v1.2.3"
+    [ "$status" -eq 0 ]
+    grep -q "built" "$RUNNER_TEMP/agentic-audits-bin/agentic-audits"
+    unset CURL_FAIL
+}
+
+@test "fetch-binary.sh: fails on checksum mismatch" {
+    mock_fetch_tools
+    export BAD_CHECKSUM=1
+    run bash "$SRC_DIR/fetch-binary.sh" "$SRC_DIR/.." "v1.2.3"
+    [ "$status" -eq 1 ]
+    [[ "$output" == *"::error::Checksum verification failed"* ]]
+    unset BAD_CHECKSUM
+}
@@ -1,6 +1,10 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -10,12 +14,28 @@ import (
 
 type CommandExecutor interface {
 	RunCommand(name string, args []string, env []string, stdout, stderr io.Writer) error
+	// RunCommandContext is RunCommand, killing the command once ctx is done.
+	RunCommandContext(ctx context.Context, name string, args []string, env []string, stdout, stderr io.Writer) error
 }
 
-type RealCommandExecutor struct{}
+// RealCommandExecutor runs commands on the host. Commands still running when
+// Context is done are killed.
+type RealCommandExecutor struct {
+	Context context.Context
+}
 
 func (e *RealCommandExecutor) RunCommand(name string, args []string, env []string, stdout, stderr io.Writer) error {
-	cmd := exec.Command(name, args...)
+	return e.RunCommandContext(context.Background(), name, args, env, stdout, stderr)
+}
+
+func (e *RealCommandExecutor) RunCommandContext(ctx context.Context, name string, args []string, env []string, stdout, stderr io.Writer) error {
+	if e.Context != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		defer context.AfterFunc(e.Context, cancel)()
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
 	cmd.Env = env
 	cmd.Stdout = stdout
 	cmd.Stderr = stderr
@@ -29,8 +49,25 @@ type AgentOptions struct {
 	Model         string
 	FallbackModel string
 	DryRun        bool
-	GithubToken   string
-	Executor      CommandExecutor
+	CopilotToken  string
+	FindingsFile  string
+	// ReportTool is set when the agent can call report_finding on the built-in MCP server.
+	ReportTool bool
+	// PreviousOutputs are results of missions this one depends on.
+	PreviousOutputs []MissionOutput
+	Env             []string
+	Executor        CommandExecutor
+	// Timeout limits each attempt; zero means no limit.
+	Timeout time.Duration
+	// Budget is checked after each attempt, see UsageBudget.
+	Budget UsageBudget
+	// Span is the mission's trace span; each attempt gets a child span.
+	Span *Span
+}
+
+type MissionResult struct {
+	Model string
+	Usage UsageReport
 }
 
 
@@ -40,35 +77,31 @@ func constructFullPrompt(mission string, options AgentOptions, webSources string
 		fullMission = fmt.Sprintf("%s. %s", fullMission, webSources)
 	}
 
+	if len(options.PreviousOutputs) > 0 {
+		outputs, _ := json.MarshalIndent(options.PreviousOutputs, "", "  ")
+		fullMission += fmt.Sprintf(`
+
+### Output of Previous Missions
+These missions already ran in this checkout; their changes are in the working tree. Build on their results:
+`+"```json\n%s\n```"+`
+`, outputs)
+	}
+
+	if options.ReportTool {
+		fullMission += fmt.Sprintf(`
+
+### Reporting Findings
+Record every finding with the `+"`report_finding`"+` tool of the `+"`%s`"+` MCP server (title, severity, file, line, description, recommendation). The same server lists and reads the fetched web sources, the repository's templates and the outputs of earlier missions.
+`, builtinMCPName)
+	}
+
 	if !options.DryRun {
 		fullMission += fmt.Sprintf(`
 
-### MANDATORY: Pull Request Creation
-You MUST create a Pull Request for your changes using the `+"`create_pull_request`"+` tool from the GitHub MCP server. 
-
-PR Specifications:
-- **Repository**: %s
-- **Base Branch**: %s
-- **Branch Name**: %s
-- **Title**: %s
-- **Body**: %s
-- **Labels**: %s
-`, 
-			os.Getenv("GITHUB_REPOSITORY"),
-			getEnvOrDefault("PR_BASE", "main"),
-			getEnvOrDefault("PR_BRANCH", fmt.Sprintf("agent/audit-%d", time.Now().Unix())),
-			getEnvOrDefault("PR_TITLE", "Use STRICT Conventional Commits format (e.g., refactor(skills): [AI-GENERATED] audit and clarify instructions)."),
-			getEnvOrDefault("PR_BODY", `You MUST provide a comprehensive, elite-quality description structured as follows:
-### 🔎 Audit Overview
-Provide a high-level technical summary of what was audited and the general state of the skills.
-
-### 🛠 Detailed Changes
-Provide a per-skill breakdown of specific technical improvements (e.g., Skill X: Removed 40% verbosity, updated paths to match current source tree).
-
-### ⚠️ Manual Review Required
-List any specific files where you added <!-- ISSUE --> comments because they require human intervention.`),
-			getEnvOrDefault("PR_LABELS", "automated-pr"),
-		)
+### MANDATORY: Pull Request Preparation
+Do NOT commit, push or open a Pull Request yourself. Leave your changes in the working tree; the Pull Request is opened for you once you finish.
+When you are done, write a concise Markdown summary of your findings to `+"`%s`"+`. It is rendered into the Pull Request description.
+`, options.FindingsFile)
 	} else {
 		fullMission += `
 
@@ -79,48 +112,99 @@ NOTE: dry_run is set to TRUE. Do NOT create a Pull Request. Just verify the chan
 	return fullMission
 }
 
-func runAgent(executor CommandExecutor, prompt string, model string, token string) error {
+func runAgent(executor CommandExecutor, prompt string, model string, token string, baseEnv []string, timeout time.Duration) (AttemptUsage, error) {
 	args := []string{"copilot", "--allow-all-tools", "-p", prompt}
 	if model != "" {
 		args = append(args, "--model", model)
 	}
 
-	env := append(os.Environ(),
-		"COPILOT_GITHUB_TOKEN="+token,
-		"GITHUB_TOKEN="+token,
-	)
+	if baseEnv == nil {
+		baseEnv = os.Environ()
+	}
+	// Only the model-entitlement token reaches the agent; repository tokens stay with the tool.
+	env := overrideEnv(withoutEnv(baseEnv, repoTokenEnvVars...), map[string]string{
+		"COPILOT_GITHUB_TOKEN": token,
+	})
+
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 
-	fmt.Printf("Running agent with model: %s\n", model)
-	return executor.RunCommand("gh", args, env, os.Stdout, os.Stderr)
+	logInfo("Running agent with model: %s", model)
+	// The agent's output still streams to the log; a copy is kept to read the usage summary.
+	var output bytes.Buffer
+	err := executor.RunCommandContext(ctx, "gh", args, env, io.MultiWriter(os.Stdout, &output), io.MultiWriter(os.Stderr, &output))
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("agent timed out after %s", timeout)
+	}
+	usage, byModel := parseUsage(output.String(), model)
+	return AttemptUsage{Model: model, Succeeded: err == nil, Usage: usage, ByModel: byModel}, err
 }
 
 
-func executeMission(options AgentOptions, webSources string) error {
+func executeMission(options AgentOptions, webSources string) (MissionResult, error) {
 	fullPrompt := constructFullPrompt(options.FullMission, options, webSources)
+	var report UsageReport
+	attempt := func(model string, fallbackReason error) error {
+		span := options.Span.Child("agent.attempt")
+		span.SetAttribute("agent.attempt", len(report.Attempts)+1)
+		span.SetAttribute("agent.model", model)
+		if fallbackReason != nil {
+			span.SetAttribute("agent.fallback_reason", fallbackReason.Error())
+		}
+		usage, err := runAgent(options.Executor, fullPrompt, model, options.CopilotToken, options.Env, options.Timeout)
+		report.AddAttempt(usage)
+		span.SetAttribute("process.exit_code", exitCode(err))
+		span.SetAttribute("agent.premium_requests", usage.Usage.PremiumRequests)
+		span.SetAttribute("agent.input_tokens", usage.Usage.InputTokens)
+		span.SetAttribute("agent.output_tokens", usage.Usage.OutputTokens)
+		span.End(err)
+		return err
+	}
 
 	// Attempt with primary model
-	err := runAgent(options.Executor, fullPrompt, options.Model, options.GithubToken)
+	err := attempt(options.Model, nil)
+	if budgetErr := options.Budget.Check(report.Total); budgetErr != nil {
+		return MissionResult{Usage: report}, budgetErr
+	}
 	if err == nil {
-		fmt.Println("Agent mission completed successfully.")
-		return nil
+		logInfo("Agent mission completed successfully.")
+		return MissionResult{Model: options.Model, Usage: report}, nil
 	}
 
-	fmt.Printf("::warning::Primary model failed: %v\n", err)
+	logWarn("Primary model failed: %v", err)
 
 	if options.FallbackModel != "" {
-		fmt.Printf("Retrying with fallback model: %s\n", options.FallbackModel)
-		err = runAgent(options.Executor, fullPrompt, options.FallbackModel, options.GithubToken)
+		logInfo("Retrying with fallback model: %s", options.FallbackModel)
+		err = attempt(options.FallbackModel, err)
+		if budgetErr := options.Budget.Check(report.Total); budgetErr != nil {
+			return MissionResult{Usage: report}, budgetErr
+		}
 		if err == nil {
-			fmt.Println("Agent mission completed with fallback model.")
-			return nil
+			logInfo("Agent mission completed with fallback model.")
+			return MissionResult{Model: options.FallbackModel, Usage: report}, nil
 		}
-		return fmt.Errorf("agent mission failed with both primary and fallback models: %w", err)
+		return MissionResult{Usage: report}, fmt.Errorf("agent mission failed with both primary and fallback models: %w", err)
 	}
 
-	return fmt.Errorf("agent mission failed and no fallback model is configured: %w", err)
+	return MissionResult{Usage: report}, fmt.Errorf("agent mission failed and no fallback model is configured: %w", err)
 }
 
 
+// exitCode is the agent's exit status, or -1 when it did not exit normally.
+func exitCode(err error) int {
+	var exitErr *exec.ExitError
+	if err == nil {
+		return 0
+	} else if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
 func getEnvOrDefault(name, defaultValue string) string {
 	if val := os.Getenv(name); val != "" {
 		return val
@@ -2,22 +2,25 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"flag"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata/prompts")
 
 func TestConstructFullPrompt(t *testing.T) {
-	os.Setenv("GITHUB_REPOSITORY", "test/repo")
-	defer os.Unsetenv("GITHUB_REPOSITORY")
-
 	mission := "test mission"
 	opts := AgentOptions{
 		ContextFiles: ".",
 		DryRun:       false,
+		FindingsFile: "/tmp/findings.md",
 	}
 	webSources := "web info"
 
@@ -29,14 +32,17 @@ func TestConstructFullPrompt(t *testing.T) {
 	if !strings.Contains(prompt, "web info") {
 		t.Error("prompt should contain web sources")
 	}
-	if !strings.Contains(prompt, "MANDATORY: Pull Request Creation") {
+	if !strings.Contains(prompt, "MANDATORY: Pull Request Preparation") {
 		t.Error("prompt should contain PR instructions when not dry-run")
 	}
+	if !strings.Contains(prompt, "/tmp/findings.md") {
+		t.Error("prompt should point the agent at the findings file")
+	}
 
 	// Test dry-run
 	opts.DryRun = true
 	prompt = constructFullPrompt(mission, opts, webSources)
-	if strings.Contains(prompt, "MANDATORY: Pull Request Creation") {
+	if strings.Contains(prompt, "MANDATORY: Pull Request Preparation") {
 		t.Error("prompt should NOT contain PR instructions when dry-run")
 	}
 	if !strings.Contains(prompt, "dry_run is set to TRUE") {
@@ -44,6 +50,127 @@ func TestConstructFullPrompt(t *testing.T) {
 	}
 }
 
+// TestPromptGolden pins the prompt and pull request every combination of
+// dry-run, PR overrides, web sources and mission templates produces. Run
+// `go test -run TestPromptGolden -update` after an intended change and review
+// the diff of testdata/prompts.
+func TestPromptGolden(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	lookup := envLookup(map[string]string{
+		"GITHUB_SERVER_URL": "https://github.com",
+		"GITHUB_REPOSITORY": "acme/widgets",
+		"GITHUB_RUN_ID":     "42",
+	})
+	ci := githubActions{lookup}
+	template, err := os.ReadFile(filepath.Join("testdata", "templates", "skills-audit.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dryRun := range []bool{false, true} {
+		for _, prEnv := range []bool{false, true} {
+			for _, web := range []bool{false, true} {
+				for _, useTemplate := range []bool{false, true} {
+					name := "mission"
+					env := map[string]string{
+						"INPUT_DRY_RUN":           fmt.Sprint(dryRun),
+						"INPUT_CONTEXT_FILES":     ".github/skills",
+						"INPUT_PR_TITLE_TEMPLATE": "testdata/missing-title.md",
+						"INPUT_PR_BODY_TEMPLATE":  "testdata/missing-body.md",
+					}
+					mission := "Audit the skills for stale paths."
+					if useTemplate {
+						name = "template"
+						env["INPUT_TEMPLATE"] = "skills-audit"
+						mission = string(template)
+					} else {
+						env["INPUT_MISSION"] = mission
+					}
+					if dryRun {
+						name += "-dry-run"
+					}
+					if prEnv {
+						name += "-pr-env"
+						env["INPUT_PR_BASE"] = "develop"
+						env["INPUT_PR_BRANCH"] = "audits/skills"
+						env["INPUT_PR_TITLE"] = "docs({{.Template}}): refresh skills"
+						env["INPUT_PR_BODY"] = "Run: {{.RunURL}}\n{{range .ChangedFiles}}* {{.}}\n{{end}}"
+						env["INPUT_PR_LABELS"] = "audit, docs"
+					}
+					if web {
+						name += "-web"
+					}
+
+					t.Run(name, func(t *testing.T) {
+						checkGoldenPrompt(t, name, renderGoldenPrompt(t, envLookup(env), ci, mission, web, now))
+					})
+				}
+			}
+		}
+	}
+
+	// The repository's own PR body template, for prompt and template missions.
+	body := filepath.Join("..", ".github", "templates", "pr", "body.md")
+	t.Run("mission-repo-body", func(t *testing.T) {
+		env := envLookup(map[string]string{"INPUT_MISSION": "Audit the skills for stale paths.", "INPUT_PR_BODY_TEMPLATE": body})
+		checkGoldenPrompt(t, "mission-repo-body", renderGoldenPrompt(t, env, ci, "Audit the skills for stale paths.", false, now))
+	})
+	t.Run("template-repo-body", func(t *testing.T) {
+		env := envLookup(map[string]string{"INPUT_TEMPLATE": "skills-audit", "INPUT_PR_BODY_TEMPLATE": body})
+		checkGoldenPrompt(t, "template-repo-body", renderGoldenPrompt(t, env, ci, string(template), false, now))
+	})
+}
+
+// checkGoldenPrompt compares got with testdata/prompts/<name>.golden.
+func checkGoldenPrompt(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", "prompts", name+".golden")
+	if *updateGolden {
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create it)", err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs from the rendered prompt (run with -update if intended):\n%s", path, got)
+	}
+}
+
+// renderGoldenPrompt builds a mission's prompt and, unless it is a dry run,
+// its pull request with the same helpers runMission and handlePullRequest use.
+func renderGoldenPrompt(t *testing.T, lookupEnv func(string) (string, bool), ci CIProvider, mission string, web bool, now time.Time) string {
+	t.Helper()
+	cfg, err := loadRunConfig(nil, lookupEnv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fetched []FetchedSource
+	webSources := ""
+	if web {
+		fetched = []FetchedSource{{Name: "go-docs", URL: "https://go.dev/doc/effective_go", Path: "/run/web/mission/go-docs.md"}}
+		webSources = webSourcesPrompt(fetched, []Source{{Name: "blog", URL: "https://example.com/blog"}})
+	}
+	opts := missionAgentOptions(cfg, mission, "/run", fetched, nil)
+	prompt := constructFullPrompt(opts.FullMission, opts, webSources)
+
+	out := "=== prompt ===\n" + prompt
+	if cfg.DryRun {
+		return out
+	}
+	output := MissionOutput{Model: "gpt-5", Findings: "Two skills referenced moved files."}
+	changes := GitChanges{Files: []string{".github/skills/build.md", ".github/skills/test.md"}}
+	spec, err := newPullRequestSpec(cfg, newPRTemplateData(cfg, []string{cfg.MissionName}, output, changes, ci), ci.Repository(), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out + fmt.Sprintf("=== pull request ===\nRepository: %s\nBase: %s\nBranch: %s\nLabels: %s\nTitle: %s\n\n%s",
+		spec.Repository, spec.Base, spec.Branch, strings.Join(spec.Labels, ","), spec.Title, spec.Body)
+}
+
 func TestExecuteMission(t *testing.T) {
 	t.Run("Primary success", func(t *testing.T) {
 		executor := &MockCommandExecutor{
@@ -51,11 +178,14 @@ func TestExecuteMission(t *testing.T) {
 				return nil
 			},
 		}
-		opts := AgentOptions{Executor: executor}
-		err := executeMission(opts, "")
+		opts := AgentOptions{Executor: executor, Model: "primary"}
+		result, err := executeMission(opts, "")
 		if err != nil {
 			t.Errorf("unexpected error: %v", err)
 		}
+		if result.Model != "primary" {
+			t.Errorf("expected primary model in result, got %q", result.Model)
+		}
 	})
 
 	t.Run("Primary fails, fallback succeeds", func(t *testing.T) {
@@ -73,10 +203,13 @@ func TestExecuteMission(t *testing.T) {
 			Executor:      executor,
 			FallbackModel: "fallback",
 		}
-		err := executeMission(opts, "")
+		result, err := executeMission(opts, "")
 		if err != nil {
 			t.Errorf("unexpected error: %v", err)
 		}
+		if result.Model != "fallback" {
+			t.Errorf("expected fallback model in result, got %q", result.Model)
+		}
 		if callCount != 2 {
 			t.Errorf("expected 2 calls, got %d", callCount)
 		}
@@ -92,7 +225,7 @@ func TestExecuteMission(t *testing.T) {
 			Executor:      executor,
 			FallbackModel: "fallback",
 		}
-		err := executeMission(opts, "")
+		_, err := executeMission(opts, "")
 		if err == nil {
 			t.Error("expected error when both fail")
 		}
@@ -111,6 +244,39 @@ func TestRealCommandExecutor_RunCommand(t *testing.T) {
 	}
 }
 
+func TestRealCommandExecutorContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	executor := &RealCommandExecutor{}
+	if err := executor.RunCommandContext(ctx, "sleep", []string{"5"}, os.Environ(), io.Discard, io.Discard); err == nil {
+		t.Error("expected the command to be killed")
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Error("the command should be killed once the context is done")
+	}
+
+	interrupted, stop := context.WithCancel(context.Background())
+	stop()
+	executor = &RealCommandExecutor{Context: interrupted}
+	if err := executor.RunCommand("sleep", []string{"5"}, os.Environ(), io.Discard, io.Discard); err == nil {
+		t.Error("commands should not run once the executor's context is done")
+	}
+}
+
+func TestRunAgentTimeout(t *testing.T) {
+	executor := &MockCommandExecutor{
+		RunFunc: func(name string, args []string, env []string, stdout, stderr io.Writer) error {
+			time.Sleep(50 * time.Millisecond)
+			return fmt.Errorf("signal: killed")
+		},
+	}
+	_, err := runAgent(executor, "prompt", "", "tok", nil, 10*time.Millisecond)
+	if err == nil || err.Error() != "agent timed out after 10ms" {
+		t.Errorf("expected timeout error, got %v", err)
+	}
+}
+
 func TestGetEnvOrDefault(t *testing.T) {
 
 	os.Setenv("TEST_VAR", "value")
@@ -123,3 +289,26 @@ func TestGetEnvOrDefault(t *testing.T) {
 		t.Error("expected default value")
 	}
 }
+
+func TestRunAgentTokenRouting(t *testing.T) {
+	var env []string
+	executor := &MockCommandExecutor{
+		RunFunc: func(name string, args []string, e []string, stdout, stderr io.Writer) error {
+			env = e
+			return nil
+		},
+	}
+
+	base := []string{"PATH=/usr/bin", "GITHUB_TOKEN=repo-secret", "GH_TOKEN=repo-secret", "GITHUB_APP_PRIVATE_KEY=pem"}
+	if _, err := runAgent(executor, "prompt", "", "seat-token", base, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	joined := strings.Join(env, "\n")
+	if !strings.Contains(joined, "COPILOT_GITHUB_TOKEN=seat-token") {
+		t.Error("agent should receive the Copilot token")
+	}
+	if strings.Contains(joined, "repo-secret") || strings.Contains(joined, "pem") {
+		t.Errorf("agent must not receive repository credentials, got:\n%s", joined)
+	}
+}
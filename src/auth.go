@@ -14,19 +14,26 @@ type HTTPClient interface {
 }
 
 
+// repoTokenEnvVars hold credentials, including the action inputs they arrive
+// through, and are scrubbed from the environment of processes that must not see them.
+var repoTokenEnvVars = []string{
+	"GITHUB_TOKEN", "GH_TOKEN", "GH_ENTERPRISE_TOKEN", "GITHUB_APP_PRIVATE_KEY",
+	"INPUT_GITHUB_TOKEN", "INPUT_COPILOT_TOKEN", "INPUT_APP_PRIVATE_KEY",
+}
+
 type GitHubUser struct {
 	Login string `json:"login"`
 }
 
-func configureGitHubAuth(client HTTPClient, token string) error {
+func configureGitHubAuth(client HTTPClient, token, configHome string, host GitHubHost) error {
 	if token == "" {
 		return fmt.Errorf("GH_TOKEN is not set")
 	}
 
-	fmt.Println("Configuring gh auth manually to bypass scope validation...")
+	logInfo("Configuring gh auth manually to bypass scope validation...")
 
 	username := "headless-agent"
-	req, err := http.NewRequest("GET", "https://api.github.com/user", nil)
+	req, err := http.NewRequest("GET", host.APIURL+"/user", nil)
 	if err == nil {
 		req.Header.Set("Authorization", "token "+token)
 		resp, err := client.Do(req)
@@ -34,29 +41,29 @@ func configureGitHubAuth(client HTTPClient, token string) error {
 			var user GitHubUser
 			if err := json.NewDecoder(resp.Body).Decode(&user); err == nil {
 				username = user.Login
-				fmt.Printf("Detected username: %s\n", username)
+				logInfo("Detected username: %s", username)
 			}
 			resp.Body.Close()
 		}
 	}
 
 
-	configDir := filepath.Join(os.Getenv("HOME"), ".config", "gh")
+	configDir := filepath.Join(configHome, "gh")
 	if err := os.MkdirAll(configDir, 0755); err != nil {
 		return fmt.Errorf("failed to create gh config dir: %w", err)
 	}
 
-	hostsContent := fmt.Sprintf(`github.com:
+	hostsContent := fmt.Sprintf(`%s:
     user: "%s"
     oauth_token: "%s"
     git_protocol: "https"
-`, username, token)
+`, host.Name, username, token)
 
 	hostsFile := filepath.Join(configDir, "hosts.yml")
 	if err := os.WriteFile(hostsFile, []byte(hostsContent), 0600); err != nil {
 		return fmt.Errorf("failed to write hosts.yml: %w", err)
 	}
 
-	fmt.Println("gh auth configured successfully.")
+	logInfo("gh auth configured successfully.")
 	return nil
 }
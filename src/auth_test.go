@@ -30,8 +30,10 @@ func TestConfigureGitHubAuth(t *testing.T) {
 	os.Setenv("HOME", tmpHome)
 	defer os.Setenv("HOME", oldHome)
 
+	dotCom := GitHubHost{Name: "github.com", APIURL: "https://api.github.com"}
+
 	t.Run("Empty token", func(t *testing.T) {
-		err := configureGitHubAuth(&MockHTTPClient{}, "")
+		err := configureGitHubAuth(&MockHTTPClient{}, "", filepath.Join(tmpHome, ".config"), dotCom)
 		if err == nil {
 			t.Error("expected error for empty token")
 		}
@@ -40,6 +42,9 @@ func TestConfigureGitHubAuth(t *testing.T) {
 	t.Run("Valid token and successful API call", func(t *testing.T) {
 		mockClient := &MockHTTPClient{
 			DoFunc: func(req *http.Request) (*http.Response, error) {
+				if req.URL.String() != "https://api.github.com/user" {
+					t.Errorf("unexpected URL: %s", req.URL)
+				}
 				return &http.Response{
 					StatusCode: http.StatusOK,
 					Body:       io.NopCloser(bytes.NewBufferString(`{"login": "test-user"}`)),
@@ -47,7 +52,7 @@ func TestConfigureGitHubAuth(t *testing.T) {
 			},
 		}
 
-		err := configureGitHubAuth(mockClient, "valid-token")
+		err := configureGitHubAuth(mockClient, "valid-token", filepath.Join(tmpHome, ".config"), dotCom)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -73,7 +78,7 @@ func TestConfigureGitHubAuth(t *testing.T) {
 			},
 		}
 
-		err := configureGitHubAuth(mockClient, "token")
+		err := configureGitHubAuth(mockClient, "token", filepath.Join(tmpHome, ".config"), dotCom)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -88,4 +93,27 @@ func TestConfigureGitHubAuth(t *testing.T) {
 			t.Error("hosts.yml should contain default username on failure")
 		}
 	})
+
+	t.Run("Enterprise host", func(t *testing.T) {
+		ghes := GitHubHost{Name: "ghe.example.com", APIURL: "https://ghe.example.com/api/v3"}
+		mockClient := &MockHTTPClient{
+			DoFunc: func(req *http.Request) (*http.Response, error) {
+				if req.URL.String() != "https://ghe.example.com/api/v3/user" {
+					t.Errorf("unexpected URL: %s", req.URL)
+				}
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       io.NopCloser(bytes.NewBufferString(`{"login": "ghes-user"}`)),
+				}, nil
+			},
+		}
+
+		if err := configureGitHubAuth(mockClient, "token", filepath.Join(tmpHome, ".config"), ghes); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		data, _ := os.ReadFile(filepath.Join(tmpHome, ".config", "gh", "hosts.yml"))
+		if !bytes.HasPrefix(data, []byte("ghe.example.com:")) {
+			t.Errorf("hosts.yml should be keyed by the enterprise host, got:\n%s", data)
+		}
+	})
 }
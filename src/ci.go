@@ -0,0 +1,294 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CIProvider is the CI system the binary runs under: where it learns about the
+// run and how it hands variables and PATH entries to later steps.
+type CIProvider interface {
+	Name() string
+	// LogFormat is the default log renderer, see newLogger.
+	LogFormat() string
+	// Repository identifies the repository as owner/name; empty when unknown.
+	Repository() string
+	RunID() string
+	RunURL() string
+	Branch() string
+	// Event is the trigger in GitHub Actions terms (push, pull_request, schedule, ...).
+	Event() string
+	TempDir() string
+	ExportVariable(name, value string) error
+	// SetOutput sets an output of the action step; providers without step
+	// outputs ignore it and rely on ExportVariable.
+	SetOutput(name, value string) error
+	AddPath(dir string) error
+}
+
+var ciProvider = detectCIProvider(os.LookupEnv)
+
+type ciEnv func(string) (string, bool)
+
+func (env ciEnv) get(name string) string {
+	value, _ := env(name)
+	return value
+}
+
+func detectCIProvider(lookupEnv func(string) (string, bool)) CIProvider {
+	env := ciEnv(lookupEnv)
+	switch {
+	case env.get("GITHUB_ACTIONS") == "true":
+		return githubActions{env}
+	case env.get("GITLAB_CI") == "true":
+		return gitlabCI{env}
+	case strings.EqualFold(env.get("TF_BUILD"), "true"):
+		return azurePipelines{env}
+	}
+	return shellCI{env}
+}
+
+func newCIProvider(name string, lookupEnv func(string) (string, bool)) (CIProvider, error) {
+	env := ciEnv(lookupEnv)
+	switch name {
+	case "github":
+		return githubActions{env}, nil
+	case "gitlab":
+		return gitlabCI{env}, nil
+	case "azure":
+		return azurePipelines{env}, nil
+	case "shell":
+		return shellCI{env}, nil
+	}
+	return nil, fmt.Errorf("invalid CI provider %q: expected auto, github, gitlab, azure or shell", name)
+}
+
+// configureCI applies --ci and --repository. "auto" keeps the detected
+// provider; a repository overrides the one the provider reports.
+func configureCI(name, repository string) error {
+	provider := ciProvider
+	if o, ok := provider.(repositoryOverride); ok {
+		provider = o.CIProvider
+	}
+	if name != "" && name != "auto" {
+		p, err := newCIProvider(name, os.LookupEnv)
+		if err != nil {
+			return err
+		}
+		provider = p
+	}
+	if repository != "" {
+		provider = repositoryOverride{provider, repository}
+	}
+	ciProvider = provider
+	return nil
+}
+
+type repositoryOverride struct {
+	CIProvider
+	repository string
+}
+
+func (o repositoryOverride) Repository() string { return o.repository }
+
+func outputEnv(name, value string) {
+	if value == "" {
+		return
+	}
+	if err := ciProvider.ExportVariable(name, value); err != nil {
+		logError("Failed to export %s: %v", name, err)
+	}
+}
+
+// outputStep sets a step output, see CIProvider.SetOutput.
+func outputStep(name, value string) {
+	if err := ciProvider.SetOutput(name, value); err != nil {
+		logError("Failed to set output %s: %v", name, err)
+	}
+}
+
+type githubActions struct{ env ciEnv }
+
+func (githubActions) Name() string      { return "github" }
+func (githubActions) LogFormat() string { return "actions" }
+
+func (g githubActions) Repository() string { return g.env.get("GITHUB_REPOSITORY") }
+func (g githubActions) RunID() string      { return g.env.get("GITHUB_RUN_ID") }
+func (g githubActions) Event() string      { return g.env.get("GITHUB_EVENT_NAME") }
+
+func (g githubActions) Branch() string {
+	return firstNonEmpty(g.env.get("GITHUB_HEAD_REF"), g.env.get("GITHUB_REF_NAME"))
+}
+
+func (g githubActions) RunURL() string {
+	server := firstNonEmpty(g.env.get("GITHUB_SERVER_URL"), "https://github.com")
+	repo, runID := g.env.get("GITHUB_REPOSITORY"), g.RunID()
+	if repo == "" || runID == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s/actions/runs/%s", strings.TrimSuffix(server, "/"), repo, runID)
+}
+
+func (g githubActions) TempDir() string {
+	return firstNonEmpty(g.env.get("RUNNER_TEMP"), os.TempDir())
+}
+
+func (g githubActions) ExportVariable(name, value string) error {
+	githubEnv := g.env.get("GITHUB_ENV")
+	if githubEnv == "" {
+		return shellCI{g.env}.ExportVariable(name, value)
+	}
+	if strings.Contains(value, "\n") {
+		return appendLine(githubEnv, fmt.Sprintf("%s<<EOF\n%s\nEOF", name, value))
+	}
+	return appendLine(githubEnv, name+"="+value)
+}
+
+func (g githubActions) SetOutput(name, value string) error {
+	if githubOutput := g.env.get("GITHUB_OUTPUT"); githubOutput != "" {
+		return appendLine(githubOutput, name+"="+value)
+	}
+	return nil
+}
+
+func (g githubActions) AddPath(dir string) error {
+	if githubPath := g.env.get("GITHUB_PATH"); githubPath != "" {
+		return appendLine(githubPath, dir)
+	}
+	return nil
+}
+
+// gitlabCI hands variables to later jobs through a dotenv report: point
+// AGENTIC_AUDITS_ENV_FILE at the file listed under artifacts:reports:dotenv.
+type gitlabCI struct{ env ciEnv }
+
+func (gitlabCI) Name() string      { return "gitlab" }
+func (gitlabCI) LogFormat() string { return "gitlab" }
+
+func (g gitlabCI) Repository() string { return g.env.get("CI_PROJECT_PATH") }
+func (g gitlabCI) RunID() string      { return g.env.get("CI_PIPELINE_ID") }
+func (g gitlabCI) RunURL() string     { return g.env.get("CI_PIPELINE_URL") }
+func (g gitlabCI) TempDir() string    { return os.TempDir() }
+
+func (g gitlabCI) Branch() string {
+	return firstNonEmpty(g.env.get("CI_MERGE_REQUEST_SOURCE_BRANCH_NAME"), g.env.get("CI_COMMIT_REF_NAME"))
+}
+
+func (g gitlabCI) Event() string {
+	switch source := g.env.get("CI_PIPELINE_SOURCE"); source {
+	case "merge_request_event", "external_pull_request_event":
+		return "pull_request"
+	case "web", "api", "trigger":
+		return "workflow_dispatch"
+	default:
+		return source
+	}
+}
+
+func (g gitlabCI) ExportVariable(name, value string) error {
+	return shellCI{g.env}.ExportVariable(name, value)
+}
+
+func (gitlabCI) SetOutput(string, string) error { return nil }
+func (gitlabCI) AddPath(string) error           { return nil }
+
+// azurePipelines uses ##vso logging commands, which the agent reads from stdout.
+type azurePipelines struct{ env ciEnv }
+
+func (azurePipelines) Name() string      { return "azure" }
+func (azurePipelines) LogFormat() string { return "azure" }
+
+func (a azurePipelines) Repository() string { return a.env.get("BUILD_REPOSITORY_NAME") }
+func (a azurePipelines) RunID() string      { return a.env.get("BUILD_BUILDID") }
+
+func (a azurePipelines) RunURL() string {
+	collection, project, id := a.env.get("SYSTEM_COLLECTIONURI"), a.env.get("SYSTEM_TEAMPROJECT"), a.RunID()
+	if collection == "" || project == "" || id == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s/_build/results?buildId=%s", strings.TrimSuffix(collection, "/"), project, id)
+}
+
+func (a azurePipelines) Branch() string {
+	branch := firstNonEmpty(a.env.get("SYSTEM_PULLREQUEST_SOURCEBRANCH"), a.env.get("BUILD_SOURCEBRANCH"))
+	return strings.TrimPrefix(branch, "refs/heads/")
+}
+
+func (a azurePipelines) Event() string {
+	switch reason := a.env.get("BUILD_REASON"); reason {
+	case "PullRequest":
+		return "pull_request"
+	case "IndividualCI", "BatchedCI":
+		return "push"
+	case "Schedule":
+		return "schedule"
+	case "Manual":
+		return "workflow_dispatch"
+	default:
+		return reason
+	}
+}
+
+func (a azurePipelines) TempDir() string {
+	return firstNonEmpty(a.env.get("AGENT_TEMPDIRECTORY"), os.TempDir())
+}
+
+func (azurePipelines) ExportVariable(name, value string) error {
+	_, err := fmt.Fprintf(stdoutWriter{}, "##vso[task.setvariable variable=%s]%s\n", escapeAzureProperty(name), escapeAzureData(value))
+	return err
+}
+
+func (azurePipelines) SetOutput(string, string) error { return nil }
+
+func (azurePipelines) AddPath(dir string) error {
+	_, err := fmt.Fprintf(stdoutWriter{}, "##vso[task.prependpath]%s\n", escapeAzureData(dir))
+	return err
+}
+
+// shellCI is a plain shell or an unknown CI system. Variables go to the dotenv
+// file in AGENTIC_AUDITS_ENV_FILE, or to the log.
+type shellCI struct{ env ciEnv }
+
+func (shellCI) Name() string         { return "shell" }
+func (shellCI) LogFormat() string    { return "json" }
+func (shellCI) Repository() string   { return "" }
+func (shellCI) RunID() string        { return "" }
+func (shellCI) RunURL() string       { return "" }
+func (shellCI) Event() string        { return "" }
+func (shellCI) AddPath(string) error { return nil }
+func (shellCI) TempDir() string      { return os.TempDir() }
+func (shellCI) Branch() string       { return "" }
+
+func (s shellCI) ExportVariable(name, value string) error {
+	if envFile := s.env.get("AGENTIC_AUDITS_ENV_FILE"); envFile != "" {
+		// dotenv files hold one line per variable.
+		return appendLine(envFile, name+"="+strings.NewReplacer("\\", "\\\\", "\n", "\\n").Replace(value))
+	}
+	logInfo("EXPORT %s=%s", name, value)
+	return nil
+}
+
+func (shellCI) SetOutput(string, string) error { return nil }
+
+func appendLine(path, line string) error {
+	if dir := filepath.Dir(path); dir != "." {
+		os.MkdirAll(dir, 0755)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintln(f, line)
+	return err
+}
+
+func escapeAzureData(s string) string {
+	return strings.NewReplacer("%", "%AZP25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func escapeAzureProperty(s string) string {
+	return strings.NewReplacer("%", "%AZP25", "\r", "%0D", "\n", "%0A", ";", "%3B", "]", "%5D").Replace(s)
+}
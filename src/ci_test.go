@@ -0,0 +1,145 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectCIProvider(t *testing.T) {
+	tests := []struct {
+		env  map[string]string
+		want string
+	}{
+		{map[string]string{"GITHUB_ACTIONS": "true"}, "github"},
+		{map[string]string{"GITLAB_CI": "true"}, "gitlab"},
+		{map[string]string{"TF_BUILD": "True"}, "azure"},
+		{nil, "shell"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := detectCIProvider(envLookup(tt.env)).Name(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCIProviders(t *testing.T) {
+	tests := []struct {
+		name                              string
+		provider                          CIProvider
+		repository, runURL, branch, event string
+	}{
+		{"GitHub push", githubActions{envLookup(map[string]string{
+			"GITHUB_SERVER_URL": "https://github.example.com/", "GITHUB_REPOSITORY": "o/r", "GITHUB_RUN_ID": "42",
+			"GITHUB_REF_NAME": "main", "GITHUB_EVENT_NAME": "push",
+		})}, "o/r", "https://github.example.com/o/r/actions/runs/42", "main", "push"},
+		{"GitHub pull request", githubActions{envLookup(map[string]string{
+			"GITHUB_REPOSITORY": "o/r", "GITHUB_HEAD_REF": "feature", "GITHUB_REF_NAME": "7/merge", "GITHUB_EVENT_NAME": "pull_request",
+		})}, "o/r", "", "feature", "pull_request"},
+		{"GitLab merge request", gitlabCI{envLookup(map[string]string{
+			"CI_PROJECT_PATH": "group/sub/repo", "CI_PIPELINE_ID": "9", "CI_PIPELINE_URL": "https://gitlab.example.com/group/sub/repo/-/pipelines/9",
+			"CI_COMMIT_REF_NAME": "main", "CI_MERGE_REQUEST_SOURCE_BRANCH_NAME": "feature", "CI_PIPELINE_SOURCE": "merge_request_event",
+		})}, "group/sub/repo", "https://gitlab.example.com/group/sub/repo/-/pipelines/9", "feature", "pull_request"},
+		{"GitLab web", gitlabCI{envLookup(map[string]string{"CI_COMMIT_REF_NAME": "main", "CI_PIPELINE_SOURCE": "web"})}, "", "", "main", "workflow_dispatch"},
+		{"Azure schedule", azurePipelines{envLookup(map[string]string{
+			"BUILD_REPOSITORY_NAME": "o/r", "BUILD_BUILDID": "5", "SYSTEM_COLLECTIONURI": "https://dev.azure.com/org/", "SYSTEM_TEAMPROJECT": "audits",
+			"BUILD_SOURCEBRANCH": "refs/heads/main", "BUILD_REASON": "Schedule",
+		})}, "o/r", "https://dev.azure.com/org/audits/_build/results?buildId=5", "main", "schedule"},
+		{"Azure pull request", azurePipelines{envLookup(map[string]string{
+			"BUILD_SOURCEBRANCH": "refs/pull/3/merge", "SYSTEM_PULLREQUEST_SOURCEBRANCH": "refs/heads/feature", "BUILD_REASON": "PullRequest",
+		})}, "", "", "feature", "pull_request"},
+		{"Shell", shellCI{envLookup(nil)}, "", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.provider
+			if p.Repository() != tt.repository || p.RunURL() != tt.runURL || p.Branch() != tt.branch || p.Event() != tt.event {
+				t.Errorf("got repository=%q runURL=%q branch=%q event=%q", p.Repository(), p.RunURL(), p.Branch(), p.Event())
+			}
+		})
+	}
+}
+
+func TestConfigureCI(t *testing.T) {
+	old := ciProvider
+	defer func() { ciProvider = old }()
+	ciProvider = githubActions{envLookup(map[string]string{"GITHUB_REPOSITORY": "o/r"})}
+
+	if err := configureCI("jenkins", ""); err == nil {
+		t.Error("expected error for an unknown provider")
+	}
+	if err := configureCI("auto", "mirror/repo"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ciProvider.Name() != "github" || ciProvider.Repository() != "mirror/repo" {
+		t.Errorf("expected the repository override on GitHub, got %s %s", ciProvider.Name(), ciProvider.Repository())
+	}
+	if err := configureCI("shell", ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ciProvider.Name() != "shell" || ciProvider.Repository() != "" {
+		t.Errorf("expected a plain shell without the override, got %s %q", ciProvider.Name(), ciProvider.Repository())
+	}
+}
+
+func TestExportVariable(t *testing.T) {
+	t.Run("GitHub", func(t *testing.T) {
+		dir := t.TempDir()
+		envFile, pathFile, outputFile := filepath.Join(dir, "env"), filepath.Join(dir, "path"), filepath.Join(dir, "output")
+		g := githubActions{envLookup(map[string]string{"GITHUB_ENV": envFile, "GITHUB_PATH": pathFile, "GITHUB_OUTPUT": outputFile})}
+		g.ExportVariable("A", "1")
+		g.ExportVariable("B", "x\ny")
+		g.AddPath("/opt/gh/bin")
+		g.SetOutput("tokens", "15")
+
+		env, _ := os.ReadFile(envFile)
+		path, _ := os.ReadFile(pathFile)
+		output, _ := os.ReadFile(outputFile)
+		if string(env) != "A=1\nB<<EOF\nx\ny\nEOF\n" || string(path) != "/opt/gh/bin\n" || string(output) != "tokens=15\n" {
+			t.Errorf("unexpected files: env=%q path=%q output=%q", env, path, output)
+		}
+	})
+
+	t.Run("GitLab dotenv", func(t *testing.T) {
+		envFile := filepath.Join(t.TempDir(), "audit.env")
+		g := gitlabCI{envLookup(map[string]string{"AGENTIC_AUDITS_ENV_FILE": envFile})}
+		g.ExportVariable("SUMMARY", `a\b`+"\nc")
+
+		env, _ := os.ReadFile(envFile)
+		if string(env) != `SUMMARY=a\\b\nc`+"\n" {
+			t.Errorf("unexpected dotenv: %q", env)
+		}
+	})
+
+	t.Run("Azure", func(t *testing.T) {
+		out := captureStdout(t, func() {
+			a := azurePipelines{envLookup(nil)}
+			a.ExportVariable("PR_URL", "50%\nnext")
+			a.AddPath("/opt/gh/bin")
+		})
+		want := "##vso[task.setvariable variable=PR_URL]50%AZP25%0Anext\n##vso[task.prependpath]/opt/gh/bin\n"
+		if out != want {
+			t.Errorf("got %q, want %q", out, want)
+		}
+	})
+
+	t.Run("Shell without env file logs", func(t *testing.T) {
+		out := captureStdout(t, func() {
+			shellCI{envLookup(nil)}.ExportVariable("PR_URL", "https://example.com/pr/1")
+		})
+		if out != "EXPORT PR_URL=https://example.com/pr/1\n" {
+			t.Errorf("unexpected output: %q", out)
+		}
+	})
+}
+
+func TestEscapeAzure(t *testing.T) {
+	if got := escapeAzureProperty("a;b]c%\r\n"); got != "a%3Bb%5Dc%AZP25%0D%0A" {
+		t.Errorf("unexpected property escape: %s", got)
+	}
+	if got := escapeAzureData("##vso[x]; 100%"); got != "##vso[x]; 100%AZP25" {
+		t.Errorf("unexpected data escape: %s", got)
+	}
+}
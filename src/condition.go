@@ -0,0 +1,316 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// SourceContext is what `when` conditions on sources can test.
+type SourceContext struct {
+	Template  string
+	Mission   string
+	Branch    string
+	Event     string
+	LookupEnv func(string) (string, bool)
+}
+
+// newSourceContext describes the current mission and CI run.
+func newSourceContext(cfg *RunConfig, ci CIProvider, lookupEnv func(string) (string, bool)) SourceContext {
+	return SourceContext{
+		Template:  cfg.Template,
+		Mission:   cfg.MissionName,
+		Branch:    ci.Branch(),
+		Event:     ci.Event(),
+		LookupEnv: lookupEnv,
+	}
+}
+
+// filterSources drops enabled sources whose `when` condition is false.
+func filterSources(sources []Source, ctx SourceContext) ([]Source, error) {
+	var kept []Source
+	for _, source := range sources {
+		if source.Enabled && source.When != "" {
+			ok, err := evalCondition(source.When, ctx)
+			if err != nil {
+				return nil, fmt.Errorf("source %s: %w", source.Name, err)
+			}
+			if !ok {
+				logInfo("Source %s skipped (when: %s)", source.Name, source.When)
+				continue
+			}
+		}
+		kept = append(kept, source)
+	}
+	return kept, nil
+}
+
+// A condition is a small boolean expression:
+//
+//	template == 'skills-audit' || mission in ('docs', 'readme')
+//	env.CONTEXT7_API_KEY && !matches(branch, 'release/*')
+//	secrets.SLACK_TOKEN && event != 'pull_request'
+//
+// Operands are quoted strings, true/false, and the variables template,
+// mission, branch, event, env.NAME (the variable's value) and secrets.NAME
+// (only whether it is set). Operators are ==, !=, in (...), !, && and ||,
+// plus matches(value, 'glob'), startsWith(value, prefix) and
+// contains(value, substring). A value is true when it is neither empty nor
+// "false".
+type condition func(SourceContext) string
+
+func evalCondition(expr string, ctx SourceContext) (bool, error) {
+	cond, err := parseCondition(expr)
+	if err != nil {
+		return false, err
+	}
+	return truthy(cond(ctx)), nil
+}
+
+func parseCondition(expr string) (condition, error) {
+	tokens, err := tokenizeCondition(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid condition %q: %w", expr, err)
+	}
+	p := &conditionParser{tokens: tokens}
+	cond, err := p.or()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid condition %q: %w", expr, err)
+	}
+	return cond, nil
+}
+
+func truthy(value string) bool {
+	return value != "" && value != "false"
+}
+
+func boolValue(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
+
+// tokenizeCondition splits expr into operators, identifiers and quoted
+// strings; strings keep their opening quote so they cannot be confused with
+// identifiers.
+func tokenizeCondition(expr string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(expr[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, expr[i:i+end+1])
+			i += end + 2
+		case strings.HasPrefix(expr[i:], "&&"), strings.HasPrefix(expr[i:], "||"),
+			strings.HasPrefix(expr[i:], "=="), strings.HasPrefix(expr[i:], "!="):
+			tokens = append(tokens, expr[i:i+2])
+			i += 2
+		case strings.ContainsRune("!(),", rune(c)):
+			tokens = append(tokens, string(c))
+			i++
+		case isIdentChar(c):
+			start := i
+			for i < len(expr) && (isIdentChar(expr[i]) || expr[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, expr[start:i])
+		default:
+			return nil, fmt.Errorf("unexpected character %q", c)
+		}
+	}
+	return tokens, nil
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '-' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+type conditionParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *conditionParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *conditionParser) expect(token string) error {
+	if p.peek() != token {
+		if p.peek() == "" {
+			return fmt.Errorf("expected %q at end of condition", token)
+		}
+		return fmt.Errorf("expected %q, got %q", token, p.peek())
+	}
+	p.pos++
+	return nil
+}
+
+func (p *conditionParser) or() (condition, error) {
+	left, err := p.and()
+	for err == nil && p.peek() == "||" {
+		p.pos++
+		var right condition
+		if right, err = p.and(); err == nil {
+			l := left
+			left = func(ctx SourceContext) string { return boolValue(truthy(l(ctx)) || truthy(right(ctx))) }
+		}
+	}
+	return left, err
+}
+
+func (p *conditionParser) and() (condition, error) {
+	left, err := p.not()
+	for err == nil && p.peek() == "&&" {
+		p.pos++
+		var right condition
+		if right, err = p.not(); err == nil {
+			l := left
+			left = func(ctx SourceContext) string { return boolValue(truthy(l(ctx)) && truthy(right(ctx))) }
+		}
+	}
+	return left, err
+}
+
+func (p *conditionParser) not() (condition, error) {
+	if p.peek() == "!" {
+		p.pos++
+		operand, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx SourceContext) string { return boolValue(!truthy(operand(ctx))) }, nil
+	}
+	return p.comparison()
+}
+
+func (p *conditionParser) comparison() (condition, error) {
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	switch p.peek() {
+	case "==", "!=":
+		negate := p.peek() == "!="
+		p.pos++
+		right, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx SourceContext) string { return boolValue((left(ctx) == right(ctx)) != negate) }, nil
+	case "in":
+		p.pos++
+		list, err := p.arguments()
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx SourceContext) string {
+			value := left(ctx)
+			for _, item := range list {
+				if item(ctx) == value {
+					return "true"
+				}
+			}
+			return "false"
+		}, nil
+	}
+	return left, nil
+}
+
+func (p *conditionParser) arguments() ([]condition, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var args []condition
+	for p.peek() != ")" {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	p.pos++
+	return args, nil
+}
+
+var conditionFunctions = map[string]func(value, arg string) bool{
+	"matches": func(value, pattern string) bool {
+		ok, _ := path.Match(pattern, value)
+		return ok
+	},
+	"startsWith": strings.HasPrefix,
+	"contains":   strings.Contains,
+}
+
+func (p *conditionParser) operand() (condition, error) {
+	token := p.peek()
+	p.pos++
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("unexpected end of condition")
+	case token == "(":
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return inner, p.expect(")")
+	case token[0] == '\'' || token[0] == '"':
+		value := token[1:]
+		return func(SourceContext) string { return value }, nil
+	case token == "true" || token == "false":
+		return func(SourceContext) string { return token }, nil
+	case conditionFunctions[token] != nil:
+		fn := conditionFunctions[token]
+		args, err := p.arguments()
+		if err != nil {
+			return nil, err
+		}
+		if len(args) != 2 {
+			return nil, fmt.Errorf("%s takes 2 arguments, got %d", token, len(args))
+		}
+		return func(ctx SourceContext) string { return boolValue(fn(args[0](ctx), args[1](ctx))) }, nil
+	case strings.HasPrefix(token, "env.") && len(token) > 4:
+		name := token[4:]
+		return func(ctx SourceContext) string { return lookupValue(ctx, name) }, nil
+	case strings.HasPrefix(token, "secrets.") && len(token) > 8:
+		name := token[8:]
+		return func(ctx SourceContext) string { return boolValue(lookupValue(ctx, name) != "") }, nil
+	}
+
+	variables := map[string]func(SourceContext) string{
+		"template": func(ctx SourceContext) string { return ctx.Template },
+		"mission":  func(ctx SourceContext) string { return ctx.Mission },
+		"branch":   func(ctx SourceContext) string { return ctx.Branch },
+		"event":    func(ctx SourceContext) string { return ctx.Event },
+	}
+	if variable, ok := variables[token]; ok {
+		return variable, nil
+	}
+	p.pos--
+	return nil, fmt.Errorf("unknown identifier %q", token)
+}
+
+func lookupValue(ctx SourceContext, name string) string {
+	if ctx.LookupEnv == nil {
+		return ""
+	}
+	value, _ := ctx.LookupEnv(name)
+	return value
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEvalCondition(t *testing.T) {
+	ctx := SourceContext{
+		Template: "skills-audit",
+		Mission:  "docs",
+		Branch:   "release/1.2",
+		Event:    "schedule",
+		LookupEnv: envLookup(map[string]string{
+			"API_KEY":    "secret-value",
+			"STAGE":      "prod",
+			"DISABLED":   "false",
+			"EMPTY_FLAG": "",
+		}),
+	}
+
+	tests := map[string]bool{
+		"template == 'skills-audit'":                      true,
+		`template != "skills-audit"`:                      false,
+		"mission in ('docs', 'readme')":                   true,
+		"mission in ('audit')":                            false,
+		"env.API_KEY":                                     true,
+		"env.MISSING":                                     false,
+		"env.EMPTY_FLAG":                                  false,
+		"env.DISABLED":                                    false,
+		"env.STAGE == 'prod'":                             true,
+		"secrets.API_KEY == 'true'":                       true,
+		"secrets.MISSING":                                 false,
+		"!secrets.MISSING":                                true,
+		"matches(branch, 'release/*')":                    true,
+		"startsWith(branch, 'main')":                      false,
+		"contains(template, 'audit')":                     true,
+		"event == 'schedule' && !matches(branch, 'main')": true,
+		"event == 'push' || template == 'skills-audit'":   true,
+		"(event == 'push' || mission == 'docs') && false": false,
+		"true":                                true,
+		"!(mission == 'docs' && env.API_KEY)": false,
+		"event == 'push' || event == 'pull_request' || !true": false,
+	}
+	for expr, want := range tests {
+		got, err := evalCondition(expr, ctx)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", expr, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%s = %v, want %v", expr, got, want)
+		}
+	}
+}
+
+func TestParseConditionErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"template ==",
+		"branch == 'main",
+		"unknown == 'x'",
+		"mission in 'docs'",
+		"matches(branch)",
+		"(mission == 'docs'",
+		"mission == 'docs' env.X",
+		"mission = 'docs'",
+	} {
+		if _, err := parseCondition(expr); err == nil {
+			t.Errorf("%q: expected an error", expr)
+		} else if !strings.Contains(err.Error(), "invalid condition") {
+			t.Errorf("%q: unexpected error %v", expr, err)
+		}
+	}
+}
+
+func TestFilterSources(t *testing.T) {
+	sources := []Source{
+		{Name: "always", Type: "web", URL: "https://a", Enabled: true},
+		{Name: "audit-only", Type: "mcp", Package: "p", Enabled: true, When: "template == 'skills-audit'"},
+		{Name: "needs-key", Type: "mcp", Package: "q", Enabled: true, When: "secrets.API_KEY"},
+		{Name: "off", Type: "mcp", Package: "r", When: "true"},
+	}
+	cfg := &RunConfig{Template: "skills-audit", MissionName: "audit"}
+	lookup := envLookup(map[string]string{"GITHUB_REF_NAME": "main", "GITHUB_EVENT_NAME": "push"})
+	ctx := newSourceContext(cfg, githubActions{lookup}, lookup)
+	if ctx.Branch != "main" || ctx.Event != "push" || ctx.Mission != "audit" {
+		t.Errorf("unexpected context %+v", ctx)
+	}
+
+	kept, err := filterSources(sources, ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var names []string
+	for _, s := range kept {
+		names = append(names, s.Name)
+	}
+	if strings.Join(names, ",") != "always,audit-only,off" {
+		t.Errorf("unexpected sources kept: %v", names)
+	}
+
+	if _, err := filterSources([]Source{{Name: "bad", Enabled: true, When: "nope"}}, ctx); err == nil || !strings.Contains(err.Error(), "source bad") {
+		t.Errorf("expected error naming the source, got %v", err)
+	}
+}
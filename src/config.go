@@ -0,0 +1,336 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RunConfig is the resolved configuration for one invocation. Every field is
+// backed by a flag; see loadRunConfig for how values are layered.
+type RunConfig struct {
+	ShowVersion bool
+	ConfigFile  string
+	CI          string
+	Repository  string
+	LogFormat   string
+	LogLevel    string
+
+	// MissionName selects missions from MissionsFile. Plan holds one resolved
+	// config per mission in run order; Spec is that mission's declaration
+	// (nil when no missions file is used).
+	MissionName  string
+	MissionsFile string
+	Spec         *MissionSpec
+	Plan         []*RunConfig
+	PRMode       string
+
+	Mission       string
+	Template      string
+	SourcesConfig string
+	SourcesLock   string
+	OrgSources    string
+	PrintSources  bool
+	ContextFiles  string
+	Model         string
+	FallbackModel string
+	Timeout       time.Duration
+	DryRun        bool
+
+	MaxChangedFiles    int
+	AllowedPaths       []string
+	MaxPremiumRequests float64
+	MaxTokens          int64
+
+	GithubToken       string
+	CopilotToken      string
+	GithubHost        string
+	AppID             string
+	AppPrivateKey     string
+	AppInstallationID string
+	AppOwner          string
+	SkipPreflight     bool
+
+	PRTitleTemplate string
+	PRBodyTemplate  string
+	PRTitle         string
+	PRBody          string
+	PRBase          string
+	PRBranch        string
+	PRLabels        []string
+
+	FetchWebSources bool
+	BuiltinMCP      bool
+	MCPHealthCheck  bool
+	MCPTimeout      time.Duration
+	WebCacheDir     string
+	WebMaxBytes     int64
+	WebAllowedHosts []string
+
+	SkipSetup               bool
+	GhInstall               string
+	GhMinVersion            string
+	GhTarball               string
+	GhTarballSHA256         string
+	GhBinDir                string
+	CopilotExtension        string
+	CopilotExtensionVersion string
+	ExtensionCacheDir       string
+	SharedHome              bool
+}
+
+// listValue is a flag.Value for comma- or newline-separated lists.
+type listValue struct {
+	items *[]string
+}
+
+func (l listValue) String() string {
+	if l.items == nil {
+		return ""
+	}
+	return strings.Join(*l.items, ",")
+}
+
+func (l listValue) Set(value string) error {
+	*l.items = splitList(value)
+	return nil
+}
+
+func newRunFlagSet(cfg *RunConfig) *flag.FlagSet {
+	fs := flag.NewFlagSet("agent", flag.ContinueOnError)
+	fs.BoolVar(&cfg.ShowVersion, "version", false, "Print the version and exit")
+	fs.StringVar(&cfg.ConfigFile, "config", "", "Path to a YAML config file with flag values")
+	fs.StringVar(&cfg.CI, "ci", "auto", "CI provider: auto, github, gitlab, azure or shell")
+	fs.StringVar(&cfg.Repository, "repository", "", "Repository as owner/name (defaults to the one the CI provider reports)")
+	fs.StringVar(&cfg.LogFormat, "log-format", "", "Log format: actions, gitlab, azure or json (defaults to the CI provider's)")
+	fs.StringVar(&cfg.LogLevel, "log-level", "info", "Minimum log level: debug, info, warn or error")
+	fs.StringVar(&cfg.MissionName, "mission-name", "", "Comma-separated missions to run from the missions file; dependencies run first")
+	fs.StringVar(&cfg.PRMode, "pr-mode", "combined", "With several missions, open one 'combined' PR or one stacked PR 'per-mission'")
+	fs.StringVar(&cfg.MissionsFile, "missions-file", defaultMissionsFile, "Path to the declarative missions file")
+
+	fs.StringVar(&cfg.Mission, "mission", "", "Agent mission prompt")
+	fs.StringVar(&cfg.Template, "template", "", "Mission template name")
+	fs.StringVar(&cfg.SourcesConfig, "sources-config", ".github/sources.yml", "Path to sources config")
+	fs.StringVar(&cfg.SourcesLock, "sources-lock", defaultSourcesLock, "Lock file pinning MCP package versions")
+	fs.StringVar(&cfg.OrgSources, "org-sources", "", "Organization sources layer: a file, an https URL or owner/repo/path[@ref]")
+	fs.BoolVar(&cfg.PrintSources, "print-sources", false, "Print the effective sources of each mission and exit")
+	fs.StringVar(&cfg.ContextFiles, "context-files", ".", "Context files or globs")
+	fs.StringVar(&cfg.Model, "model", "", "Primary model")
+	fs.StringVar(&cfg.FallbackModel, "fallback-model", "", "Fallback model")
+	fs.DurationVar(&cfg.Timeout, "timeout", 0, "Maximum duration of each agent attempt, e.g. 20m (0 = no limit)")
+	fs.BoolVar(&cfg.DryRun, "dry-run", false, "Skip PR creation")
+	fs.IntVar(&cfg.MaxChangedFiles, "max-changed-files", 0, "Fail instead of opening a PR when more files change (0 = no limit)")
+	fs.Var(listValue{&cfg.AllowedPaths}, "allowed-paths", "Comma-separated globs or directories/ the mission may change")
+	fs.Float64Var(&cfg.MaxPremiumRequests, "max-premium-requests", 0, "Abort the mission once it used more premium requests (0 = no limit)")
+	fs.Int64Var(&cfg.MaxTokens, "max-tokens", 0, "Abort the mission once it used more input and output tokens (0 = no limit)")
+
+	fs.StringVar(&cfg.GithubToken, "github-token", "", "GitHub token for repository writes and PRs")
+	fs.StringVar(&cfg.CopilotToken, "copilot-token", "", "GitHub token with Copilot access for the model (defaults to --github-token)")
+	fs.StringVar(&cfg.GithubHost, "github-host", "", "GitHub host (defaults to GITHUB_SERVER_URL, then github.com)")
+	fs.StringVar(&cfg.AppID, "app-id", "", "GitHub App ID to authenticate as instead of a token")
+	fs.StringVar(&cfg.AppPrivateKey, "app-private-key", "", "GitHub App private key PEM or path to it")
+	fs.StringVar(&cfg.AppInstallationID, "app-installation-id", "", "GitHub App installation ID")
+	fs.StringVar(&cfg.AppOwner, "app-owner", "", "Owner whose App installation to use (defaults to the repository owner)")
+	fs.BoolVar(&cfg.SkipPreflight, "skip-preflight", false, "Skip token capability checks before running the mission")
+
+	fs.StringVar(&cfg.PRTitleTemplate, "pr-title-template", filepath.Join(".github", "templates", "pr", "title.md"), "Path to the PR title template")
+	fs.StringVar(&cfg.PRBodyTemplate, "pr-body-template", filepath.Join(".github", "templates", "pr", "body.md"), "Path to the PR body template")
+	fs.StringVar(&cfg.PRTitle, "pr-title", "", "Inline PR title template (overrides --pr-title-template)")
+	fs.StringVar(&cfg.PRBody, "pr-body", "", "Inline PR body template (overrides --pr-body-template)")
+	fs.StringVar(&cfg.PRBase, "pr-base", "main", "Base branch for the PR")
+	fs.StringVar(&cfg.PRBranch, "pr-branch", "", "Branch for the PR (default agent/audit-<timestamp>)")
+	cfg.PRLabels = []string{"automated-pr"}
+	fs.Var(listValue{&cfg.PRLabels}, "pr-labels", "Comma-separated PR labels")
+
+	fs.BoolVar(&cfg.FetchWebSources, "fetch-web-sources", true, "Fetch web sources as Markdown files instead of only naming them in the prompt")
+	fs.BoolVar(&cfg.BuiltinMCP, "builtin-mcp", true, "Register the built-in agentic-audits MCP server with the agent")
+	fs.BoolVar(&cfg.MCPHealthCheck, "mcp-health-check", true, "Start each MCP server and list its tools before the agent runs")
+	fs.DurationVar(&cfg.MCPTimeout, "mcp-timeout", defaultMCPTimeout, "Maximum time an MCP server may take to answer the health check")
+	fs.StringVar(&cfg.WebCacheDir, "web-cache-dir", defaultCacheDir("web"), "Directory caching fetched web sources")
+	fs.Int64Var(&cfg.WebMaxBytes, "web-max-bytes", defaultWebMaxBytes, "Maximum bytes downloaded per web source")
+	fs.Var(listValue{&cfg.WebAllowedHosts}, "web-allowed-hosts", "Hosts web sources may be fetched from; '.example.com' includes subdomains (default: any)")
+
+	fs.BoolVar(&cfg.SkipSetup, "skip-setup", false, "Skip GH CLI and extension installation")
+	fs.StringVar(&cfg.GhInstall, "gh-install", "auto", "How to install gh: auto, apt, tarball or skip")
+	fs.StringVar(&cfg.GhMinVersion, "gh-min-version", "2.40.0", "Minimum gh version to accept an existing install")
+	fs.StringVar(&cfg.GhTarball, "gh-tarball", "", "gh release tarball, cache directory or URL for the tarball install")
+	fs.StringVar(&cfg.GhTarballSHA256, "gh-tarball-sha256", "", "Expected SHA-256 of the gh tarball")
+	fs.StringVar(&cfg.GhBinDir, "gh-bin-dir", filepath.Join(os.Getenv("HOME"), ".local", "bin"), "Directory the gh tarball is installed into")
+	fs.StringVar(&cfg.CopilotExtension, "copilot-extension", "", "gh-copilot extension source: repository or local directory (default github/gh-copilot)")
+	fs.StringVar(&cfg.CopilotExtensionVersion, "copilot-extension-version", "", "Pin the gh-copilot extension to this release tag")
+	fs.StringVar(&cfg.ExtensionCacheDir, "extension-cache-dir", defaultExtensionCacheDir(), "Directory caching gh-copilot builds by version")
+	fs.BoolVar(&cfg.SharedHome, "shared-home", false, "Use the real HOME instead of an isolated per-run config sandbox")
+	return fs
+}
+
+// inputEnvName maps a flag name to its GitHub Actions style variable, e.g. dry-run -> INPUT_DRY_RUN.
+func inputEnvName(flagName string) string {
+	return "INPUT_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// loadRunConfig resolves the shared configuration and one config per selected
+// mission. Each value is resolved with this precedence, highest first:
+// command-line flags, INPUT_* environment variables, the mission from the
+// missions file, the config file, defaults.
+// Empty INPUT_* values count as unset, matching how Actions passes blank inputs.
+// Values are parsed by their flag type, so booleans, lists and durations are
+// validated the same way wherever they come from.
+func loadRunConfig(args []string, lookupEnv func(string) (string, bool)) (*RunConfig, error) {
+	cfg, err := resolveRunConfig(args, lookupEnv, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	if cfg.PRMode != "combined" && cfg.PRMode != "per-mission" {
+		return nil, fmt.Errorf("unknown PR mode %q (want combined or per-mission)", cfg.PRMode)
+	}
+
+	names := splitList(cfg.MissionName)
+	if len(names) == 0 {
+		cfg.Plan = []*RunConfig{cfg}
+		return cfg, nil
+	}
+	file, err := loadMissionsFile(cfg.MissionsFile)
+	if err != nil {
+		return nil, err
+	}
+	order, err := file.Plan(names)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range order {
+		missionCfg, err := resolveRunConfig(args, lookupEnv, file, name)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Plan = append(cfg.Plan, missionCfg)
+	}
+	return cfg, nil
+}
+
+// resolveRunConfig layers flags, INPUT_* variables, the named mission from
+// file (if any), the config file and defaults into one config.
+func resolveRunConfig(args []string, lookupEnv func(string) (string, bool), file *MissionsFile, missionName string) (*RunConfig, error) {
+	cfg := &RunConfig{}
+	fs := newRunFlagSet(cfg)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected positional arguments %q; pass values as --flag=value (boolean flags do not take a separate value)", fs.Args())
+	}
+
+	explicit := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = f.Value.String()
+	})
+
+	configFile := cfg.ConfigFile
+	if configFile == "" {
+		configFile, _ = lookupEnv(inputEnvName("config"))
+	}
+	if configFile != "" {
+		values, err := readConfigFile(configFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := applyConfigValues(fs, values, configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if file != nil {
+		spec := file.Mission(missionName)
+		if err := applyConfigValues(fs, spec.flagValues(), fmt.Sprintf("mission %q", missionName)); err != nil {
+			return nil, err
+		}
+		cfg.Spec = &spec
+	}
+
+	var envErr error
+	fs.VisitAll(func(f *flag.Flag) {
+		value, ok := lookupEnv(inputEnvName(f.Name))
+		if !ok || value == "" || envErr != nil {
+			return
+		}
+		if err := fs.Set(f.Name, value); err != nil {
+			envErr = fmt.Errorf("invalid value %q for %s: %w", value, inputEnvName(f.Name), err)
+		}
+	})
+	if envErr != nil {
+		return nil, envErr
+	}
+
+	for name, value := range explicit {
+		if err := fs.Set(name, value); err != nil {
+			return nil, err
+		}
+	}
+	if file != nil {
+		cfg.MissionName = missionName
+	}
+	return cfg, nil
+}
+
+func readConfigFile(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	values := make(map[string]interface{})
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// applyConfigValues sets flags from a config file map. Keys may use dashes or
+// underscores; lists are joined so list flags can parse them.
+func applyConfigValues(fs *flag.FlagSet, values map[string]interface{}, source string) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		name := strings.ReplaceAll(key, "_", "-")
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("unknown key %q in %s", key, source)
+		}
+		value, err := configScalar(values[key])
+		if err != nil {
+			return fmt.Errorf("invalid value for %q in %s: %w", key, source, err)
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("invalid value for %q in %s: %w", key, source, err)
+		}
+	}
+	return nil
+}
+
+func configScalar(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := configScalar(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+	case map[string]interface{}:
+		return "", fmt.Errorf("expected a scalar or list, got a mapping")
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
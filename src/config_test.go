@@ -0,0 +1,124 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func envLookup(values map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		v, ok := values[name]
+		return v, ok
+	}
+}
+
+func TestLoadRunConfig(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		cfg, err := loadRunConfig(nil, envLookup(nil))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cfg.DryRun || cfg.PRBase != "main" || cfg.SourcesConfig != ".github/sources.yml" {
+			t.Errorf("unexpected defaults: %+v", cfg)
+		}
+		if !reflect.DeepEqual(cfg.PRLabels, []string{"automated-pr"}) {
+			t.Errorf("unexpected default labels: %v", cfg.PRLabels)
+		}
+	})
+
+	t.Run("Typed input values", func(t *testing.T) {
+		cfg, err := loadRunConfig(nil, envLookup(map[string]string{
+			"INPUT_DRY_RUN":   "true",
+			"INPUT_PR_LABELS": "audit, docs\nbot",
+			"INPUT_TIMEOUT":   "15m",
+			"INPUT_MODEL":     "",
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !cfg.DryRun {
+			t.Error("INPUT_DRY_RUN=true should enable dry run")
+		}
+		if !reflect.DeepEqual(cfg.PRLabels, []string{"audit", "docs", "bot"}) {
+			t.Errorf("unexpected labels: %v", cfg.PRLabels)
+		}
+		if cfg.Timeout != 15*time.Minute {
+			t.Errorf("expected 15m timeout, got %s", cfg.Timeout)
+		}
+	})
+
+	t.Run("Invalid typed values", func(t *testing.T) {
+		for name, value := range map[string]string{"INPUT_DRY_RUN": "yes please", "INPUT_TIMEOUT": "soon"} {
+			if _, err := loadRunConfig(nil, envLookup(map[string]string{name: value})); err == nil || !strings.Contains(err.Error(), name) {
+				t.Errorf("%s=%q: expected error naming the variable, got %v", name, value, err)
+			}
+		}
+	})
+
+	t.Run("Precedence", func(t *testing.T) {
+		configFile := filepath.Join(t.TempDir(), "agentic-audits.yml")
+		os.WriteFile(configFile, []byte("model: from-file\nfallback_model: file-fallback\npr-base: develop\npr_labels: [a, b]\n"), 0644)
+
+		cfg, err := loadRunConfig([]string{"--config", configFile, "--model", "from-flag"}, envLookup(map[string]string{
+			"INPUT_MODEL":   "from-env",
+			"INPUT_PR_BASE": "release",
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cfg.Model != "from-flag" {
+			t.Errorf("flag should win, got %q", cfg.Model)
+		}
+		if cfg.PRBase != "release" {
+			t.Errorf("INPUT_* should beat the config file, got %q", cfg.PRBase)
+		}
+		if cfg.FallbackModel != "file-fallback" {
+			t.Errorf("config file should beat defaults, got %q", cfg.FallbackModel)
+		}
+		if !reflect.DeepEqual(cfg.PRLabels, []string{"a", "b"}) {
+			t.Errorf("unexpected labels from config file: %v", cfg.PRLabels)
+		}
+	})
+
+	t.Run("Config file from INPUT_CONFIG", func(t *testing.T) {
+		configFile := filepath.Join(t.TempDir(), "agentic-audits.yml")
+		os.WriteFile(configFile, []byte("dry-run: true\n"), 0644)
+		cfg, err := loadRunConfig(nil, envLookup(map[string]string{"INPUT_CONFIG": configFile}))
+		if err != nil || !cfg.DryRun {
+			t.Errorf("expected dry run from config file, got %+v (%v)", cfg, err)
+		}
+	})
+
+	t.Run("Unknown config key", func(t *testing.T) {
+		configFile := filepath.Join(t.TempDir(), "agentic-audits.yml")
+		os.WriteFile(configFile, []byte("modle: typo\n"), 0644)
+		if _, err := loadRunConfig([]string{"--config", configFile}, envLookup(nil)); err == nil || !strings.Contains(err.Error(), "modle") {
+			t.Errorf("expected unknown key error, got %v", err)
+		}
+	})
+
+	t.Run("PR mode", func(t *testing.T) {
+		if _, err := loadRunConfig([]string{"--pr-mode=stacked"}, envLookup(nil)); err == nil {
+			t.Error("expected error for unknown PR mode")
+		}
+		cfg, err := loadRunConfig(nil, envLookup(map[string]string{"INPUT_PR_MODE": "per-mission"}))
+		if err != nil || cfg.PRMode != "per-mission" || len(cfg.Plan) != 1 || cfg.Plan[0] != cfg {
+			t.Errorf("unexpected config %+v (%v)", cfg, err)
+		}
+	})
+
+	t.Run("Stray positional arguments", func(t *testing.T) {
+		_, err := loadRunConfig([]string{"--dry-run", "true"}, envLookup(nil))
+		if err == nil || !strings.Contains(err.Error(), "--flag=value") {
+			t.Errorf("expected positional argument error, got %v", err)
+		}
+		cfg, err := loadRunConfig([]string{"--dry-run=false"}, envLookup(map[string]string{"INPUT_DRY_RUN": "true"}))
+		if err != nil || cfg.DryRun {
+			t.Errorf("explicit --dry-run=false should win over INPUT_DRY_RUN, got %+v (%v)", cfg, err)
+		}
+	})
+}
@@ -0,0 +1,83 @@
+#!/bin/bash
+# fetch-binary.sh: Resolve the agentic-audits binary used by action.yml
+#
+# Downloads the prebuilt release binary for the runner's architecture and
+# verifies it against the release's checksums.txt. A floating major tag (v1)
+# uses the newest vX.Y.Z release of that major. Refs without a release
+# (branches, SHAs, local `uses: ./`) fall back to building from source.
+# Prints the path of the binary on stdout; progress goes to stderr.
+
+set -euo pipefail
+
+if [ $# -lt 1 ]; then
+    echo "Usage: $0 <action_path> [ref] [repository]" >&2
+    exit 1
+fi
+
+ACTION_PATH=$1
+REF=${2:-}
+REPOSITORY=${3:-petermefrandsen/agentic-audits}
+BINARY_NAME=agentic-audits
+BIN_DIR="${RUNNER_TEMP:-/tmp}/agentic-audits-bin"
+
+mkdir -p "$BIN_DIR"
+
+build_from_source() {
+    echo "Building $BINARY_NAME from source..." >&2
+    (cd "$ACTION_PATH" && go build -ldflags "-X main.version=${REF:-dev}" -o "$BIN_DIR/$BINARY_NAME" ./src) >&2
+    echo "$BIN_DIR/$BINARY_NAME"
+}
+
+# resolve_major prints the newest vX.Y.Z release of major version $1.
+resolve_major() {
+    local auth=()
+    if [ -n "${GITHUB_TOKEN:-}" ]; then
+        auth=(-H "Authorization: Bearer $GITHUB_TOKEN")
+    fi
+    curl -fsSL "${auth[@]}" "${GITHUB_API_URL:-https://api.github.com}/repos/$REPOSITORY/releases?per_page=100" \
+        | grep -o '"tag_name": *"[^"]*"' \
+        | sed 's/.*"\([^"]*\)"$/\1/' \
+        | grep -E "^$1\.[0-9]+\.[0-9]+\$" \
+        | sort -V | tail -n 1
+}
+
+RELEASE=$REF
+if [[ "$REF" =~ ^v[0-9]+$ ]]; then
+    RELEASE=$(resolve_major "$REF" || true)
+    if [ -n "$RELEASE" ]; then
+        echo "Resolved $REF to release $RELEASE" >&2
+    fi
+fi
+
+case "$(uname -m)" in
+    x86_64|amd64) ARCH=amd64 ;;
+    aarch64|arm64) ARCH=arm64 ;;
+    *) ARCH="" ;;
+esac
+
+# Only release tags (vX.Y.Z) have prebuilt assets.
+if [[ "$(uname -s)" != "Linux" || -z "$ARCH" || ! "$RELEASE" =~ ^v[0-9]+\.[0-9]+\.[0-9]+$ ]]; then
+    build_from_source
+    exit 0
+fi
+
+ASSET="${BINARY_NAME}_linux_${ARCH}"
+BASE_URL="${GITHUB_SERVER_URL:-https://github.com}/$REPOSITORY/releases/download/$RELEASE"
+
+if ! curl -fsSL -o "$BIN_DIR/$ASSET" "$BASE_URL/$ASSET" || \
+   ! curl -fsSL -o "$BIN_DIR/checksums.txt" "$BASE_URL/checksums.txt"; then
+    echo "::warning::No prebuilt $ASSET for $RELEASE; building from source." >&2
+    build_from_source
+    exit 0
+fi
+
+# A binary that fails verification is never used, and never silently rebuilt.
+if ! (cd "$BIN_DIR" && grep " ${ASSET}\$" checksums.txt | sha256sum -c --quiet - >&2); then
+    echo "::error::Checksum verification failed for $ASSET ($RELEASE)" >&2
+    exit 1
+fi
+
+chmod +x "$BIN_DIR/$ASSET"
+mv "$BIN_DIR/$ASSET" "$BIN_DIR/$BINARY_NAME"
+echo "Using prebuilt $ASSET ($RELEASE)" >&2
+echo "$BIN_DIR/$BINARY_NAME"
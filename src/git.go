@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// GitSnapshot records the working-tree state before the mission runs. Tree
+// is a tree object of the whole working tree, untracked files included, so
+// later snapshots can be diffed against it without touching the index.
+type GitSnapshot struct {
+	Head  string
+	Dirty bool
+	Tree  string
+}
+
+// GitChanges describes what the mission changed relative to the snapshot.
+type GitChanges struct {
+	Files    []string
+	DiffStat string
+	Diff     string
+	// Before and After are the snapshot trees the changes were diffed
+	// between; both are empty for changes collected against HEAD.
+	Before string
+	After  string
+}
+
+func (c GitChanges) Empty() bool {
+	return len(c.Files) == 0
+}
+
+func gitOutput(executor CommandExecutor, args ...string) (string, error) {
+	return gitOutputEnv(executor, os.Environ(), args...)
+}
+
+func gitOutputEnv(executor CommandExecutor, env []string, args ...string) (string, error) {
+	var out bytes.Buffer
+	if err := executor.RunCommand("git", args, env, &out, io.Discard); err != nil {
+		return "", fmt.Errorf("git %s failed: %w", strings.Join(args, " "), err)
+	}
+	return out.String(), nil
+}
+
+func captureGitSnapshot(executor CommandExecutor) (GitSnapshot, error) {
+	head, err := gitOutput(executor, "rev-parse", "HEAD")
+	if err != nil {
+		return GitSnapshot{}, err
+	}
+	status, err := gitOutput(executor, "status", "--porcelain", "--untracked-files=all")
+	if err != nil {
+		return GitSnapshot{}, err
+	}
+	tree, err := captureWorkingTree(executor)
+	if err != nil {
+		return GitSnapshot{}, err
+	}
+	return GitSnapshot{
+		Head:  strings.TrimSpace(head),
+		Dirty: strings.TrimSpace(status) != "",
+		Tree:  tree,
+	}, nil
+}
+
+// captureWorkingTree writes the working tree to a tree object through a
+// throwaway index, leaving the real index and working tree untouched.
+func captureWorkingTree(executor CommandExecutor) (string, error) {
+	index, err := os.CreateTemp("", "agentic-audits-index")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary index: %w", err)
+	}
+	index.Close()
+	os.Remove(index.Name())
+	defer os.Remove(index.Name())
+
+	env := append(os.Environ(), "GIT_INDEX_FILE="+index.Name())
+	// An unborn HEAD has nothing to seed the index with; add -A still works.
+	gitOutputEnv(executor, env, "read-tree", "HEAD")
+	if _, err := gitOutputEnv(executor, env, "add", "-A"); err != nil {
+		return "", err
+	}
+	tree, err := gitOutputEnv(executor, env, "write-tree")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(tree), nil
+}
+
+// diffSnapshots describes what changed between two snapshots, which isolates
+// one mission's changes when several run in the same checkout.
+func diffSnapshots(executor CommandExecutor, before, after GitSnapshot) (GitChanges, error) {
+	if before.Tree == "" || after.Tree == "" {
+		return GitChanges{}, fmt.Errorf("snapshot has no working tree")
+	}
+
+	names, err := gitOutput(executor, "diff", "--name-only", before.Tree, after.Tree)
+	if err != nil {
+		return GitChanges{}, err
+	}
+	var files []string
+	for _, line := range strings.Split(names, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			files = append(files, line)
+		}
+	}
+	sort.Strings(files)
+
+	changes := GitChanges{Files: files, Before: before.Tree, After: after.Tree}
+	if changes.Empty() {
+		return changes, nil
+	}
+	stat, err := gitOutput(executor, "diff", "--stat", before.Tree, after.Tree)
+	if err != nil {
+		return GitChanges{}, err
+	}
+	diff, err := gitOutput(executor, "diff", before.Tree, after.Tree)
+	if err != nil {
+		return GitChanges{}, err
+	}
+	changes.DiffStat = strings.TrimRight(stat, "\n")
+	changes.Diff = diff
+	return changes, nil
+}
+
+// setAsideChanges saves changes as a patch at path and reverts them in the
+// working tree. Changes made before them, e.g. by earlier missions, stay.
+func setAsideChanges(executor CommandExecutor, changes GitChanges, path string) error {
+	if changes.Before == "" || changes.After == "" {
+		return fmt.Errorf("the changes were not captured as working-tree snapshots")
+	}
+	patch, err := gitOutput(executor, "diff", "--binary", changes.Before, changes.After)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(patch), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	_, err = gitOutput(executor, "apply", "-R", path)
+	return err
+}
+
+// collectGitChanges compares the working tree (including any commits the agent
+// made) against the snapshot HEAD. Untracked files are listed but not diffed.
+func collectGitChanges(executor CommandExecutor, before GitSnapshot) (GitChanges, error) {
+	base := before.Head
+	if base == "" {
+		base = "HEAD"
+	}
+
+	tracked, err := gitOutput(executor, "diff", "--name-only", base)
+	if err != nil {
+		return GitChanges{}, err
+	}
+	untracked, err := gitOutput(executor, "ls-files", "--others", "--exclude-standard")
+	if err != nil {
+		return GitChanges{}, err
+	}
+
+	seen := make(map[string]bool)
+	var files []string
+	for _, line := range strings.Split(tracked+"\n"+untracked, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !seen[line] {
+			seen[line] = true
+			files = append(files, line)
+		}
+	}
+	sort.Strings(files)
+
+	changes := GitChanges{Files: files}
+	if changes.Empty() {
+		return changes, nil
+	}
+
+	stat, err := gitOutput(executor, "diff", "--stat", base)
+	if err != nil {
+		return GitChanges{}, err
+	}
+	diff, err := gitOutput(executor, "diff", base)
+	if err != nil {
+		return GitChanges{}, err
+	}
+	changes.DiffStat = strings.TrimRight(stat, "\n")
+	changes.Diff = diff
+	return changes, nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func gitMock(outputs map[string]string, failOn string) *MockCommandExecutor {
+	return &MockCommandExecutor{
+		RunFunc: func(name string, args []string, env []string, stdout, stderr io.Writer) error {
+			key := strings.Join(args, " ")
+			if failOn != "" && strings.HasPrefix(key, failOn) {
+				return fmt.Errorf("git failed")
+			}
+			fmt.Fprint(stdout, outputs[key])
+			return nil
+		},
+	}
+}
+
+func TestCaptureGitSnapshot(t *testing.T) {
+	t.Run("Clean", func(t *testing.T) {
+		snap, err := captureGitSnapshot(gitMock(map[string]string{"rev-parse HEAD": "abc123\n"}, ""))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if snap.Head != "abc123" || snap.Dirty {
+			t.Errorf("unexpected snapshot: %+v", snap)
+		}
+	})
+
+	t.Run("Dirty", func(t *testing.T) {
+		snap, err := captureGitSnapshot(gitMock(map[string]string{
+			"rev-parse HEAD": "abc123\n",
+			"status --porcelain --untracked-files=all": " M README.md\n",
+		}, ""))
+		if err != nil || !snap.Dirty {
+			t.Errorf("expected dirty snapshot, got %+v (%v)", snap, err)
+		}
+	})
+
+	t.Run("Not a repository", func(t *testing.T) {
+		if _, err := captureGitSnapshot(gitMock(nil, "rev-parse")); err == nil {
+			t.Error("expected error outside a git repository")
+		}
+	})
+}
+
+func TestCollectGitChanges(t *testing.T) {
+	t.Run("Changes", func(t *testing.T) {
+		changes, err := collectGitChanges(gitMock(map[string]string{
+			"diff --name-only abc":                 "b.md\na.md\n",
+			"ls-files --others --exclude-standard": "new.md\na.md\n",
+			"diff --stat abc":                      " 2 files changed\n",
+			"diff abc":                             "diff --git a/a.md b/a.md\n",
+		}, ""), GitSnapshot{Head: "abc"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if strings.Join(changes.Files, ",") != "a.md,b.md,new.md" {
+			t.Errorf("unexpected files: %v", changes.Files)
+		}
+		if changes.DiffStat != " 2 files changed" || !strings.Contains(changes.Diff, "diff --git") {
+			t.Errorf("unexpected diff data: %+v", changes)
+		}
+	})
+
+	t.Run("No changes", func(t *testing.T) {
+		changes, err := collectGitChanges(gitMock(nil, ""), GitSnapshot{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !changes.Empty() {
+			t.Errorf("expected no changes, got %v", changes.Files)
+		}
+	})
+
+	t.Run("Diff fails", func(t *testing.T) {
+		if _, err := collectGitChanges(gitMock(nil, "diff"), GitSnapshot{Head: "abc"}); err == nil {
+			t.Error("expected error when git diff fails")
+		}
+	})
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	t.Run("Changes between trees", func(t *testing.T) {
+		changes, err := diffSnapshots(gitMock(map[string]string{
+			"diff --name-only t1 t2": "b.md\na.md\n",
+			"diff --stat t1 t2":      " 2 files changed\n",
+		}, ""), GitSnapshot{Tree: "t1"}, GitSnapshot{Tree: "t2"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if strings.Join(changes.Files, ",") != "a.md,b.md" || changes.DiffStat != " 2 files changed" {
+			t.Errorf("unexpected changes: %+v", changes)
+		}
+	})
+
+	t.Run("Missing tree", func(t *testing.T) {
+		if _, err := diffSnapshots(gitMock(nil, ""), GitSnapshot{}, GitSnapshot{Tree: "t2"}); err == nil {
+			t.Error("expected error without a tree")
+		}
+	})
+}
+
+func TestSetAsideChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.patch")
+	executor := gitMock(map[string]string{"diff --binary t1 t2": "diff --git a/a.md b/a.md\n"}, "")
+	if err := setAsideChanges(executor, GitChanges{Files: []string{"a.md"}, Before: "t1", After: "t2"}, path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "diff --git a/a.md b/a.md\n" {
+		t.Errorf("the patch should be saved, got %q", data)
+	}
+
+	if err := setAsideChanges(gitMock(nil, "apply"), GitChanges{Before: "t1", After: "t2"}, path); err == nil {
+		t.Error("expected error when the patch cannot be reverted")
+	}
+	if err := setAsideChanges(gitMock(nil, ""), GitChanges{Files: []string{"a.md"}}, path); err == nil {
+		t.Error("expected error without snapshot trees")
+	}
+}
+
+func TestCaptureWorkingTreeUsesTemporaryIndex(t *testing.T) {
+	var indexEnv []string
+	executor := &MockCommandExecutor{
+		RunFunc: func(name string, args []string, env []string, stdout, stderr io.Writer) error {
+			for _, kv := range env {
+				if strings.HasPrefix(kv, "GIT_INDEX_FILE=") {
+					indexEnv = append(indexEnv, kv)
+				}
+			}
+			if args[0] == "write-tree" {
+				fmt.Fprintln(stdout, "abc123")
+			}
+			return nil
+		},
+	}
+	tree, err := captureWorkingTree(executor)
+	if err != nil || tree != "abc123" {
+		t.Fatalf("expected tree abc123, got %q (%v)", tree, err)
+	}
+	if len(indexEnv) != 3 {
+		t.Errorf("every git call should use the temporary index, got %v", indexEnv)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// GitHubAppConfig describes a GitHub App installation to authenticate as.
+// PrivateKey is either the PEM itself or a path to a PEM file.
+type GitHubAppConfig struct {
+	AppID          string
+	PrivateKey     string
+	InstallationID string
+	Owner          string
+}
+
+func (c GitHubAppConfig) Enabled() bool {
+	return c.AppID != ""
+}
+
+// InstallationToken is an installation token and when it expires.
+type InstallationToken struct {
+	Token     string
+	ExpiresAt time.Time
+}
+
+// appTokenRefreshMargin is how long before it expires a token is re-minted.
+const appTokenRefreshMargin = 5 * time.Minute
+
+// appTokenSource hands out the installation token, minting a new one once it
+// is about to expire: tokens last an hour, and long runs only push and open
+// the PR at the end.
+type appTokenSource struct {
+	Client  HTTPClient
+	Host    GitHubHost
+	App     GitHubAppConfig
+	Current InstallationToken
+}
+
+func (s *appTokenSource) Token(now time.Time) (string, error) {
+	if now.Add(appTokenRefreshMargin).Before(s.Current.ExpiresAt) {
+		return s.Current.Token, nil
+	}
+	logInfo("GitHub App installation token expires at %s; minting a new one.", s.Current.ExpiresAt.Format(time.RFC3339))
+	token, err := fetchInstallationToken(s.Client, s.Host, s.App, now)
+	if err != nil {
+		return "", fmt.Errorf("failed to refresh the GitHub App installation token: %w", err)
+	}
+	s.Current = token
+	return token.Token, nil
+}
+
+func parseAppPrivateKey(pemOrPath string) (*rsa.PrivateKey, error) {
+	data := []byte(pemOrPath)
+	if !strings.Contains(pemOrPath, "-----BEGIN") {
+		fileData, err := os.ReadFile(pemOrPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read app private key: %w", err)
+		}
+		data = fileData
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("app private key is not valid PEM")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse app private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("app private key must be an RSA key")
+	}
+	return key, nil
+}
+
+// mintAppJWT creates the short-lived RS256 JWT GitHub expects from an App.
+// iat is backdated a minute to allow for clock drift.
+func mintAppJWT(appID string, key *rsa.PrivateKey, now time.Time) (string, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	payload, _ := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": appID,
+	})
+
+	enc := base64.RawURLEncoding
+	signingInput := enc.EncodeToString(header) + "." + enc.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign app JWT: %w", err)
+	}
+	return signingInput + "." + enc.EncodeToString(signature), nil
+}
+
+// fetchInstallationToken exchanges an App JWT for an installation token. When
+// no installation ID is given it is looked up from the owner (org, then user).
+// A response without expires_at is given the documented one-hour lifetime.
+func fetchInstallationToken(client HTTPClient, host GitHubHost, cfg GitHubAppConfig, now time.Time) (InstallationToken, error) {
+	key, err := parseAppPrivateKey(cfg.PrivateKey)
+	if err != nil {
+		return InstallationToken{}, err
+	}
+	jwt, err := mintAppJWT(cfg.AppID, key, now)
+	if err != nil {
+		return InstallationToken{}, err
+	}
+
+	installationID := cfg.InstallationID
+	if installationID == "" {
+		if cfg.Owner == "" {
+			return InstallationToken{}, fmt.Errorf("GitHub App auth needs an installation ID or owner")
+		}
+		installationID, err = lookupInstallationID(client, host, jwt, cfg.Owner)
+		if err != nil {
+			return InstallationToken{}, err
+		}
+	}
+
+	var result struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	path := "/app/installations/" + installationID + "/access_tokens"
+	if err := appRequest(client, host, jwt, "POST", path, http.StatusCreated, &result); err != nil {
+		return InstallationToken{}, fmt.Errorf("failed to create installation token: %w", err)
+	}
+	if result.Token == "" {
+		return InstallationToken{}, fmt.Errorf("installation token response did not contain a token")
+	}
+	if result.ExpiresAt.IsZero() {
+		result.ExpiresAt = now.Add(time.Hour)
+	}
+
+	maskSecret(result.Token)
+	logInfo("Authenticated as GitHub App %s (installation %s).", cfg.AppID, installationID)
+	return InstallationToken{Token: result.Token, ExpiresAt: result.ExpiresAt}, nil
+}
+
+// appGitIdentity is the App's bot account, so commits pushed with its
+// installation token are attributed to the App.
+func appGitIdentity(client HTTPClient, host GitHubHost, cfg GitHubAppConfig, token string, now time.Time) (GitIdentity, error) {
+	key, err := parseAppPrivateKey(cfg.PrivateKey)
+	if err != nil {
+		return GitIdentity{}, err
+	}
+	jwt, err := mintAppJWT(cfg.AppID, key, now)
+	if err != nil {
+		return GitIdentity{}, err
+	}
+	var app struct {
+		Slug string `json:"slug"`
+	}
+	if err := appRequest(client, host, jwt, "GET", "/app", http.StatusOK, &app); err != nil {
+		return GitIdentity{}, err
+	}
+
+	login := app.Slug + "[bot]"
+	resp, err := githubGet(client, host, token, "/users/"+url.PathEscape(login))
+	if err != nil {
+		return GitIdentity{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return GitIdentity{}, fmt.Errorf("GET /users/%s returned HTTP %d", login, resp.StatusCode)
+	}
+	var user struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return GitIdentity{}, fmt.Errorf("failed to decode %s: %w", login, err)
+	}
+
+	noreply := "users.noreply.github.com"
+	if !host.IsDotCom() {
+		noreply = "users.noreply." + host.Name
+	}
+	return GitIdentity{Name: login, Email: fmt.Sprintf("%d+%s@%s", user.ID, login, noreply)}, nil
+}
+
+func lookupInstallationID(client HTTPClient, host GitHubHost, jwt, owner string) (string, error) {
+	var installation struct {
+		ID int64 `json:"id"`
+	}
+	orgErr := appRequest(client, host, jwt, "GET", "/orgs/"+owner+"/installation", http.StatusOK, &installation)
+	if orgErr != nil {
+		if err := appRequest(client, host, jwt, "GET", "/users/"+owner+"/installation", http.StatusOK, &installation); err != nil {
+			return "", fmt.Errorf("GitHub App is not installed for %s: %w", owner, err)
+		}
+	}
+	return fmt.Sprintf("%d", installation.ID), nil
+}
+
+func appRequest(client HTTPClient, host GitHubHost, jwt, method, path string, wantStatus int, out interface{}) error {
+	req, err := http.NewRequest(method, host.APIURL+path, bytes.NewReader(nil))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != wantStatus {
+		return fmt.Errorf("%s %s returned HTTP %d", method, path, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
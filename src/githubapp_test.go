@@ -0,0 +1,210 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testAppKey(t *testing.T) (*rsa.PrivateKey, string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return key, string(pemData)
+}
+
+func TestParseAppPrivateKey(t *testing.T) {
+	_, pemData := testAppKey(t)
+
+	t.Run("Inline PEM", func(t *testing.T) {
+		if _, err := parseAppPrivateKey(pemData); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("Path", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "app.pem")
+		os.WriteFile(path, []byte(pemData), 0600)
+		if _, err := parseAppPrivateKey(path); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		if _, err := parseAppPrivateKey("-----BEGIN nonsense"); err == nil {
+			t.Error("expected error for invalid PEM")
+		}
+	})
+}
+
+func TestMintAppJWT(t *testing.T) {
+	key, _ := testAppKey(t)
+	now := time.Unix(1700000000, 0)
+
+	jwt, err := mintAppJWT("123", key, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		t.Fatalf("expected 3 JWT parts, got %d", len(parts))
+	}
+
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	var claims map[string]interface{}
+	json.Unmarshal(payload, &claims)
+	if claims["iss"] != "123" || claims["iat"].(float64) != float64(now.Unix()-60) || claims["exp"].(float64) != float64(now.Unix()+540) {
+		t.Errorf("unexpected claims: %v", claims)
+	}
+
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+		t.Errorf("JWT signature does not verify: %v", err)
+	}
+}
+
+func TestFetchInstallationToken(t *testing.T) {
+	_, pemData := testAppKey(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /orgs/acme/installation":
+			w.Write([]byte(`{"id": 42}`))
+		case "GET /orgs/octocat/installation":
+			w.WriteHeader(http.StatusNotFound)
+		case "GET /users/octocat/installation":
+			w.Write([]byte(`{"id": 7}`))
+		case "POST /app/installations/42/access_tokens":
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"token": "ghs_org"}`))
+		case "POST /app/installations/7/access_tokens":
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"token": "ghs_user"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	host := GitHubHost{Name: "github.com", APIURL: server.URL}
+	now := time.Now()
+
+	tests := []struct {
+		name string
+		cfg  GitHubAppConfig
+		want string
+	}{
+		{"Installation ID", GitHubAppConfig{AppID: "1", PrivateKey: pemData, InstallationID: "42"}, "ghs_org"},
+		{"Org owner", GitHubAppConfig{AppID: "1", PrivateKey: pemData, Owner: "acme"}, "ghs_org"},
+		{"User owner", GitHubAppConfig{AppID: "1", PrivateKey: pemData, Owner: "octocat"}, "ghs_user"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := fetchInstallationToken(server.Client(), host, tt.cfg, now)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if token.Token != tt.want || !token.ExpiresAt.Equal(now.Add(time.Hour)) {
+				t.Errorf("got token %+v, want %q expiring in an hour", token, tt.want)
+			}
+		})
+	}
+
+	t.Run("Not installed", func(t *testing.T) {
+		_, err := fetchInstallationToken(server.Client(), host, GitHubAppConfig{AppID: "1", PrivateKey: pemData, Owner: "nobody"}, now)
+		if err == nil || !strings.Contains(err.Error(), "not installed") {
+			t.Errorf("expected not installed error, got %v", err)
+		}
+	})
+
+	t.Run("No installation or owner", func(t *testing.T) {
+		if _, err := fetchInstallationToken(server.Client(), host, GitHubAppConfig{AppID: "1", PrivateKey: pemData}, now); err == nil {
+			t.Error("expected error without installation ID or owner")
+		}
+	})
+}
+
+func TestAppGitIdentity(t *testing.T) {
+	_, pemData := testAppKey(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/app" && strings.HasPrefix(r.Header.Get("Authorization"), "Bearer "):
+			w.Write([]byte(`{"slug": "audit-bot"}`))
+		case r.URL.Path == "/users/audit-bot[bot]" && r.Header.Get("Authorization") == "token ghs_x":
+			w.Write([]byte(`{"id": 99}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	cfg := GitHubAppConfig{AppID: "1", PrivateKey: pemData}
+
+	identity, err := appGitIdentity(server.Client(), GitHubHost{Name: "github.com", APIURL: server.URL}, cfg, "ghs_x", time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if identity.Name != "audit-bot[bot]" || identity.Email != "99+audit-bot[bot]@users.noreply.github.com" {
+		t.Errorf("unexpected identity: %+v", identity)
+	}
+
+	identity, err = appGitIdentity(server.Client(), GitHubHost{Name: "ghe.example.com", APIURL: server.URL}, cfg, "ghs_x", time.Now())
+	if err != nil || identity.Email != "99+audit-bot[bot]@users.noreply.ghe.example.com" {
+		t.Errorf("unexpected enterprise identity: %+v (%v)", identity, err)
+	}
+}
+
+func TestAppTokenSource(t *testing.T) {
+	_, pemData := testAppKey(t)
+	mints := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method+" "+r.URL.Path != "POST /app/installations/42/access_tokens" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		mints++
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token": "ghs_fresh%d", "expires_at": "2026-01-01T13:00:00Z"}`, mints)
+	}))
+	defer server.Close()
+
+	source := &appTokenSource{
+		Client:  server.Client(),
+		Host:    GitHubHost{Name: "github.com", APIURL: server.URL},
+		App:     GitHubAppConfig{AppID: "1", PrivateKey: pemData, InstallationID: "42"},
+		Current: InstallationToken{Token: "ghs_old", ExpiresAt: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)},
+	}
+
+	if token, err := source.Token(time.Date(2026, 1, 1, 11, 30, 0, 0, time.UTC)); err != nil || token != "ghs_old" || mints != 0 {
+		t.Errorf("a token with half an hour left should be reused, got %q (%v, %d mints)", token, err, mints)
+	}
+	if token, err := source.Token(time.Date(2026, 1, 1, 11, 57, 0, 0, time.UTC)); err != nil || token != "ghs_fresh1" {
+		t.Errorf("a token about to expire should be re-minted, got %q (%v)", token, err)
+	}
+	if token, err := source.Token(time.Date(2026, 1, 1, 12, 30, 0, 0, time.UTC)); err != nil || token != "ghs_fresh1" || mints != 1 {
+		t.Errorf("the fresh token should be reused, got %q (%v, %d mints)", token, err, mints)
+	}
+	if token, err := source.Token(time.Date(2026, 1, 1, 14, 0, 0, 0, time.UTC)); err != nil || token != "ghs_fresh2" {
+		t.Errorf("an expired token should be re-minted, got %q (%v)", token, err)
+	}
+}
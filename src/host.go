@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// GitHubHost identifies the GitHub instance the action talks to: github.com,
+// a GitHub Enterprise Server, or a GHE.com data-residency tenant.
+type GitHubHost struct {
+	Name   string
+	WebURL string
+	APIURL string
+}
+
+func (h GitHubHost) IsDotCom() bool {
+	return h.Name == "github.com"
+}
+
+// resolveGitHubHost picks the host from the flag, then GITHUB_SERVER_URL, then
+// github.com. GITHUB_API_URL is honoured when it belongs to the same host.
+func resolveGitHubHost(flagValue string) (GitHubHost, error) {
+	serverURL := os.Getenv("GITHUB_SERVER_URL")
+	value := flagValue
+	if value == "" {
+		value = serverURL
+	}
+	if value == "" {
+		value = "github.com"
+	}
+
+	name, err := parseHostName(value)
+	if err != nil {
+		return GitHubHost{}, err
+	}
+
+	host := GitHubHost{
+		Name:   name,
+		WebURL: "https://" + name,
+		APIURL: defaultAPIURL(name),
+	}
+
+	if apiURL := os.Getenv("GITHUB_API_URL"); apiURL != "" {
+		if serverName, err := parseHostName(serverURL); err == nil && serverName == name {
+			host.APIURL = strings.TrimSuffix(apiURL, "/")
+		}
+	}
+	return host, nil
+}
+
+func parseHostName(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if !strings.Contains(value, "://") {
+		value = "https://" + value
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid GitHub host %q", value)
+	}
+	return strings.ToLower(u.Host), nil
+}
+
+func defaultAPIURL(name string) string {
+	switch {
+	case name == "github.com":
+		return "https://api.github.com"
+	case strings.HasSuffix(name, ".ghe.com"):
+		return "https://api." + name
+	default:
+		return "https://" + name + "/api/v3"
+	}
+}
+
+// QualifiedRepo prefixes owner/repo with the host for gh's --repo flag on non-dotcom hosts.
+func (h GitHubHost) QualifiedRepo(repo string) string {
+	if repo == "" || h.IsDotCom() {
+		return repo
+	}
+	return h.Name + "/" + repo
+}
@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestResolveGitHubHost(t *testing.T) {
+	tests := []struct {
+		name      string
+		flag      string
+		serverURL string
+		apiURL    string
+		wantName  string
+		wantAPI   string
+	}{
+		{"Default", "", "", "", "github.com", "https://api.github.com"},
+		{"Actions on dotcom", "", "https://github.com", "https://api.github.com", "github.com", "https://api.github.com"},
+		{"GHES from env", "", "https://ghe.example.com", "https://ghe.example.com/api/v3", "ghe.example.com", "https://ghe.example.com/api/v3"},
+		{"GHES from flag", "ghe.example.com", "", "", "ghe.example.com", "https://ghe.example.com/api/v3"},
+		{"Data residency", "https://octo.ghe.com/", "", "", "octo.ghe.com", "https://api.octo.ghe.com"},
+		{"Flag overrides env", "ghe.example.com", "https://github.com", "https://api.github.com", "ghe.example.com", "https://ghe.example.com/api/v3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GITHUB_SERVER_URL", tt.serverURL)
+			t.Setenv("GITHUB_API_URL", tt.apiURL)
+
+			host, err := resolveGitHubHost(tt.flag)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if host.Name != tt.wantName || host.APIURL != tt.wantAPI {
+				t.Errorf("got %s (%s), want %s (%s)", host.Name, host.APIURL, tt.wantName, tt.wantAPI)
+			}
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		if _, err := resolveGitHubHost("https://"); err == nil {
+			t.Error("expected error for invalid host")
+		}
+	})
+}
+
+func TestQualifiedRepo(t *testing.T) {
+	if got := (GitHubHost{Name: "github.com"}).QualifiedRepo("o/r"); got != "o/r" {
+		t.Errorf("dotcom repo should not be qualified, got %s", got)
+	}
+	if got := (GitHubHost{Name: "ghe.example.com"}).QualifiedRepo("o/r"); got != "ghe.example.com/o/r" {
+		t.Errorf("unexpected qualified repo: %s", got)
+	}
+}
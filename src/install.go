@@ -0,0 +1,251 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// InstallStrategy is one way of getting the gh CLI onto the runner.
+type InstallStrategy interface {
+	Name() string
+	Install(executor CommandExecutor) error
+}
+
+type InstallOptions struct {
+	Mode       string // auto, apt, tarball or skip
+	MinVersion string
+	Tarball    string // local .tar.gz, cache directory or URL
+	SHA256     string
+	BinDir     string
+}
+
+// aptInstaller is the Debian path using cli.github.com (needs sudo and network).
+type aptInstaller struct{}
+
+func (aptInstaller) Name() string { return "apt" }
+
+func (aptInstaller) Install(executor CommandExecutor) error {
+	return installGitHubCLI(executor)
+}
+
+// existingInstaller accepts a gh that is already on PATH at MinVersion or newer.
+type existingInstaller struct {
+	MinVersion string
+}
+
+func (existingInstaller) Name() string { return "existing" }
+
+func (s existingInstaller) Install(executor CommandExecutor) error {
+	version, err := detectGhVersion(executor)
+	if err != nil {
+		return err
+	}
+	if compareVersions(version, s.MinVersion) < 0 {
+		return fmt.Errorf("gh %s is older than the required %s", version, s.MinVersion)
+	}
+	logInfo("Using existing gh %s", version)
+	return nil
+}
+
+// tarballInstaller unpacks an official gh release archive into BinDir without
+// sudo. The archive can come from a local file, a cache directory holding
+// gh_*_linux_<arch>.tar.gz (the one matching SHA256 is used), or a URL; it is
+// always checked against SHA256.
+type tarballInstaller struct {
+	Source string
+	SHA256 string
+	BinDir string
+}
+
+func (tarballInstaller) Name() string { return "tarball" }
+
+func (s tarballInstaller) Install(executor CommandExecutor) error {
+	defer logGroup("Installing GitHub CLI from tarball")()
+
+	if s.SHA256 == "" {
+		return fmt.Errorf("a SHA-256 checksum is required to install gh from %s", s.Source)
+	}
+
+	archive, err := s.resolveArchive(executor)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(archive)
+	if err != nil {
+		return fmt.Errorf("failed to read gh archive: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); !strings.EqualFold(got, s.SHA256) {
+		return fmt.Errorf("checksum mismatch for %s: got %s, want %s", archive, got, s.SHA256)
+	}
+
+	if err := os.MkdirAll(s.BinDir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", s.BinDir, err)
+	}
+	if err := extractGhBinary(data, filepath.Join(s.BinDir, "gh")); err != nil {
+		return err
+	}
+
+	prependPath(s.BinDir)
+	logInfo("Installed gh to %s", s.BinDir)
+	return nil
+}
+
+func (s tarballInstaller) resolveArchive(executor CommandExecutor) (string, error) {
+	if strings.HasPrefix(s.Source, "https://") || strings.HasPrefix(s.Source, "http://") {
+		dest := filepath.Join(ciProvider.TempDir(), path.Base(s.Source))
+		if err := executor.RunCommand("curl", []string{"-fsSL", "-o", dest, s.Source}, os.Environ(), os.Stdout, os.Stderr); err != nil {
+			return "", fmt.Errorf("failed to download %s: %w", s.Source, err)
+		}
+		return dest, nil
+	}
+
+	info, err := os.Stat(s.Source)
+	if err != nil {
+		return "", fmt.Errorf("gh archive not found: %w", err)
+	}
+	if !info.IsDir() {
+		return s.Source, nil
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(s.Source, fmt.Sprintf("gh_*_linux_%s.tar.gz", runtime.GOARCH)))
+	if len(matches) == 0 {
+		return "", fmt.Errorf("no gh_*_linux_%s.tar.gz in cache directory %s", runtime.GOARCH, s.Source)
+	}
+	for _, match := range matches {
+		data, err := os.ReadFile(match)
+		if err != nil {
+			continue
+		}
+		if sum := sha256.Sum256(data); strings.EqualFold(hex.EncodeToString(sum[:]), s.SHA256) {
+			return match, nil
+		}
+	}
+	return "", fmt.Errorf("none of the %d gh archives in cache directory %s has SHA-256 %s", len(matches), s.Source, s.SHA256)
+}
+
+func extractGhBinary(archive []byte, dest string) error {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return fmt.Errorf("gh archive is not gzip: %w", err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return fmt.Errorf("gh archive does not contain bin/gh")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read gh archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg || !strings.HasSuffix(hdr.Name, "/bin/gh") {
+			continue
+		}
+
+		f, err := os.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", dest, err)
+		}
+		defer f.Close()
+		if _, err := io.Copy(f, tr); err != nil {
+			return fmt.Errorf("failed to write %s: %w", dest, err)
+		}
+		return nil
+	}
+}
+
+// prependPath makes dir visible to this process, its children and later CI steps.
+func prependPath(dir string) {
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	if err := ciProvider.AddPath(dir); err != nil {
+		logWarn("Could not add %s to the PATH of later steps: %v", dir, err)
+	}
+}
+
+// skipInstaller leaves gh installation to the caller.
+type skipInstaller struct{}
+
+func (skipInstaller) Name() string { return "skip" }
+
+func (skipInstaller) Install(executor CommandExecutor) error { return nil }
+
+func selectInstallStrategy(executor CommandExecutor, opts InstallOptions) (InstallStrategy, error) {
+	tarball := tarballInstaller{Source: opts.Tarball, SHA256: opts.SHA256, BinDir: opts.BinDir}
+
+	switch opts.Mode {
+	case "apt":
+		return aptInstaller{}, nil
+	case "tarball":
+		if opts.Tarball == "" {
+			return nil, fmt.Errorf("gh install mode 'tarball' needs a tarball path, cache directory or URL")
+		}
+		return tarball, nil
+	case "skip":
+		return skipInstaller{}, nil
+	case "", "auto":
+		existing := existingInstaller{MinVersion: opts.MinVersion}
+		err := existing.Install(executor)
+		if err == nil {
+			return skipInstaller{}, nil
+		}
+		logInfo("No usable gh found: %v", err)
+		if opts.Tarball != "" {
+			return tarball, nil
+		}
+		if _, err := exec.LookPath("apt-get"); err == nil {
+			return aptInstaller{}, nil
+		}
+		return nil, fmt.Errorf("gh is not installed and neither a tarball nor apt-get is available")
+	default:
+		return nil, fmt.Errorf("unknown gh install mode %q (want auto, apt, tarball or skip)", opts.Mode)
+	}
+}
+
+var ghVersionPattern = regexp.MustCompile(`gh version (\d+(?:\.\d+)*)`)
+
+func detectGhVersion(executor CommandExecutor) (string, error) {
+	var out bytes.Buffer
+	if err := executor.RunCommand("gh", []string{"--version"}, os.Environ(), &out, io.Discard); err != nil {
+		return "", fmt.Errorf("gh is not available: %w", err)
+	}
+	match := ghVersionPattern.FindStringSubmatch(out.String())
+	if match == nil {
+		return "", fmt.Errorf("could not parse gh version from %q", strings.TrimSpace(out.String()))
+	}
+	return match[1], nil
+}
+
+// compareVersions compares dotted numeric versions, returning -1, 0 or 1.
+func compareVersions(a, b string) int {
+	as := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bs := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func ghVersionMock(output string) *MockCommandExecutor {
+	return &MockCommandExecutor{
+		RunFunc: func(name string, args []string, env []string, stdout, stderr io.Writer) error {
+			if output == "" {
+				return fmt.Errorf("executable file not found")
+			}
+			fmt.Fprint(stdout, output)
+			return nil
+		},
+	}
+}
+
+func buildGhTarball(t *testing.T) ([]byte, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	content := []byte("#!/bin/sh\necho gh\n")
+	tw.WriteHeader(&tar.Header{Name: "gh_2.50.0_linux_amd64/bin/gh", Mode: 0755, Size: int64(len(content)), Typeflag: tar.TypeReg})
+	tw.Write(content)
+	tw.Close()
+	gz.Close()
+
+	sum := sha256.Sum256(buf.Bytes())
+	return buf.Bytes(), hex.EncodeToString(sum[:])
+}
+
+func TestDetectGhVersion(t *testing.T) {
+	version, err := detectGhVersion(ghVersionMock("gh version 2.45.0 (2024-03-04)\nhttps://github.com/cli/cli/releases/tag/v2.45.0\n"))
+	if err != nil || version != "2.45.0" {
+		t.Errorf("expected 2.45.0, got %q (%v)", version, err)
+	}
+
+	if _, err := detectGhVersion(ghVersionMock("")); err == nil {
+		t.Error("expected error when gh is missing")
+	}
+	if _, err := detectGhVersion(ghVersionMock("something else")); err == nil {
+		t.Error("expected error for unparseable output")
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"2.40.0", "2.40.0", 0},
+		{"2.40.1", "2.40.0", 1},
+		{"2.9.0", "2.40.0", -1},
+		{"v3", "2.99.99", 1},
+		{"2.40", "2.40.0", 0},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSelectInstallStrategy(t *testing.T) {
+	t.Run("Existing gh is new enough", func(t *testing.T) {
+		s, err := selectInstallStrategy(ghVersionMock("gh version 2.50.0 (2024-05-01)"), InstallOptions{MinVersion: "2.40.0"})
+		if err != nil || s.Name() != "skip" {
+			t.Errorf("expected skip, got %v (%v)", s, err)
+		}
+	})
+
+	t.Run("Old gh falls back to tarball", func(t *testing.T) {
+		s, err := selectInstallStrategy(ghVersionMock("gh version 2.0.0 (2021-08-24)"), InstallOptions{MinVersion: "2.40.0", Tarball: "/cache"})
+		if err != nil || s.Name() != "tarball" {
+			t.Errorf("expected tarball, got %v (%v)", s, err)
+		}
+	})
+
+	t.Run("Explicit modes", func(t *testing.T) {
+		for mode, want := range map[string]string{"apt": "apt", "skip": "skip"} {
+			s, err := selectInstallStrategy(ghVersionMock(""), InstallOptions{Mode: mode})
+			if err != nil || s.Name() != want {
+				t.Errorf("mode %s: expected %s, got %v (%v)", mode, want, s, err)
+			}
+		}
+	})
+
+	t.Run("Tarball mode without source", func(t *testing.T) {
+		if _, err := selectInstallStrategy(ghVersionMock(""), InstallOptions{Mode: "tarball"}); err == nil {
+			t.Error("expected error without tarball source")
+		}
+	})
+
+	t.Run("Unknown mode", func(t *testing.T) {
+		if _, err := selectInstallStrategy(ghVersionMock(""), InstallOptions{Mode: "brew"}); err == nil {
+			t.Error("expected error for unknown mode")
+		}
+	})
+}
+
+func TestTarballInstaller(t *testing.T) {
+	archive, sum := buildGhTarball(t)
+	cacheDir := t.TempDir()
+	archivePath := filepath.Join(cacheDir, fmt.Sprintf("gh_2.50.0_linux_%s.tar.gz", runtime.GOARCH))
+	os.WriteFile(archivePath, archive, 0644)
+	t.Setenv("PATH", os.Getenv("PATH"))
+	t.Setenv("GITHUB_PATH", "")
+
+	t.Run("From cache directory", func(t *testing.T) {
+		binDir := t.TempDir()
+		err := tarballInstaller{Source: cacheDir, SHA256: sum, BinDir: binDir}.Install(ghVersionMock(""))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		info, err := os.Stat(filepath.Join(binDir, "gh"))
+		if err != nil || info.Mode().Perm()&0100 == 0 {
+			t.Errorf("expected executable gh in %s (%v)", binDir, err)
+		}
+		if filepath.SplitList(os.Getenv("PATH"))[0] != binDir {
+			t.Error("bin dir should be prepended to PATH")
+		}
+	})
+
+	t.Run("Cache directory with several versions", func(t *testing.T) {
+		dir := t.TempDir()
+		os.WriteFile(filepath.Join(dir, fmt.Sprintf("gh_2.10.0_linux_%s.tar.gz", runtime.GOARCH)), archive, 0644)
+		os.WriteFile(filepath.Join(dir, fmt.Sprintf("gh_2.9.0_linux_%s.tar.gz", runtime.GOARCH)), []byte("older"), 0644)
+		if err := (tarballInstaller{Source: dir, SHA256: sum, BinDir: t.TempDir()}).Install(ghVersionMock("")); err != nil {
+			t.Errorf("the archive matching the checksum should be used, got %v", err)
+		}
+		if err := (tarballInstaller{Source: dir, SHA256: "deadbeef", BinDir: t.TempDir()}).Install(ghVersionMock("")); err == nil || !strings.Contains(err.Error(), "none of the 2") {
+			t.Errorf("expected no matching archive error, got %v", err)
+		}
+	})
+
+	t.Run("Checksum mismatch", func(t *testing.T) {
+		err := tarballInstaller{Source: archivePath, SHA256: "deadbeef", BinDir: t.TempDir()}.Install(ghVersionMock(""))
+		if err == nil {
+			t.Error("expected checksum error")
+		}
+	})
+
+	t.Run("Checksum required", func(t *testing.T) {
+		err := tarballInstaller{Source: archivePath, BinDir: t.TempDir()}.Install(ghVersionMock(""))
+		if err == nil {
+			t.Error("expected error without checksum")
+		}
+	})
+
+	t.Run("Empty cache directory", func(t *testing.T) {
+		err := tarballInstaller{Source: t.TempDir(), SHA256: sum, BinDir: t.TempDir()}.Install(ghVersionMock(""))
+		if err == nil {
+			t.Error("expected error for empty cache directory")
+		}
+	})
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LevelNotice sits between info and warning; Actions shows it as a notice annotation.
+const LevelNotice = slog.Level(2)
+
+// Attributes with special meaning to the renderers.
+const (
+	groupAttr = "group" // "start" or "end" of a collapsible log group
+	maskAttr  = "mask"  // the message is a secret to hide in later output
+)
+
+var (
+	logLevel = new(slog.LevelVar)
+	logger   = newLogger(stdoutWriter{}, ciProvider.LogFormat(), logLevel)
+)
+
+// stdoutWriter writes to the current os.Stdout, so redirecting it also
+// redirects the log.
+type stdoutWriter struct{}
+
+func (stdoutWriter) Write(p []byte) (int, error) {
+	return os.Stdout.Write(p)
+}
+
+// newLogger renders records as JSON lines ("json") or in the dialect of a CI
+// log ("actions", "gitlab" or "azure").
+func newLogger(w io.Writer, format string, level slog.Leveler) *slog.Logger {
+	if format == "json" {
+		return slog.New(maskFilter{slog.NewJSONHandler(w, &slog.HandlerOptions{
+			Level: level,
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if a.Key == slog.LevelKey && a.Value.Any() == LevelNotice {
+					a.Value = slog.StringValue("NOTICE")
+				}
+				return a
+			},
+		})})
+	}
+	return slog.New(&commandHandler{w: w, dialect: logDialects[format], level: level, mu: &sync.Mutex{}})
+}
+
+// configureLogging applies --log-format and --log-level. An empty format
+// keeps the current one, which defaults to the CI provider's.
+func configureLogging(format, level string) error {
+	if _, ok := logDialects[format]; ok || format == "json" {
+		logger = newLogger(stdoutWriter{}, format, logLevel)
+	} else if format != "" {
+		return fmt.Errorf("invalid log format %q: expected actions, gitlab, azure or json", format)
+	}
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q: expected debug, info, warn or error", level)
+	}
+	logLevel.Set(l)
+	return nil
+}
+
+func logf(level slog.Level, format string, args ...interface{}) {
+	logger.Log(context.Background(), level, fmt.Sprintf(format, args...))
+}
+
+func logDebug(format string, args ...interface{})  { logf(slog.LevelDebug, format, args...) }
+func logInfo(format string, args ...interface{})   { logf(slog.LevelInfo, format, args...) }
+func logNotice(format string, args ...interface{}) { logf(LevelNotice, format, args...) }
+func logWarn(format string, args ...interface{})   { logf(slog.LevelWarn, format, args...) }
+func logError(format string, args ...interface{})  { logf(slog.LevelError, format, args...) }
+
+// logGroup starts a collapsible group and returns the function that ends it.
+func logGroup(title string) func() {
+	logger.Info(title, slog.String(groupAttr, "start"))
+	return func() { logger.Info(title, slog.String(groupAttr, "end")) }
+}
+
+// maskSecret hides value in the rest of the Actions log. It bypasses the level
+// so a quiet log still masks; the JSON renderer drops it.
+func maskSecret(value string) {
+	record := slog.NewRecord(time.Now(), slog.LevelInfo, value, 0)
+	record.AddAttrs(slog.Bool(maskAttr, true))
+	logger.Handler().Handle(context.Background(), record)
+}
+
+// logDialect is how a CI log shows annotations, groups and secrets.
+type logDialect struct {
+	// command renders an "error", "warning", "notice" or "debug" record.
+	command    func(kind string, props map[string]string, msg string) string
+	groupStart func(title string) string
+	groupEnd   func(title string) string
+	// mask registers one line of a secret; nil drops secrets.
+	mask func(line string) string
+}
+
+var logDialects = map[string]logDialect{
+	"actions": {
+		command: workflowCommand,
+		groupStart: func(title string) string {
+			return "::group::" + escapeData(title) + "\n"
+		},
+		groupEnd: func(string) string { return "::endgroup::\n" },
+		mask: func(line string) string {
+			return "::add-mask::" + escapeData(line) + "\n"
+		},
+	},
+	"gitlab": {
+		command: func(kind string, props map[string]string, msg string) string {
+			if file := props["file"]; file != "" {
+				msg = strings.TrimSuffix(file+":"+props["line"], ":") + ": " + msg
+			}
+			return strings.ToUpper(kind) + ": " + msg + "\n"
+		},
+		groupStart: func(title string) string {
+			return fmt.Sprintf("\x1b[0Ksection_start:%d:%s[collapsed=true]\r\x1b[0K%s\n", time.Now().Unix(), sectionName(title), title)
+		},
+		groupEnd: func(title string) string {
+			return fmt.Sprintf("\x1b[0Ksection_end:%d:%s\r\x1b[0K\n", time.Now().Unix(), sectionName(title))
+		},
+	},
+	"azure": {
+		command: func(kind string, props map[string]string, msg string) string {
+			switch kind {
+			case "error", "warning":
+				issue := "type=" + kind
+				for _, p := range [][2]string{{"file", "sourcepath"}, {"line", "linenumber"}, {"col", "columnnumber"}} {
+					if value := props[p[0]]; value != "" {
+						issue += ";" + p[1] + "=" + escapeAzureProperty(value)
+					}
+				}
+				return "##vso[task.logissue " + issue + "]" + escapeAzureData(msg) + "\n"
+			case "notice":
+				return "##[section]" + escapeAzureData(msg) + "\n"
+			}
+			return "##[debug]" + escapeAzureData(msg) + "\n"
+		},
+		groupStart: func(title string) string { return "##[group]" + escapeAzureData(title) + "\n" },
+		groupEnd:   func(string) string { return "##[endgroup]\n" },
+		mask: func(line string) string {
+			return "##vso[task.setsecret]" + escapeAzureData(line) + "\n"
+		},
+	},
+}
+
+// sectionName turns a group title into a GitLab section name.
+func sectionName(title string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		if r >= 'A' && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return '_'
+	}, title)
+}
+
+// commandHandler renders warnings, errors, notices and debug records as CI
+// log commands and info records as plain lines.
+type commandHandler struct {
+	w       io.Writer
+	dialect logDialect
+	level   slog.Leveler
+	attrs   []slog.Attr
+	prefix  string
+	mu      *sync.Mutex
+}
+
+func (h *commandHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *commandHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = append(append([]slog.Attr{}, h.attrs...), h.prefixed(attrs)...)
+	return &clone
+}
+
+func (h *commandHandler) WithGroup(name string) slog.Handler {
+	clone := *h
+	clone.prefix = h.prefix + name + "."
+	return &clone
+}
+
+func (h *commandHandler) prefixed(attrs []slog.Attr) []slog.Attr {
+	if h.prefix == "" {
+		return attrs
+	}
+	out := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		out[i] = slog.Attr{Key: h.prefix + a.Key, Value: a.Value}
+	}
+	return out
+}
+
+// annotationProperties are attributes that become properties of an
+// annotation, e.g. ::error file=a.go,line=3::message.
+var annotationProperties = []string{"title", "file", "line", "endLine", "col", "endColumn"}
+
+func (h *commandHandler) Handle(_ context.Context, r slog.Record) error {
+	attrs := append([]slog.Attr{}, h.attrs...)
+	var record []slog.Attr
+	r.Attrs(func(a slog.Attr) bool {
+		record = append(record, a)
+		return true
+	})
+	attrs = append(attrs, h.prefixed(record)...)
+
+	values := make(map[string]string)
+	var extra []string
+	for _, a := range attrs {
+		values[a.Key] = a.Value.String()
+	}
+	for _, a := range attrs {
+		if a.Key == groupAttr || a.Key == maskAttr || containsString(annotationProperties, a.Key) {
+			continue
+		}
+		extra = append(extra, fmt.Sprintf("%s=%s", a.Key, a.Value))
+	}
+	msg := strings.TrimSuffix(r.Message, "\n")
+	if len(extra) > 0 {
+		msg += " " + strings.Join(extra, " ")
+	}
+
+	var b strings.Builder
+	switch {
+	case values[maskAttr] == "true":
+		for _, line := range strings.Split(msg, "\n") {
+			if line = strings.TrimSpace(line); line != "" && h.dialect.mask != nil {
+				b.WriteString(h.dialect.mask(line))
+			}
+		}
+	case values[groupAttr] == "start":
+		b.WriteString(h.dialect.groupStart(msg))
+	case values[groupAttr] == "end":
+		b.WriteString(h.dialect.groupEnd(msg))
+	case r.Level >= slog.LevelError:
+		b.WriteString(h.dialect.command("error", values, msg))
+	case r.Level >= slog.LevelWarn:
+		b.WriteString(h.dialect.command("warning", values, msg))
+	case r.Level >= LevelNotice:
+		b.WriteString(h.dialect.command("notice", values, msg))
+	case r.Level >= slog.LevelInfo:
+		b.WriteString(msg + "\n")
+	default:
+		b.WriteString(h.dialect.command("debug", nil, msg))
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+// workflowCommand formats a GitHub Actions ::command props::message with the
+// message and property values escaped so they cannot end the command or start
+// another.
+func workflowCommand(command string, values map[string]string, msg string) string {
+	var props []string
+	for _, key := range annotationProperties {
+		if value, ok := values[key]; ok && value != "" {
+			props = append(props, key+"="+escapeProperty(value))
+		}
+	}
+	if len(props) > 0 {
+		command += " " + strings.Join(props, ",")
+	}
+	return fmt.Sprintf("::%s::%s\n", command, escapeData(msg))
+}
+
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
+
+// maskFilter keeps secrets that are only meant for the Actions masker out of
+// the JSON log.
+type maskFilter struct {
+	slog.Handler
+}
+
+func (f maskFilter) Handle(ctx context.Context, r slog.Record) error {
+	masked := false
+	r.Attrs(func(a slog.Attr) bool {
+		masked = a.Key == maskAttr
+		return !masked
+	})
+	if masked {
+		return nil
+	}
+	return f.Handler.Handle(ctx, r)
+}
+
+func (f maskFilter) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return maskFilter{f.Handler.WithAttrs(attrs)}
+}
+
+func (f maskFilter) WithGroup(name string) slog.Handler {
+	return maskFilter{f.Handler.WithGroup(name)}
+}
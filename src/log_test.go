@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestMain pins GitHub Actions and its renderer so tests see the same output
+// whichever CI system runs them.
+func TestMain(m *testing.M) {
+	ciProvider = githubActions{os.LookupEnv}
+	logger = newLogger(stdoutWriter{}, "actions", logLevel)
+	os.Exit(m.Run())
+}
+
+func TestActionsHandler(t *testing.T) {
+	tests := []struct {
+		name string
+		log  func(l *slog.Logger)
+		want string
+	}{
+		{"Info is plain", func(l *slog.Logger) { l.Info("Token preflight passed.") }, "Token preflight passed.\n"},
+		{"Warning", func(l *slog.Logger) { l.Warn("Could not inspect git state") }, "::warning::Could not inspect git state\n"},
+		{"Error escapes data", func(l *slog.Logger) { l.Error("50% done\r\nline two") }, "::error::50%25 done%0D%0Aline two\n"},
+		{"Injection stays in the message", func(l *slog.Logger) { l.Error("bad\n::add-mask::x") }, "::error::bad%0A::add-mask::x\n"},
+		{"Notice", func(l *slog.Logger) { l.Log(context.Background(), LevelNotice, "heads up") }, "::notice::heads up\n"},
+		{"Debug", func(l *slog.Logger) { l.Debug("details") }, "::debug::details\n"},
+		{"Annotation properties", func(l *slog.Logger) {
+			l.Warn("stale", "file", "a,b.md", "line", 3, "title", "Skill: old")
+		}, "::warning title=Skill%3A old,file=a%2Cb.md,line=3::stale\n"},
+		{"Other attributes", func(l *slog.Logger) { l.With("mission", "audit").Info("done", "files", 2) }, "done mission=audit files=2\n"},
+		{"Group", func(l *slog.Logger) {
+			l.Info("Checking MCP servers", groupAttr, "start")
+			l.Info("Checking MCP servers", groupAttr, "end")
+		}, "::group::Checking MCP servers\n::endgroup::\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			level := new(slog.LevelVar)
+			level.Set(slog.LevelDebug)
+			tt.log(newLogger(&buf, "actions", level))
+			if buf.String() != tt.want {
+				t.Errorf("got %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONLogger(t *testing.T) {
+	var buf bytes.Buffer
+	old := logger
+	logger = newLogger(&buf, "json", slog.LevelInfo)
+	defer func() { logger = old }()
+
+	end := logGroup("Opening Pull Request")
+	logNotice("heads up")
+	logWarn("Could not fetch %s", "docs")
+	logDebug("hidden")
+	maskSecret("s3cret")
+	end()
+
+	if strings.Contains(buf.String(), "s3cret") || strings.Contains(buf.String(), "hidden") {
+		t.Errorf("masked and debug records should be dropped:\n%s", buf.String())
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 JSON lines, got %d:\n%s", len(lines), buf.String())
+	}
+	var records []map[string]interface{}
+	for _, line := range lines {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	if records[0]["group"] != "start" || records[0]["msg"] != "Opening Pull Request" || records[3]["group"] != "end" {
+		t.Errorf("unexpected group records: %v %v", records[0], records[3])
+	}
+	if records[1]["level"] != "NOTICE" || records[2]["level"] != "WARN" || records[2]["msg"] != "Could not fetch docs" {
+		t.Errorf("unexpected records: %v %v", records[1], records[2])
+	}
+}
+
+func TestMaskSecretIgnoresLevel(t *testing.T) {
+	var buf bytes.Buffer
+	old := logger
+	logger = newLogger(&buf, "actions", slog.LevelError)
+	defer func() { logger = old }()
+
+	logWarn("quiet")
+	maskSecret("line1\n line2 \n")
+	if buf.String() != "::add-mask::line1\n::add-mask::line2\n" {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+}
+
+func TestConfigureLogging(t *testing.T) {
+	old := logger
+	defer func() {
+		logger = old
+		logLevel.Set(slog.LevelInfo)
+	}()
+
+	for _, format := range []string{"actions", "gitlab", "azure"} {
+		if err := configureLogging(format, "info"); err != nil {
+			t.Errorf("unexpected error for %s: %v", format, err)
+		}
+	}
+	if err := configureLogging("xml", "info"); err == nil {
+		t.Error("expected error for an unknown format")
+	}
+	if err := configureLogging("", "loud"); err == nil {
+		t.Error("expected error for an unknown level")
+	}
+	if err := configureLogging("json", "warn"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if logLevel.Level() != slog.LevelWarn {
+		t.Errorf("expected warn level, got %s", logLevel.Level())
+	}
+	if _, ok := logger.Handler().(maskFilter); !ok {
+		t.Errorf("expected the JSON renderer, got %T", logger.Handler())
+	}
+}
+
+func TestLogDialects(t *testing.T) {
+	log := func(l *slog.Logger) {
+		l.Warn("stale; 50%", "file", "a.md", "line", 3)
+		l.Log(context.Background(), LevelNotice, "heads up")
+		l.Debug("details")
+		end := logGroup("Opening Pull Request")
+		l.Info("plain")
+		end()
+	}
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{"gitlab", []string{
+			"WARNING: a.md:3: stale; 50%\n",
+			"NOTICE: heads up\n",
+			"DEBUG: details\n",
+			"\x1b[0Ksection_start:",
+			":opening_pull_request[collapsed=true]\r\x1b[0KOpening Pull Request\nplain\n\x1b[0Ksection_end:",
+			":opening_pull_request\r\x1b[0K\n",
+		}},
+		{"azure", []string{
+			"##vso[task.logissue type=warning;sourcepath=a.md;linenumber=3]stale; 50%AZP25\n",
+			"##[section]heads up\n",
+			"##[debug]details\n",
+			"##[group]Opening Pull Request\nplain\n##[endgroup]\n",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			old := logger
+			logger = newLogger(&buf, tt.format, slog.LevelDebug)
+			defer func() { logger = old }()
+
+			log(logger)
+			for _, want := range tt.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("expected %q in:\n%q", want, buf.String())
+				}
+			}
+		})
+	}
+
+	t.Run("Masks", func(t *testing.T) {
+		for format, want := range map[string]string{"gitlab": "", "azure": "##vso[task.setsecret]s3cret\n"} {
+			var buf bytes.Buffer
+			old := logger
+			logger = newLogger(&buf, format, slog.LevelError)
+			maskSecret("s3cret")
+			logger = old
+			if buf.String() != want {
+				t.Errorf("%s: got %q, want %q", format, buf.String(), want)
+			}
+		}
+	})
+}
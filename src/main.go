@@ -1,139 +1,377 @@
 package main
 
 import (
-	"encoding/json"
-	"flag"
+	"context"
 	"fmt"
 	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 )
 
+// version is set at build time with -ldflags "-X main.version=vX.Y.Z".
+var version = "dev"
 
 func main() {
-	if err := run(os.Args[1:], &RealCommandExecutor{}, http.DefaultClient); err != nil {
-		fmt.Printf("::error::%v\n", err)
+	ctx, interrupted := notifyInterrupt()
+	err := run(os.Args[1:], &RealCommandExecutor{Context: ctx}, http.DefaultClient)
+	if sig := interrupted(); sig != 0 {
+		logError("Interrupted (%s)", sig)
+		os.Exit(128 + int(sig))
+	}
+	if err != nil {
+		logError("%v", err)
 		os.Exit(1)
 	}
 }
 
-func run(args []string, executor CommandExecutor, httpClient HTTPClient) error {
-	fs := flag.NewFlagSet("agent", flag.ContinueOnError)
-	mission := fs.String("mission", "", "Agent mission prompt")
-	template := fs.String("template", "", "Mission template name")
-	sourcesConfig := fs.String("sources-config", ".github/sources.yml", "Path to sources config")
-	githubToken := fs.String("github-token", "", "GitHub Token")
-	contextFiles := fs.String("context-files", ".", "Context files or globs")
-	model := fs.String("model", "", "Primary model")
-	fallbackModel := fs.String("fallback-model", "", "Fallback model")
-	dryRun := fs.Bool("dry-run", false, "Skip PR creation")
-	skipSetup := fs.Bool("skip-setup", false, "Skip GH CLI and extension installation")
-	
-	if err := fs.Parse(args); err != nil {
-		return err
-	}
+// notifyInterrupt cancels the returned context on SIGINT or SIGTERM, which
+// kills running commands so run unwinds through its deferred cleanup. The
+// returned function reports the signal received, if any. A second signal
+// exits immediately.
+func notifyInterrupt() (context.Context, func() syscall.Signal) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
 
-	// 0. Setup (CLI, Auth, Extension)
-	if !*skipSetup {
-		if err := installGitHubCLI(executor); err != nil {
-			fmt.Printf("::warning::Setup failed (GH CLI): %v\n", err)
+	received := make(chan syscall.Signal, 1)
+	go func() {
+		sig := (<-signals).(syscall.Signal)
+		received <- sig
+		cancel()
+		sig = (<-signals).(syscall.Signal)
+		os.Exit(128 + int(sig))
+	}()
+	return ctx, func() syscall.Signal {
+		select {
+		case sig := <-received:
+			return sig
+		default:
+			return 0
 		}
-		if err := configureGitHubAuth(httpClient, *githubToken); err != nil {
-			return fmt.Errorf("auth failed: %w", err)
-		}
-		if err := installCopilotExtension(executor); err != nil {
-			fmt.Printf("::warning::Setup failed (Copilot extension): %v\n", err)
+	}
+}
+
+func run(args []string, executor CommandExecutor, httpClient HTTPClient) (err error) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "mcp-server":
+			return runMCPServer(args[1:], os.Stdin, os.Stdout)
+		case "update-lock":
+			return runUpdateLock(args[1:], httpClient)
 		}
 	}
 
+	cfg, err := loadRunConfig(args, os.LookupEnv)
+	if err != nil {
+		return err
+	}
+	if err := configureCI(cfg.CI, cfg.Repository); err != nil {
+		return err
+	}
+	if err := configureLogging(firstNonEmpty(cfg.LogFormat, ciProvider.LogFormat()), cfg.LogLevel); err != nil {
+		return err
+	}
+	if cfg.ShowVersion {
+		fmt.Println("agentic-audits", version)
+		return nil
+	}
+	logInfo("agentic-audits %s", version)
 
-	// 1. Resolve Mission
-	resolvedMission, err := resolveMission(*mission, *template)
+	// Phases are traced when the OTEL_* variables point at a collector.
+	tracer := tracerFromEnv(os.LookupEnv, httpClient)
+	root := tracer.Start("agentic-audits")
+	root.SetAttribute("missions", len(cfg.Plan))
+	root.SetAttribute("dry_run", planDryRun(cfg.Plan))
+	defer func() {
+		root.End(err)
+		if exportErr := tracer.Shutdown(); exportErr != nil {
+			logWarn("%v", exportErr)
+		}
+	}()
+
+	host, err := resolveGitHubHost(cfg.GithubHost)
 	if err != nil {
-		fmt.Printf("::error::%v\n", err)
-		os.Exit(1)
+		return err
+	}
+
+	// The repository token pushes and opens PRs; the Copilot token only reaches the agent.
+	authSpan := root.Child("auth")
+	token := cfg.GithubToken
+	var author GitIdentity
+	var appTokens *appTokenSource
+	app := GitHubAppConfig{
+		AppID:          cfg.AppID,
+		PrivateKey:     cfg.AppPrivateKey,
+		InstallationID: cfg.AppInstallationID,
+		Owner:          cfg.AppOwner,
+	}
+	if app.Enabled() {
+		authSpan.SetAttribute("auth.method", "github-app")
+		if app.Owner == "" {
+			app.Owner, _, _ = strings.Cut(ciProvider.Repository(), "/")
+		}
+		installation, err := fetchInstallationToken(httpClient, host, app, time.Now())
+		if err != nil {
+			err = fmt.Errorf("GitHub App auth failed: %w", err)
+			authSpan.End(err)
+			return err
+		}
+		token = installation.Token
+		appTokens = &appTokenSource{Client: httpClient, Host: host, App: app, Current: installation}
+		if author, err = appGitIdentity(httpClient, host, app, token, time.Now()); err != nil {
+			logWarn("Could not look up the GitHub App's bot account; committing as %s: %v", defaultGitIdentity.Name, err)
+		}
+	} else {
+		authSpan.SetAttribute("auth.method", "token")
+	}
+	modelToken := cfg.CopilotToken
+	if modelToken == "" {
+		modelToken = cfg.GithubToken
 	}
+	if modelToken == "" && app.Enabled() {
+		err = fmt.Errorf("--copilot-token is required with GitHub App auth; installation tokens have no Copilot access")
+		authSpan.End(err)
+		return err
+	}
+	authSpan.End(nil)
 
-	// 2. Configure Sources
-	processed, err := parseSources(*sourcesConfig)
+	orgSources, err := loadOrgSources(httpClient, host, token, cfg.OrgSources)
 	if err != nil {
-		fmt.Printf("::error::Error parsing sources: %v\n", err)
-		// Don't exit here, might want to continue without sources? 
-		// JS logic returns empty defaults on error.
+		return err
+	}
+	if cfg.PrintSources {
+		for _, missionCfg := range cfg.Plan {
+			if missionCfg.MissionName != "" {
+				fmt.Printf("# mission %s\n", missionCfg.MissionName)
+			}
+			fmt.Print(formatEffectiveSources(mergeSourceLayers(sourceLayers(missionCfg, orgSources))))
+		}
+		return nil
 	}
 
-	// 3. Write Copilot Config
-	configDir := filepath.Join(os.Getenv("HOME"), ".config", "github-copilot")
-	if err := os.MkdirAll(configDir, 0755); err != nil {
-		fmt.Printf("::error::Failed to create config dir: %v\n", err)
-		os.Exit(1)
+	// 0. Setup (CLI)
+	setupSpan := root.Child("setup")
+	setupSpan.SetAttribute("setup.skipped", cfg.SkipSetup)
+	var setupReport SetupReport
+	if !cfg.SkipSetup {
+		step, err := ensureGitHubCLI(executor, InstallOptions{
+			Mode:       cfg.GhInstall,
+			MinVersion: cfg.GhMinVersion,
+			Tarball:    cfg.GhTarball,
+			SHA256:     cfg.GhTarballSHA256,
+			BinDir:     cfg.GhBinDir,
+		})
+		if err != nil {
+			err = fmt.Errorf("setup failed (gh CLI): %w", err)
+			setupSpan.End(err)
+			return err
+		}
+		setupReport.Add(step)
 	}
 
-	copilotConfig := CopilotConfig{
-		MCPServers: processed.MCPServers,
+	sandbox, err := newSandbox(!cfg.SharedHome)
+	if err != nil {
+		setupSpan.End(err)
+		return err
 	}
-	configData, _ := json.MarshalIndent(copilotConfig, "", "  ")
-	configFile := filepath.Join(configDir, "config.json")
-	if err := os.WriteFile(configFile, configData, 0644); err != nil {
-		fmt.Printf("::error::Failed to write config file: %v\n", err)
-		os.Exit(1)
+	defer sandbox.Cleanup()
+	childEnv := overrideEnv(withoutEnv(sandbox.Environ(), repoTokenEnvVars...), map[string]string{"GH_HOST": host.Name})
+
+	// 0a. Setup (Auth, Extension)
+	if !cfg.SkipSetup {
+		ghAuthSpan := setupSpan.Child("auth.gh")
+		if err := configureGitHubAuth(httpClient, modelToken, sandbox.ConfigHome, host); err != nil {
+			err = fmt.Errorf("auth failed: %w", err)
+			ghAuthSpan.End(err)
+			setupSpan.End(err)
+			return err
+		}
+		ghAuthSpan.End(nil)
+		step, err := ensureCopilotExtension(executor, childEnv, ExtensionOptions{
+			Source:   cfg.CopilotExtension,
+			Version:  cfg.CopilotExtensionVersion,
+			CacheDir: cfg.ExtensionCacheDir,
+			DataHome: sandbox.DataHome,
+		})
+		if err != nil {
+			err = fmt.Errorf("setup failed (Copilot extension): %w", err)
+			setupSpan.End(err)
+			return err
+		}
+		setupReport.Add(step)
+
+		logInfo("Setup summary:\n%s", setupReport.String())
+		outputEnv("SETUP_REPORT", strings.TrimSpace(setupReport.String()))
 	}
+	setupSpan.End(nil)
 
-	// 4. Handle Output/Env
-	outputEnv("RESOLVED_MISSION", resolvedMission)
-	outputEnv("EXTRA_WEB_SOURCES", processed.WebSources)
+	// 0b. Preflight (token scopes, repository access, Copilot entitlement)
+	if !cfg.SkipPreflight {
+		preflightSpan := root.Child("preflight")
+		_, err := verifyTokenCapabilities(httpClient, host, token, modelToken, ciProvider.Repository(), !planDryRun(cfg.Plan))
+		preflightSpan.End(err)
+		if err != nil {
+			return err
+		}
+	}
 
-	// 5. Verify gh and optionally run commands
+	// Verify gh and optionally run commands
 	if _, err := exec.LookPath("gh"); err != nil {
-		fmt.Println("::warning::gh CLI not found in path")
+		logWarn("gh CLI not found in path")
+	}
+
+	start, err := captureGitSnapshot(executor)
+	if err != nil {
+		logWarn("Could not inspect git state: %v", err)
+	} else if start.Dirty {
+		logWarn("Working tree has uncommitted changes before the mission; they will be included in the results.")
 	}
 
-	// 6. Execute Mission
-	agentOpts := AgentOptions{
-		FullMission:   resolvedMission,
-		ContextFiles:  *contextFiles,
-		Model:         *model,
-		FallbackModel: *fallbackModel,
-		DryRun:        *dryRun,
-		GithubToken:   *githubToken,
-		Executor:      executor,
+	// 1-6. Run each mission in the plan, in dependency order
+	runDir, err := os.MkdirTemp(ciProvider.TempDir(), "agentic-audits-run-")
+	if err != nil {
+		return fmt.Errorf("failed to create run dir: %w", err)
 	}
+	defer os.RemoveAll(runDir)
 
-	if err := executeMission(agentOpts, processed.WebSources); err != nil {
-		return fmt.Errorf("mission execution failed: %w", err)
+	runner := &missionRunner{
+		Executor:   executor,
+		HTTPClient: httpClient,
+		Env:        childEnv,
+		ConfigHome: sandbox.ConfigHome,
+		RunDir:     runDir,
+		ModelToken: modelToken,
+		OrgSources: orgSources,
 	}
+	if _, ok := executor.(*RealCommandExecutor); ok {
+		runner.ProbeMCP = probeMCPServer
+	}
+	perMission := cfg.PRMode == "per-mission" && len(cfg.Plan) > 1
+	var outputs []MissionOutput
+	stackBase := ""
+	for i, missionCfg := range cfg.Plan {
+		if len(cfg.Plan) > 1 {
+			logInfo("── Mission %d/%d: %s ──", i+1, len(cfg.Plan), missionCfg.MissionName)
+		}
+		missionSpan := root.Child("mission")
+		missionSpan.SetAttribute("mission.name", missionCfg.MissionName)
+		missionSpan.SetAttribute("mission.template", missionCfg.Template)
+		output, changes, err := runner.runMission(missionCfg, dependencyOutputs(missionCfg, outputs), missionSpan)
+		missionSpan.End(err)
+		if err != nil {
+			writeUsageReport(append(outputs, output))
+			if missionCfg.MissionName != "" {
+				return fmt.Errorf("mission %q: %w", missionCfg.MissionName, err)
+			}
+			return err
+		}
+		outputs = append(outputs, output)
 
-	// Print summary (mimics ::group:: behavior)
-	fmt.Println("Copilot config written to", configFile)
-	fmt.Println(string(configData))
-	return nil
-}
+		// A dry-run mission opens no PR, so when others in the plan do, its
+		// changes are set aside rather than carried into their PRs.
+		if missionCfg.DryRun && !changes.Empty() && !planDryRun(cfg.Plan) {
+			patch := filepath.Join(ciProvider.TempDir(), fmt.Sprintf("agentic-audits-%s-dry-run.patch", missionCfg.MissionName))
+			if err := setAsideChanges(executor, changes, patch); err != nil {
+				return fmt.Errorf("failed to set aside the changes of dry-run mission %q: %w", missionCfg.MissionName, err)
+			}
+			logInfo("Reverted the changes of dry-run mission %s; they are saved in %s.", missionCfg.MissionName, patch)
+		}
 
+		// Per-mission PRs are stacked: each targets the previous mission's branch.
+		if perMission && !missionCfg.DryRun && !changes.Empty() {
+			prCfg := *missionCfg
+			if stackBase != "" {
+				prCfg.PRBase = stackBase
+			}
+			if prCfg.PRBranch != "" && missionCfg.Spec.PR.Branch == "" {
+				prCfg.PRBranch += "-" + missionCfg.MissionName
+			}
+			if token, err = currentRepoToken(token, appTokens); err != nil {
+				return err
+			}
+			prSpan := root.Child("pull_request")
+			prSpan.SetAttribute("mission.name", missionCfg.MissionName)
+			branch, err := handlePullRequest(executor, childEnv, host, token, author, &prCfg, []string{missionCfg.MissionName}, output, changes)
+			prSpan.SetAttribute("pr.branch", branch)
+			prSpan.End(err)
+			if err != nil {
+				return fmt.Errorf("pull request handling failed for mission %q: %w", missionCfg.MissionName, err)
+			}
+			stackBase = branch
+		}
+	}
+	writeMissionOutputs(outputs)
+	writeUsageReport(outputs)
 
-func outputEnv(name, value string) {
-	if value == "" {
-		return
+	// 7. Inspect Changes
+	changes, err := collectGitChanges(executor, start)
+	if err != nil {
+		if !planDryRun(cfg.Plan) {
+			return fmt.Errorf("failed to inspect changes: %w", err)
+		}
+		logWarn("Could not inspect changes: %v", err)
 	}
-	githubEnv := os.Getenv("GITHUB_ENV")
-	if githubEnv != "" {
-		f, err := os.OpenFile(githubEnv, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	outputEnv("CHANGED_FILES", strings.Join(changes.Files, "\n"))
+	outputEnv("DIFF_STAT", changes.DiffStat)
+	if changes.Diff != "" {
+		diffFile := filepath.Join(ciProvider.TempDir(), "agentic-audits.diff")
+		if err := os.WriteFile(diffFile, []byte(changes.Diff), 0644); err == nil {
+			outputEnv("DIFF_FILE", diffFile)
+		}
+	}
+
+	// 8. Open Pull Request
+	if perMission {
+		return nil
+	}
+	var prPlan []*RunConfig
+	var prOutputs []MissionOutput
+	for i, missionCfg := range cfg.Plan {
+		if !missionCfg.DryRun {
+			prPlan = append(prPlan, missionCfg)
+			prOutputs = append(prOutputs, outputs[i])
+		}
+	}
+	if changes.Empty() {
+		logInfo("No changes detected, skipping Pull Request.")
+	} else if len(prPlan) > 0 {
+		prCfg, output := combineMissions(prPlan, prOutputs)
+		if token, err = currentRepoToken(token, appTokens); err != nil {
+			return err
+		}
+		prSpan := root.Child("pull_request")
+		branch, err := handlePullRequest(executor, childEnv, host, token, author, prCfg, missionNames(prPlan), output, changes)
+		prSpan.SetAttribute("pr.branch", branch)
+		prSpan.End(err)
 		if err != nil {
-			fmt.Printf("::error::Failed to open GITHUB_ENV: %v\n", err)
-			return
+			return fmt.Errorf("pull request handling failed: %w", err)
 		}
-		defer f.Close()
-		
-		if strings.Contains(value, "\n") {
-			fmt.Fprintf(f, "%s<<EOF\n%s\nEOF\n", name, value)
-		} else {
-			fmt.Fprintf(f, "%s=%s\n", name, value)
+	}
+	return nil
+}
+
+// currentRepoToken is the token to push and open PRs with. A GitHub App
+// installation token is re-minted first when it is close to expiry.
+func currentRepoToken(token string, app *appTokenSource) (string, error) {
+	if app == nil {
+		return token, nil
+	}
+	return app.Token(time.Now())
+}
+
+// planDryRun reports whether no mission in the plan opens a PR.
+func planDryRun(plan []*RunConfig) bool {
+	for _, cfg := range plan {
+		if !cfg.DryRun {
+			return false
 		}
-	} else {
-		// Fallback for local testing
-		fmt.Printf("EXPORT %s=%s\n", name, value)
 	}
+	return true
 }
 
 func resolveMission(mission, template string) (string, error) {
@@ -155,3 +393,71 @@ func resolveMission(mission, template string) (string, error) {
 
 	return mission, nil
 }
+
+// handlePullRequest renders the PR text for the output of the given missions
+// and opens the PR, returning the branch it pushed.
+func handlePullRequest(executor CommandExecutor, env []string, host GitHubHost, token string, author GitIdentity, cfg *RunConfig, missions []string, output MissionOutput, changes GitChanges) (string, error) {
+	spec, err := newPullRequestSpec(cfg, newPRTemplateData(cfg, missions, output, changes, ciProvider), host.QualifiedRepo(ciProvider.Repository()), time.Now())
+	if err != nil {
+		return "", err
+	}
+	spec.Author = author
+	return spec.Branch, openPullRequest(executor, spec, host, token, env)
+}
+
+// newPRTemplateData collects the template variables for a PR carrying the
+// output and changes of the given missions.
+func newPRTemplateData(cfg *RunConfig, missions []string, output MissionOutput, changes GitChanges, ci CIProvider) PRTemplateData {
+	return PRTemplateData{
+		Template:        cfg.Template,
+		Missions:        missions,
+		Model:           output.Model,
+		RunURL:          ci.RunURL(),
+		FindingsSummary: output.Findings,
+		Findings:        output.Reported,
+		ChangedFiles:    changes.Files,
+		DiffStat:        changes.DiffStat,
+	}
+}
+
+// newPullRequestSpec renders the PR for a mission. The clock only names the
+// branch when --pr-branch is not set.
+func newPullRequestSpec(cfg *RunConfig, data PRTemplateData, repository string, now time.Time) (PullRequestSpec, error) {
+	titleTemplate, err := loadPRTemplate(cfg.PRTitleTemplate, cfg.PRTitle, defaultPRTitleTemplate)
+	if err != nil {
+		return PullRequestSpec{}, err
+	}
+	bodyTemplate, err := loadPRTemplate(cfg.PRBodyTemplate, cfg.PRBody, defaultPRBodyTemplate)
+	if err != nil {
+		return PullRequestSpec{}, err
+	}
+	title, body, err := renderPRText(titleTemplate, bodyTemplate, data)
+	if err != nil {
+		return PullRequestSpec{}, err
+	}
+
+	branch := cfg.PRBranch
+	if branch == "" {
+		branch = fmt.Sprintf("agent/%s-%d", firstNonEmpty(cfg.MissionName, "audit"), now.Unix())
+	}
+	return PullRequestSpec{
+		Repository: repository,
+		Base:       cfg.PRBase,
+		Branch:     branch,
+		Title:      title,
+		Body:       body,
+		Labels:     cfg.PRLabels,
+	}, nil
+}
+
+func defaultExtensionCacheDir() string {
+	return defaultCacheDir("gh-copilot")
+}
+
+// defaultCacheDir prefers the runner tool cache so entries survive between jobs on self-hosted runners.
+func defaultCacheDir(name string) string {
+	if toolCache := os.Getenv("RUNNER_TOOL_CACHE"); toolCache != "" {
+		return filepath.Join(toolCache, "agentic-audits", name)
+	}
+	return filepath.Join(getEnvOrDefault("XDG_CACHE_HOME", filepath.Join(os.Getenv("HOME"), ".cache")), "agentic-audits", name)
+}
@@ -2,16 +2,27 @@ package main
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 )
 
 func TestRun(t *testing.T) {
-	// Mock executor and http client
+	// Mock executor (emulating an installed gh and extension) and http client
 	executor := &MockCommandExecutor{
 		RunFunc: func(name string, args []string, env []string, stdout, stderr io.Writer) error {
+			if name == "gh" && len(args) > 0 && args[0] == "--version" {
+				stdout.Write([]byte("gh version 2.50.0 (2024-05-01)\n"))
+			}
+			if name == "gh" && len(args) > 1 && args[1] == "list" {
+				stdout.Write([]byte("gh copilot\tgithub/gh-copilot\tv1.0.5\n"))
+			}
 			return nil
 		},
 	}
@@ -24,6 +35,8 @@ func TestRun(t *testing.T) {
 			},
 	}
 
+	t.Setenv("GITHUB_REPOSITORY", "")
+
 	// Setup tmp config dir
 	tmpHome, _ := os.MkdirTemp("", "main-test")
 	defer os.RemoveAll(tmpHome)
@@ -45,12 +58,84 @@ func TestRun(t *testing.T) {
 		}
 	})
 
+	t.Run("Isolated home leaves no token behind", func(t *testing.T) {
+		err := run([]string{"--mission", "test", "--github-token", "tok"}, executor, httpClient)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(tmpHome, ".config", "gh", "hosts.yml")); !os.IsNotExist(err) {
+			t.Error("hosts.yml should not be written to the real HOME")
+		}
+	})
+
+	t.Run("Shared home", func(t *testing.T) {
+		err := run([]string{"--mission", "test", "--github-token", "tok", "--shared-home"}, executor, httpClient)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(tmpHome, ".config", "gh", "hosts.yml")); err != nil {
+			t.Errorf("hosts.yml should be written to the real HOME with --shared-home: %v", err)
+		}
+	})
+
+	t.Run("GitHub App auth failure", func(t *testing.T) {
+		err := run([]string{"--mission", "test", "--app-id", "1", "--app-private-key", "missing.pem", "--skip-setup"}, executor, httpClient)
+		if err == nil || !strings.Contains(err.Error(), "GitHub App auth failed") {
+			t.Errorf("expected GitHub App auth error, got %v", err)
+		}
+	})
+
+	t.Run("Setup fails fast without gh", func(t *testing.T) {
+		noGh := &MockCommandExecutor{
+			RunFunc: func(name string, args []string, env []string, stdout, stderr io.Writer) error {
+				if name == "gh" {
+					return fmt.Errorf("executable file not found")
+				}
+				return nil
+			},
+		}
+		err := run([]string{"--mission", "test", "--github-token", "tok", "--gh-install", "skip"}, noGh, httpClient)
+		if err == nil || !strings.Contains(err.Error(), "setup failed (gh CLI)") {
+			t.Errorf("expected setup failure, got %v", err)
+		}
+	})
+
+	t.Run("Version", func(t *testing.T) {
+		if err := run([]string{"--version"}, executor, httpClient); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
 	t.Run("Invalid flags", func(t *testing.T) {
 		err := run([]string{"--invalid"}, executor, httpClient)
 		if err == nil {
 			t.Error("expected error for invalid flags")
 		}
 	})
+
+	t.Run("Separate boolean value is rejected", func(t *testing.T) {
+		err := run([]string{"--mission", "test", "--skip-setup", "--dry-run", "true"}, executor, httpClient)
+		if err == nil || !strings.Contains(err.Error(), "positional") {
+			t.Errorf("expected positional argument error, got %v", err)
+		}
+	})
+}
+
+func TestNotifyInterrupt(t *testing.T) {
+	ctx, interrupted := notifyInterrupt()
+	if sig := interrupted(); sig != 0 {
+		t.Fatalf("no signal received yet, got %s", sig)
+	}
+
+	syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("SIGTERM should cancel the context")
+	}
+	if sig := interrupted(); sig != syscall.SIGTERM || 128+int(sig) != 143 {
+		t.Errorf("expected SIGTERM (exit 143), got %s", sig)
+	}
 }
 
 func TestOutputEnv(t *testing.T) {
@@ -70,3 +155,34 @@ func TestOutputEnv(t *testing.T) {
 		t.Error("should contain multi-line env")
 	}
 }
+
+func TestHandlePullRequest(t *testing.T) {
+	cfg := &RunConfig{Template: "skills-audit", PRBase: "main", PRBranch: "agent/test", PRLabels: []string{"automated-pr"}}
+
+	t.Run("Changes open PR with rendered body", func(t *testing.T) {
+		var body string
+		executor := &MockCommandExecutor{
+			RunFunc: func(name string, args []string, env []string, stdout, stderr io.Writer) error {
+				if name == "gh" {
+					for i, arg := range args {
+						if arg == "--body" {
+							body = args[i+1]
+						}
+					}
+				}
+				return nil
+			},
+		}
+		changes := GitChanges{Files: []string{"skills/a.md"}}
+		branch, err := handlePullRequest(executor, nil, GitHubHost{Name: "github.com"}, "tok", GitIdentity{}, cfg, []string{"audit"}, MissionOutput{Model: "m", Findings: "Found two stale skills."}, changes)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if branch != "agent/test" {
+			t.Errorf("expected branch agent/test, got %q", branch)
+		}
+		if !bytes.Contains([]byte(body), []byte("Found two stale skills.")) || !bytes.Contains([]byte(body), []byte("skills/a.md")) {
+			t.Errorf("unexpected PR body:\n%s", body)
+		}
+	})
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// htmlToMarkdown is a small converter for documentation pages. It keeps
+// headings, paragraphs, links, lists, emphasis and code, and drops scripts,
+// styles and page chrome. It is not a full HTML parser and does not try to be.
+func htmlToMarkdown(page string) string {
+	for _, re := range skippedElements {
+		page = re.ReplaceAllString(page, "")
+	}
+	page = htmlComments.ReplaceAllString(page, "")
+
+	var out strings.Builder
+	var links []string // hrefs of open <a> tags
+	var listDepth, preDepth int
+
+	for len(page) > 0 {
+		start := strings.IndexByte(page, '<')
+		if start < 0 {
+			writeText(&out, page, preDepth > 0)
+			break
+		}
+		writeText(&out, page[:start], preDepth > 0)
+		end := strings.IndexByte(page[start:], '>')
+		if end < 0 {
+			writeText(&out, page[start:], preDepth > 0)
+			break
+		}
+		tag := page[start+1 : start+end]
+		page = page[start+end+1:]
+
+		name, closing := tagName(tag)
+		switch name {
+		case "h1", "h2", "h3", "h4", "h5", "h6":
+			if closing {
+				out.WriteString("\n\n")
+			} else {
+				out.WriteString("\n\n" + strings.Repeat("#", int(name[1]-'0')) + " ")
+			}
+		case "p", "div", "section", "article", "main", "table", "blockquote":
+			out.WriteString("\n\n")
+		case "br", "tr":
+			out.WriteString("\n")
+		case "td", "th":
+			if !closing {
+				out.WriteString(" | ")
+			}
+		case "ul", "ol":
+			if closing {
+				listDepth--
+			} else {
+				listDepth++
+			}
+			out.WriteString("\n")
+		case "li":
+			if !closing {
+				out.WriteString("\n" + strings.Repeat("  ", max(listDepth-1, 0)) + "- ")
+			}
+		case "strong", "b":
+			out.WriteString("**")
+		case "em", "i":
+			out.WriteString("_")
+		case "code":
+			if preDepth == 0 {
+				out.WriteString("`")
+			}
+		case "pre":
+			if closing {
+				preDepth--
+				out.WriteString("\n```\n\n")
+			} else {
+				preDepth++
+				out.WriteString("\n\n```\n")
+			}
+		case "a":
+			if closing {
+				if len(links) > 0 {
+					href := links[len(links)-1]
+					links = links[:len(links)-1]
+					if href != "" {
+						out.WriteString("](" + href + ")")
+					}
+				}
+			} else {
+				href := attribute(tag, "href")
+				if strings.HasPrefix(href, "#") || strings.HasPrefix(href, "javascript:") {
+					href = ""
+				}
+				links = append(links, href)
+				if href != "" {
+					out.WriteString("[")
+				}
+			}
+		}
+	}
+
+	return tidyMarkdown(out.String())
+}
+
+var (
+	skippedElements = skipPatterns("script", "style", "noscript", "svg", "template", "head", "nav", "header", "footer")
+	htmlComments    = regexp.MustCompile(`(?s)<!--.*?-->`)
+	attributeValue  = regexp.MustCompile(`(?i)\s([a-z-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+	blankLines      = regexp.MustCompile(`\n{3,}`)
+	inlineSpace     = regexp.MustCompile(`[ \t]+`)
+)
+
+func skipPatterns(names ...string) []*regexp.Regexp {
+	patterns := make([]*regexp.Regexp, len(names))
+	for i, name := range names {
+		patterns[i] = regexp.MustCompile(`(?is)<` + name + `\b[^>]*>.*?</` + name + `\s*>`)
+	}
+	return patterns
+}
+
+func tagName(tag string) (string, bool) {
+	closing := strings.HasPrefix(tag, "/")
+	tag = strings.TrimPrefix(tag, "/")
+	if i := strings.IndexAny(tag, " \t\n/"); i >= 0 {
+		tag = tag[:i]
+	}
+	return strings.ToLower(tag), closing
+}
+
+func attribute(tag, name string) string {
+	for _, m := range attributeValue.FindAllStringSubmatch(tag, -1) {
+		if strings.EqualFold(m[1], name) {
+			return html.UnescapeString(m[2] + m[3] + m[4])
+		}
+	}
+	return ""
+}
+
+func writeText(out *strings.Builder, text string, preformatted bool) {
+	text = html.UnescapeString(text)
+	if !preformatted {
+		text = inlineSpace.ReplaceAllString(strings.ReplaceAll(text, "\n", " "), " ")
+	}
+	out.WriteString(text)
+}
+
+func tidyMarkdown(md string) string {
+	lines := strings.Split(md, "\n")
+	inFence := false
+	for i, line := range lines {
+		if strings.HasPrefix(line, "```") {
+			inFence = !inFence
+		}
+		if !inFence {
+			lines[i] = strings.TrimRight(strings.TrimLeft(line, " "), " ")
+			if strings.HasPrefix(strings.TrimSpace(line), "- ") {
+				// Keep list indentation.
+				lines[i] = strings.TrimRight(line, " ")
+			}
+		}
+	}
+	return strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")) + "\n"
+}
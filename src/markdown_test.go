@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHTMLToMarkdown(t *testing.T) {
+	page := `<!DOCTYPE html>
+<html><head><title>Docs</title><style>body { color: red }</style></head>
+<body>
+<nav><a href="/">Home</a></nav>
+<h1>Getting   Started</h1>
+<p>Install the <strong>CLI</strong> with <code>go install</code> &amp; read the <a href="https://example.com/guide">guide</a>.</p>
+<!-- hidden -->
+<ul><li>One</li><li>Two<ul><li>Nested</li></ul></li></ul>
+<pre><code>go build ./...
+go test ./...</code></pre>
+<script>alert("x")</script>
+<footer>Copyright</footer>
+</body></html>`
+
+	md := htmlToMarkdown(page)
+
+	for _, want := range []string{
+		"# Getting Started",
+		"Install the **CLI** with `go install` & read the [guide](https://example.com/guide).",
+		"- One",
+		"- Two",
+		"  - Nested",
+		"```\ngo build ./...\ngo test ./...\n```",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("expected %q in:\n%s", want, md)
+		}
+	}
+	for _, unwanted := range []string{"alert", "color: red", "Copyright", "Home", "hidden", "Docs"} {
+		if strings.Contains(md, unwanted) {
+			t.Errorf("did not expect %q in:\n%s", unwanted, md)
+		}
+	}
+}
+
+func TestHTMLToMarkdownAnchors(t *testing.T) {
+	md := htmlToMarkdown(`<p><a href="#top">Back to top</a> and <a href='/rel'>relative</a></p>`)
+	if !strings.Contains(md, "Back to top and [relative](/rel)") {
+		t.Errorf("unexpected anchors: %q", md)
+	}
+}
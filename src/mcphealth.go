@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+const defaultMCPTimeout = time.Minute
+
+// MCPProbe starts an MCP server and returns the tools it exposes.
+type MCPProbe func(server MCPServer, env []string, timeout time.Duration) ([]mcpTool, error)
+
+// checkMCPServers probes every server before the agent starts. A failing server
+// is dropped with a warning when it is optional and fails the run otherwise.
+// Servers listed in skip (e.g. the built-in one) are passed through unchecked.
+func checkMCPServers(probe MCPProbe, servers map[string]MCPServer, optional map[string]bool, skip []string, env []string, timeout time.Duration) (map[string]MCPServer, error) {
+	names := make([]string, 0, len(servers))
+	for name := range servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	healthy := make(map[string]MCPServer, len(servers))
+	defer logGroup("Checking MCP servers")()
+	for _, name := range names {
+		server := servers[name]
+		if containsString(skip, name) || server.URL != "" {
+			// Remote servers are reached by the agent over HTTP, not spawned.
+			healthy[name] = server
+			continue
+		}
+		tools, err := probe(server, env, timeout)
+		if err != nil {
+			if optional[name] {
+				logWarn("Optional MCP server %s failed its health check and was dropped: %v", name, err)
+				continue
+			}
+			return nil, fmt.Errorf("MCP server %s failed its health check: %w", name, err)
+		}
+		toolNames := make([]string, len(tools))
+		for i, tool := range tools {
+			toolNames[i] = tool.Name
+		}
+		logInfo("MCP server %s: %d tools (%s)", name, len(tools), strings.Join(toolNames, ", "))
+		healthy[name] = server
+	}
+	return healthy, nil
+}
+
+// probeMCPServer spawns server and performs the initialize and tools/list
+// handshake over stdio. The process is killed once the handshake is done or
+// the timeout expires.
+func probeMCPServer(server MCPServer, env []string, timeout time.Duration) ([]mcpTool, error) {
+	if timeout <= 0 {
+		timeout = defaultMCPTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, server.Command, server.Args...)
+	cmd.Env = env
+	if len(server.Env) > 0 {
+		if env == nil {
+			env = os.Environ()
+		}
+		cmd.Env = overrideEnv(env, server.Env)
+	}
+	// npx leaves node holding the pipes when it is killed; don't wait on them forever.
+	cmd.WaitDelay = time.Second
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", server.Command, err)
+	}
+
+	type handshake struct {
+		tools []mcpTool
+		err   error
+	}
+	done := make(chan handshake, 1)
+	go func() {
+		tools, err := mcpHandshake(stdin, stdout)
+		done <- handshake{tools, err}
+	}()
+	var tools []mcpTool
+	select {
+	case result := <-done:
+		tools, err = result.tools, result.err
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	// Stderr is complete only once the process has been waited for.
+	stdin.Close()
+	cmd.Process.Kill()
+	cmd.Wait()
+	if err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("no response within %s", timeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, lastLine(msg))
+		}
+		return nil, err
+	}
+	return tools, nil
+}
+
+// mcpHandshake runs the client side of initialize and tools/list.
+func mcpHandshake(in io.Writer, out io.Reader) ([]mcpTool, error) {
+	encoder := json.NewEncoder(in)
+	scanner := bufio.NewScanner(out)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	call := func(id int, method string, params interface{}) (json.RawMessage, error) {
+		if err := encoder.Encode(map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method, "params": params}); err != nil {
+			return nil, fmt.Errorf("%s: %w", method, err)
+		}
+		for scanner.Scan() {
+			var resp struct {
+				ID     json.RawMessage `json:"id"`
+				Result json.RawMessage `json:"result"`
+				Error  *rpcError       `json:"error"`
+			}
+			// Servers may log or send notifications; wait for our response.
+			if json.Unmarshal(scanner.Bytes(), &resp) != nil || string(resp.ID) != fmt.Sprint(id) {
+				continue
+			}
+			if resp.Error != nil {
+				return nil, fmt.Errorf("%s: %s (%d)", method, resp.Error.Message, resp.Error.Code)
+			}
+			return resp.Result, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("%s: %w", method, err)
+		}
+		return nil, fmt.Errorf("%s: server exited without responding", method)
+	}
+
+	if _, err := call(1, "initialize", map[string]interface{}{
+		"protocolVersion": mcpProtocolVersion,
+		"capabilities":    map[string]interface{}{},
+		"clientInfo":      map[string]string{"name": builtinMCPName, "version": version},
+	}); err != nil {
+		return nil, err
+	}
+	if err := encoder.Encode(map[string]string{"jsonrpc": "2.0", "method": "notifications/initialized"}); err != nil {
+		return nil, err
+	}
+	result, err := call(2, "tools/list", map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	var list struct {
+		Tools []mcpTool `json:"tools"`
+	}
+	if err := json.Unmarshal(result, &list); err != nil {
+		return nil, fmt.Errorf("tools/list: %w", err)
+	}
+	return list.Tools, nil
+}
+
+func lastLine(text string) string {
+	lines := strings.Split(text, "\n")
+	return lines[len(lines)-1]
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHelperMCPServer is not a real test: probeMCPServer spawns the test
+// binary with GO_WANT_MCP_HELPER set to act as an MCP server.
+func TestHelperMCPServer(t *testing.T) {
+	switch os.Getenv("GO_WANT_MCP_HELPER") {
+	case "serve":
+		(&auditMCPServer{}).Serve(os.Stdin, os.Stdout)
+		os.Exit(0)
+	case "hang":
+		time.Sleep(time.Minute)
+		os.Exit(0)
+	case "crash":
+		fmt.Fprintln(os.Stderr, "Error: Cannot find module '@example/missing'")
+		os.Exit(1)
+	}
+}
+
+func helperServer(mode string) (MCPServer, []string) {
+	return MCPServer{Command: os.Args[0], Args: []string{"-test.run=^TestHelperMCPServer$"}},
+		append(os.Environ(), "GO_WANT_MCP_HELPER="+mode)
+}
+
+func TestProbeMCPServer(t *testing.T) {
+	t.Run("Lists tools", func(t *testing.T) {
+		server, env := helperServer("serve")
+		tools, err := probeMCPServer(server, env, 10*time.Second)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(tools) != 6 || tools[len(tools)-1].Name != "report_finding" {
+			t.Errorf("unexpected tools %+v", tools)
+		}
+	})
+
+	t.Run("Server env is injected", func(t *testing.T) {
+		server, _ := helperServer("")
+		server.Env = map[string]string{"GO_WANT_MCP_HELPER": "serve"}
+		if _, err := probeMCPServer(server, os.Environ(), 10*time.Second); err != nil {
+			t.Errorf("server env should reach the process: %v", err)
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		server, env := helperServer("hang")
+		_, err := probeMCPServer(server, env, 200*time.Millisecond)
+		if err == nil || !strings.Contains(err.Error(), "no response within 200ms") {
+			t.Errorf("expected timeout error, got %v", err)
+		}
+	})
+
+	t.Run("Crash reports stderr", func(t *testing.T) {
+		server, env := helperServer("crash")
+		_, err := probeMCPServer(server, env, 10*time.Second)
+		if err == nil || !strings.Contains(err.Error(), "Cannot find module") {
+			t.Errorf("expected stderr in error, got %v", err)
+		}
+	})
+
+	t.Run("Missing command", func(t *testing.T) {
+		_, err := probeMCPServer(MCPServer{Command: "agentic-audits-no-such-command"}, nil, time.Second)
+		if err == nil || !strings.Contains(err.Error(), "failed to start") {
+			t.Errorf("expected start error, got %v", err)
+		}
+	})
+}
+
+func TestMCPHandshake(t *testing.T) {
+	clientIn, serverOut := io.Pipe()
+	serverIn, clientOut := io.Pipe()
+	go func() {
+		(&auditMCPServer{}).Serve(serverIn, serverOut)
+		serverOut.Close()
+	}()
+	defer clientOut.Close()
+
+	tools, err := mcpHandshake(clientOut, clientIn)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tools) == 0 || tools[0].Name != "list_web_sources" {
+		t.Errorf("unexpected tools %+v", tools)
+	}
+}
+
+func TestCheckMCPServers(t *testing.T) {
+	servers := map[string]MCPServer{
+		"good":         {Command: "npx", Args: []string{"-y", "good"}},
+		"flaky":        {Command: "npx", Args: []string{"-y", "flaky"}},
+		"broken":       {Command: "npx", Args: []string{"-y", "broken"}},
+		builtinMCPName: {Command: "agentic-audits"},
+	}
+	var probed []string
+	probe := func(server MCPServer, env []string, timeout time.Duration) ([]mcpTool, error) {
+		probed = append(probed, server.Args[1])
+		if server.Args[1] == "good" {
+			return []mcpTool{{Name: "search"}}, nil
+		}
+		return nil, fmt.Errorf("exited")
+	}
+
+	t.Run("Optional failures are dropped", func(t *testing.T) {
+		delete(servers, "broken")
+		defer func() { servers["broken"] = MCPServer{Command: "npx", Args: []string{"-y", "broken"}} }()
+		healthy, err := checkMCPServers(probe, servers, map[string]bool{"flaky": true}, []string{builtinMCPName}, nil, time.Second)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, ok := healthy["flaky"]; ok || len(healthy) != 2 {
+			t.Errorf("expected good and built-in servers only, got %v", healthy)
+		}
+	})
+
+	t.Run("Required failures are fatal", func(t *testing.T) {
+		probed = nil
+		_, err := checkMCPServers(probe, servers, map[string]bool{"flaky": true}, []string{builtinMCPName}, nil, time.Second)
+		if err == nil || !strings.Contains(err.Error(), "MCP server broken failed its health check") {
+			t.Errorf("expected fatal error, got %v", err)
+		}
+		if len(probed) != 1 || probed[0] != "broken" {
+			t.Errorf("servers should be probed in name order, got %v", probed)
+		}
+	})
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	mcpProtocolVersion = "2024-11-05"
+	builtinMCPName     = "agentic-audits"
+)
+
+// JSON-RPC 2.0 messages as used by MCP's stdio transport (one JSON object per line).
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type mcpTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+}
+
+type mcpContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type mcpToolResult struct {
+	Content []mcpContent `json:"content"`
+	IsError bool         `json:"isError,omitempty"`
+}
+
+// Finding is a structured result reported by the agent through report_finding.
+type Finding struct {
+	Title          string `json:"title"`
+	Severity       string `json:"severity"`
+	File           string `json:"file,omitempty"`
+	Line           int    `json:"line,omitempty"`
+	Description    string `json:"description"`
+	Recommendation string `json:"recommendation,omitempty"`
+}
+
+var findingSeverities = []string{"info", "low", "medium", "high", "critical"}
+
+// auditMCPServer is the built-in MCP server `run` registers for the agent. It
+// serves the fetched web sources, the repository's templates and the outputs
+// of earlier missions, and records findings reported by the agent.
+type auditMCPServer struct {
+	WebDir       string
+	TemplatesDir string
+	OutputsFile  string
+	ReportFile   string
+
+	mu sync.Mutex
+}
+
+// runMCPServer implements the `mcp-server` subcommand.
+func runMCPServer(args []string, in io.Reader, out io.Writer) error {
+	fs := flag.NewFlagSet("mcp-server", flag.ContinueOnError)
+	server := &auditMCPServer{}
+	fs.StringVar(&server.WebDir, "web-dir", "", "Directory of fetched web sources")
+	fs.StringVar(&server.TemplatesDir, "templates-dir", filepath.Join(".github", "templates"), "Directory of mission and PR templates")
+	fs.StringVar(&server.OutputsFile, "outputs-file", "", "JSON file with the outputs of earlier missions")
+	fs.StringVar(&server.ReportFile, "report-file", "", "JSON-lines file report_finding appends to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected positional arguments %q", fs.Args())
+	}
+	return server.Serve(in, out)
+}
+
+// Serve handles requests until in is closed. Notifications get no response.
+func (s *auditMCPServer) Serve(in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	encoder := json.NewEncoder(out)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var req rpcRequest
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			encoder.Encode(rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: -32700, Message: "parse error"}})
+			continue
+		}
+		result, rpcErr := s.handle(req)
+		if len(req.ID) == 0 {
+			continue
+		}
+		resp := rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: result, Error: rpcErr}
+		if rpcErr == nil && result == nil {
+			resp.Result = struct{}{}
+		}
+		if err := encoder.Encode(resp); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func (s *auditMCPServer) handle(req rpcRequest) (interface{}, *rpcError) {
+	switch req.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"protocolVersion": mcpProtocolVersion,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]string{"name": builtinMCPName, "version": version},
+		}, nil
+	case "ping":
+		return nil, nil
+	case "tools/list":
+		return map[string]interface{}{"tools": s.tools()}, nil
+	case "tools/call":
+		var params struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &rpcError{Code: -32602, Message: "invalid params"}
+		}
+		text, err := s.callTool(params.Name, params.Arguments)
+		if err != nil {
+			return mcpToolResult{Content: []mcpContent{{Type: "text", Text: err.Error()}}, IsError: true}, nil
+		}
+		return mcpToolResult{Content: []mcpContent{{Type: "text", Text: text}}}, nil
+	default:
+		if strings.HasPrefix(req.Method, "notifications/") {
+			return nil, nil
+		}
+		return nil, &rpcError{Code: -32601, Message: "method not found: " + req.Method}
+	}
+}
+
+func (s *auditMCPServer) tools() []mcpTool {
+	noArgs := map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+	nameArg := func(description string) map[string]interface{} {
+		return map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{"name": map[string]string{"type": "string", "description": description}},
+			"required":   []string{"name"},
+		}
+	}
+	return []mcpTool{
+		{Name: "list_web_sources", Description: "List the documentation pages fetched from the configured web sources.", InputSchema: noArgs},
+		{Name: "read_web_source", Description: "Read a fetched documentation page as Markdown.", InputSchema: nameArg("Name from list_web_sources")},
+		{Name: "list_templates", Description: "List the repository's mission and PR templates.", InputSchema: noArgs},
+		{Name: "read_template", Description: "Read a repository template.", InputSchema: nameArg("Name from list_templates, e.g. skills-audit or pr/body")},
+		{Name: "get_prior_findings", Description: "Get the structured outputs of the missions this one depends on.", InputSchema: noArgs},
+		{Name: "report_finding", Description: "Record one finding of this mission. Call once per finding; findings are included in the Pull Request.", InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"title":          map[string]string{"type": "string"},
+				"severity":       map[string]interface{}{"type": "string", "enum": findingSeverities},
+				"file":           map[string]string{"type": "string", "description": "Repository-relative path"},
+				"line":           map[string]string{"type": "integer"},
+				"description":    map[string]string{"type": "string"},
+				"recommendation": map[string]string{"type": "string"},
+			},
+			"required": []string{"title", "severity", "description"},
+		}},
+	}
+}
+
+func (s *auditMCPServer) callTool(name string, args json.RawMessage) (string, error) {
+	var named struct {
+		Name string `json:"name"`
+	}
+	switch name {
+	case "list_web_sources":
+		return listMarkdownFiles(s.WebDir)
+	case "read_web_source":
+		json.Unmarshal(args, &named)
+		return readWithin(s.WebDir, named.Name+".md")
+	case "list_templates":
+		return listMarkdownFiles(s.TemplatesDir)
+	case "read_template":
+		json.Unmarshal(args, &named)
+		return readWithin(s.TemplatesDir, named.Name+".md")
+	case "get_prior_findings":
+		if s.OutputsFile == "" {
+			return "[]", nil
+		}
+		data, err := os.ReadFile(s.OutputsFile)
+		if os.IsNotExist(err) {
+			return "[]", nil
+		}
+		return string(data), err
+	case "report_finding":
+		return s.reportFinding(args)
+	default:
+		return "", fmt.Errorf("unknown tool %q", name)
+	}
+}
+
+func (s *auditMCPServer) reportFinding(args json.RawMessage) (string, error) {
+	var finding Finding
+	if err := json.Unmarshal(args, &finding); err != nil {
+		return "", fmt.Errorf("invalid finding: %w", err)
+	}
+	finding.Severity = strings.ToLower(finding.Severity)
+	if finding.Title == "" || finding.Description == "" {
+		return "", fmt.Errorf("a finding needs a title and a description")
+	}
+	if !containsString(findingSeverities, finding.Severity) {
+		return "", fmt.Errorf("severity must be one of %s", strings.Join(findingSeverities, ", "))
+	}
+	if s.ReportFile == "" {
+		return "", fmt.Errorf("this server was started without a report file")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.ReportFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", fmt.Errorf("failed to record finding: %w", err)
+	}
+	defer f.Close()
+	line, _ := json.Marshal(finding)
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return "", fmt.Errorf("failed to record finding: %w", err)
+	}
+	return "Recorded finding: " + finding.Title, nil
+}
+
+// readReportedFindings loads the findings the agent reported, skipping bad lines.
+func readReportedFindings(path string) []Finding {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var findings []Finding
+	for _, line := range strings.Split(string(data), "\n") {
+		var finding Finding
+		if line = strings.TrimSpace(line); line != "" && json.Unmarshal([]byte(line), &finding) == nil {
+			findings = append(findings, finding)
+		}
+	}
+	return findings
+}
+
+// listMarkdownFiles lists *.md files below dir by name without the extension.
+func listMarkdownFiles(dir string) (string, error) {
+	if dir == "" {
+		return "", nil
+	}
+	var names []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(path, ".md") {
+			rel, _ := filepath.Rel(dir, path)
+			names = append(names, strings.TrimSuffix(filepath.ToSlash(rel), ".md"))
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	sort.Strings(names)
+	return strings.Join(names, "\n"), nil
+}
+
+// readWithin reads name relative to dir, refusing paths that escape it.
+func readWithin(dir, name string) (string, error) {
+	if dir == "" {
+		return "", fmt.Errorf("not available in this run")
+	}
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if rel, err := filepath.Rel(dir, path); err != nil || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("%q is outside %s", name, dir)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("%s not found", strings.TrimSuffix(name, ".md"))
+	}
+	return string(data), nil
+}
+
+func containsString(items []string, value string) bool {
+	for _, item := range items {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
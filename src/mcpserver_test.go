@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// mcpSession sends requests to the server and returns the decoded responses by id.
+func mcpSession(t *testing.T, server *auditMCPServer, requests ...string) map[string]rpcResponse {
+	t.Helper()
+	var out strings.Builder
+	if err := server.Serve(strings.NewReader(strings.Join(requests, "\n")+"\n"), &out); err != nil {
+		t.Fatalf("serve failed: %v", err)
+	}
+	responses := make(map[string]rpcResponse)
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var resp struct {
+			rpcResponse
+			Result json.RawMessage `json:"result"`
+		}
+		if err := json.Unmarshal([]byte(line), &resp); err != nil {
+			t.Fatalf("invalid response %q: %v", line, err)
+		}
+		resp.rpcResponse.Result = resp.Result
+		responses[string(resp.ID)] = resp.rpcResponse
+	}
+	return responses
+}
+
+func toolText(t *testing.T, resp rpcResponse) (string, bool) {
+	t.Helper()
+	var result mcpToolResult
+	if err := json.Unmarshal(resp.Result.(json.RawMessage), &result); err != nil || len(result.Content) != 1 {
+		t.Fatalf("unexpected tool result %s", resp.Result)
+	}
+	return result.Content[0].Text, result.IsError
+}
+
+func TestAuditMCPServer(t *testing.T) {
+	dir := t.TempDir()
+	webDir := filepath.Join(dir, "web")
+	templatesDir := filepath.Join(dir, "templates")
+	os.MkdirAll(webDir, 0755)
+	os.MkdirAll(filepath.Join(templatesDir, "pr"), 0755)
+	os.WriteFile(filepath.Join(webDir, "guide.md"), []byte("# Guide"), 0644)
+	os.WriteFile(filepath.Join(templatesDir, "skills-audit.md"), []byte("Audit the skills."), 0644)
+	os.WriteFile(filepath.Join(templatesDir, "pr", "body.md"), []byte("Body"), 0644)
+	outputsFile := filepath.Join(dir, "prior.json")
+	os.WriteFile(outputsFile, []byte(`[{"name":"audit"}]`), 0644)
+
+	server := &auditMCPServer{
+		WebDir:       webDir,
+		TemplatesDir: templatesDir,
+		OutputsFile:  outputsFile,
+		ReportFile:   filepath.Join(dir, "findings.jsonl"),
+	}
+
+	t.Run("Handshake and tool list", func(t *testing.T) {
+		responses := mcpSession(t, server,
+			`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05"}}`,
+			`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+			`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+			`{"jsonrpc":"2.0","id":3,"method":"resources/list"}`,
+			`not json`,
+		)
+		if len(responses) != 4 {
+			t.Fatalf("notifications must not be answered, got %d responses", len(responses))
+		}
+		if !strings.Contains(string(responses["1"].Result.(json.RawMessage)), mcpProtocolVersion) {
+			t.Errorf("unexpected initialize result %s", responses["1"].Result)
+		}
+		tools := string(responses["2"].Result.(json.RawMessage))
+		for _, name := range []string{"list_web_sources", "read_web_source", "list_templates", "read_template", "get_prior_findings", "report_finding"} {
+			if !strings.Contains(tools, `"`+name+`"`) {
+				t.Errorf("tool %s missing from %s", name, tools)
+			}
+		}
+		if responses["3"].Error == nil || responses["3"].Error.Code != -32601 {
+			t.Errorf("expected method not found, got %+v", responses["3"])
+		}
+		if responses["null"].Error == nil || responses["null"].Error.Code != -32700 {
+			t.Errorf("expected parse error, got %+v", responses["null"])
+		}
+	})
+
+	t.Run("Read tools", func(t *testing.T) {
+		responses := mcpSession(t, server,
+			`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"list_templates"}}`,
+			`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"read_template","arguments":{"name":"pr/body"}}}`,
+			`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"read_web_source","arguments":{"name":"guide"}}}`,
+			`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"read_template","arguments":{"name":"../web/guide"}}}`,
+			`{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"get_prior_findings"}}`,
+		)
+		if text, _ := toolText(t, responses["1"]); text != "pr/body\nskills-audit" {
+			t.Errorf("unexpected template list %q", text)
+		}
+		if text, _ := toolText(t, responses["2"]); text != "Body" {
+			t.Errorf("unexpected template %q", text)
+		}
+		if text, _ := toolText(t, responses["3"]); text != "# Guide" {
+			t.Errorf("unexpected web source %q", text)
+		}
+		if _, isError := toolText(t, responses["4"]); !isError {
+			t.Error("paths outside the templates dir must be refused")
+		}
+		if text, _ := toolText(t, responses["5"]); !strings.Contains(text, `"audit"`) {
+			t.Errorf("unexpected prior findings %q", text)
+		}
+	})
+
+	t.Run("Report findings", func(t *testing.T) {
+		responses := mcpSession(t, server,
+			`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"report_finding","arguments":{"title":"Stale skill","severity":"High","file":"a.md","line":3,"description":"Outdated."}}}`,
+			`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"report_finding","arguments":{"title":"Bad","severity":"urgent","description":"x"}}}`,
+			`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"report_finding","arguments":{"severity":"low"}}}`,
+		)
+		if _, isError := toolText(t, responses["1"]); isError {
+			t.Error("valid finding was rejected")
+		}
+		for _, id := range []string{"2", "3"} {
+			if _, isError := toolText(t, responses[id]); !isError {
+				t.Errorf("invalid finding %s was accepted", id)
+			}
+		}
+		findings := readReportedFindings(server.ReportFile)
+		want := Finding{Title: "Stale skill", Severity: "high", File: "a.md", Line: 3, Description: "Outdated."}
+		if len(findings) != 1 || findings[0] != want {
+			t.Errorf("unexpected findings %+v", findings)
+		}
+	})
+}
+
+func TestRunMCPServerFlags(t *testing.T) {
+	var out strings.Builder
+	err := runMCPServer([]string{"--report-file", "x.jsonl", "extra"}, strings.NewReader(""), &out)
+	if err == nil || !strings.Contains(err.Error(), "positional") {
+		t.Errorf("expected positional argument error, got %v", err)
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const defaultMissionsFile = ".github/agentic-audits.yml"
+
+// MissionsFile is the declarative mission config, by default
+// .github/agentic-audits.yml. Its JSON Schema is agentic-audits.schema.json.
+type MissionsFile struct {
+	Defaults MissionSpec            `yaml:"defaults"`
+	Missions map[string]MissionSpec `yaml:"missions"`
+
+	path string
+}
+
+// MissionSpec declares everything one mission needs. Empty fields fall back
+// to the file's defaults, then to the regular inputs.
+type MissionSpec struct {
+	Description   string            `yaml:"description"`
+	DependsOn     []string          `yaml:"depends_on"`
+	Template      string            `yaml:"template"`
+	Prompt        string            `yaml:"prompt"`
+	Model         string            `yaml:"model"`
+	FallbackModel string            `yaml:"fallback_model"`
+	Context       []string          `yaml:"context"`
+	SourcesConfig string            `yaml:"sources_config"`
+	Sources       []Source          `yaml:"sources"`
+	PR            MissionPR         `yaml:"pr"`
+	Guardrails    MissionGuardrails `yaml:"guardrails"`
+	Schedule      MissionSchedule   `yaml:"schedule"`
+}
+
+type MissionPR struct {
+	Title         string   `yaml:"title"`
+	Body          string   `yaml:"body"`
+	TitleTemplate string   `yaml:"title_template"`
+	BodyTemplate  string   `yaml:"body_template"`
+	Base          string   `yaml:"base"`
+	Branch        string   `yaml:"branch"`
+	Labels        []string `yaml:"labels"`
+}
+
+type MissionGuardrails struct {
+	DryRun          *bool    `yaml:"dry_run"`
+	Timeout         string   `yaml:"timeout"`
+	MaxChangedFiles int      `yaml:"max_changed_files"`
+	AllowedPaths    []string `yaml:"allowed_paths"`
+	// Usage budgets; the mission fails once an attempt exceeds them.
+	MaxPremiumRequests float64 `yaml:"max_premium_requests"`
+	MaxTokens          int64   `yaml:"max_tokens"`
+}
+
+// MissionSchedule is informational; workflows still own their triggers.
+type MissionSchedule struct {
+	Cron     string `yaml:"cron"`
+	Timezone string `yaml:"timezone"`
+}
+
+func loadMissionsFile(path string) (*MissionsFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read missions file: %w", err)
+	}
+
+	var file MissionsFile
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("invalid missions file %s: %w", path, err)
+	}
+
+	file.path = path
+
+	names := make([]string, 0, len(file.Missions))
+	for name := range file.Missions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := file.Mission(name).validate(); err != nil {
+			return nil, fmt.Errorf("mission %q in %s: %w", name, path, err)
+		}
+		for _, dep := range file.Missions[name].DependsOn {
+			if _, ok := file.Missions[dep]; !ok {
+				return nil, fmt.Errorf("mission %q in %s depends on undefined mission %q", name, path, dep)
+			}
+		}
+	}
+	if _, err := file.Plan(names); err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// Plan orders the requested missions, and the missions they depend on, so
+// every mission runs after its dependencies. Otherwise request order is kept.
+func (f *MissionsFile) Plan(names []string) ([]string, error) {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int)
+	var order []string
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		if _, ok := f.Missions[name]; !ok {
+			return fmt.Errorf("mission %q is not defined in %s", name, f.path)
+		}
+		switch state[name] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("missions in %s have a dependency cycle: %s", f.path, strings.Join(append(path, name), " -> "))
+		}
+		state[name] = visiting
+		for _, dep := range f.Missions[name].DependsOn {
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = done
+		order = append(order, name)
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// Mission returns the named mission merged over the file's defaults.
+func (f *MissionsFile) Mission(name string) MissionSpec {
+	spec := f.Missions[name]
+	d := f.Defaults
+
+	if spec.Template == "" && spec.Prompt == "" {
+		spec.Template, spec.Prompt = d.Template, d.Prompt
+	}
+	spec.Model = firstNonEmpty(spec.Model, d.Model)
+	spec.FallbackModel = firstNonEmpty(spec.FallbackModel, d.FallbackModel)
+	if len(spec.Context) == 0 {
+		spec.Context = d.Context
+	}
+	if spec.SourcesConfig == "" && len(spec.Sources) == 0 {
+		spec.SourcesConfig, spec.Sources = d.SourcesConfig, d.Sources
+	}
+
+	spec.PR.Title = firstNonEmpty(spec.PR.Title, d.PR.Title)
+	spec.PR.Body = firstNonEmpty(spec.PR.Body, d.PR.Body)
+	spec.PR.TitleTemplate = firstNonEmpty(spec.PR.TitleTemplate, d.PR.TitleTemplate)
+	spec.PR.BodyTemplate = firstNonEmpty(spec.PR.BodyTemplate, d.PR.BodyTemplate)
+	spec.PR.Base = firstNonEmpty(spec.PR.Base, d.PR.Base)
+	spec.PR.Branch = firstNonEmpty(spec.PR.Branch, d.PR.Branch)
+	if len(spec.PR.Labels) == 0 {
+		spec.PR.Labels = d.PR.Labels
+	}
+
+	if spec.Guardrails.DryRun == nil {
+		spec.Guardrails.DryRun = d.Guardrails.DryRun
+	}
+	spec.Guardrails.Timeout = firstNonEmpty(spec.Guardrails.Timeout, d.Guardrails.Timeout)
+	if spec.Guardrails.MaxChangedFiles == 0 {
+		spec.Guardrails.MaxChangedFiles = d.Guardrails.MaxChangedFiles
+	}
+	if len(spec.Guardrails.AllowedPaths) == 0 {
+		spec.Guardrails.AllowedPaths = d.Guardrails.AllowedPaths
+	}
+	if spec.Guardrails.MaxPremiumRequests == 0 {
+		spec.Guardrails.MaxPremiumRequests = d.Guardrails.MaxPremiumRequests
+	}
+	if spec.Guardrails.MaxTokens == 0 {
+		spec.Guardrails.MaxTokens = d.Guardrails.MaxTokens
+	}
+	return spec
+}
+
+func (m MissionSpec) validate() error {
+	if (m.Template == "") == (m.Prompt == "") {
+		return fmt.Errorf("exactly one of 'template' or 'prompt' is required")
+	}
+	if m.SourcesConfig != "" && len(m.Sources) > 0 {
+		return fmt.Errorf("'sources' and 'sources_config' are mutually exclusive")
+	}
+	for _, source := range m.Sources {
+		// Source decodes itself, so the missions file's strict decoding
+		// doesn't reach its keys.
+		for _, key := range source.keys {
+			if !containsString(sourceKeys, key) {
+				return fmt.Errorf("source %s: unknown key %q", source.Name, key)
+			}
+		}
+		if source.When != "" {
+			if _, err := parseCondition(source.When); err != nil {
+				return fmt.Errorf("source %s: %w", source.Name, err)
+			}
+		}
+	}
+	if m.Guardrails.Timeout != "" {
+		if _, err := time.ParseDuration(m.Guardrails.Timeout); err != nil {
+			return fmt.Errorf("invalid guardrails.timeout: %w", err)
+		}
+	}
+	if m.Guardrails.MaxChangedFiles < 0 {
+		return fmt.Errorf("guardrails.max_changed_files must not be negative")
+	}
+	if m.Guardrails.MaxPremiumRequests < 0 || m.Guardrails.MaxTokens < 0 {
+		return fmt.Errorf("guardrails.max_premium_requests and max_tokens must not be negative")
+	}
+	if m.Schedule.Cron != "" && len(strings.Fields(m.Schedule.Cron)) != 5 {
+		return fmt.Errorf("schedule.cron %q must have five fields", m.Schedule.Cron)
+	}
+	return nil
+}
+
+// flagValues maps the mission onto run flags so it layers like a config file.
+func (m MissionSpec) flagValues() map[string]interface{} {
+	values := make(map[string]interface{})
+	set := func(name, value string) {
+		if value != "" {
+			values[name] = value
+		}
+	}
+	set("template", m.Template)
+	set("mission", m.Prompt)
+	set("model", m.Model)
+	set("fallback-model", m.FallbackModel)
+	set("context-files", strings.Join(m.Context, ", "))
+	set("sources-config", m.SourcesConfig)
+	set("pr-title", m.PR.Title)
+	set("pr-body", m.PR.Body)
+	set("pr-title-template", m.PR.TitleTemplate)
+	set("pr-body-template", m.PR.BodyTemplate)
+	set("pr-base", m.PR.Base)
+	set("pr-branch", m.PR.Branch)
+	set("pr-labels", strings.Join(m.PR.Labels, ","))
+	set("timeout", m.Guardrails.Timeout)
+	set("allowed-paths", strings.Join(m.Guardrails.AllowedPaths, ","))
+	if m.Guardrails.DryRun != nil {
+		values["dry-run"] = *m.Guardrails.DryRun
+	}
+	if m.Guardrails.MaxChangedFiles > 0 {
+		values["max-changed-files"] = m.Guardrails.MaxChangedFiles
+	}
+	if m.Guardrails.MaxPremiumRequests > 0 {
+		values["max-premium-requests"] = m.Guardrails.MaxPremiumRequests
+	}
+	if m.Guardrails.MaxTokens > 0 {
+		values["max-tokens"] = m.Guardrails.MaxTokens
+	}
+	return values
+}
+
+// checkGuardrails rejects changes that exceed the configured limits before a PR is opened.
+func checkGuardrails(changes GitChanges, maxChangedFiles int, allowedPaths []string) error {
+	if maxChangedFiles > 0 && len(changes.Files) > maxChangedFiles {
+		return fmt.Errorf("mission changed %d files, more than the allowed %d", len(changes.Files), maxChangedFiles)
+	}
+	if len(allowedPaths) == 0 {
+		return nil
+	}
+
+	var outside []string
+	for _, file := range changes.Files {
+		if !matchesAnyPath(file, allowedPaths) {
+			outside = append(outside, file)
+		}
+	}
+	if len(outside) > 0 {
+		return fmt.Errorf("mission changed files outside the allowed paths: %s", strings.Join(outside, ", "))
+	}
+	return nil
+}
+
+// matchesAnyPath matches glob patterns against the full path; patterns ending
+// in "/" or "/**" match everything below that directory.
+func matchesAnyPath(file string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if dir := strings.TrimSuffix(strings.TrimSuffix(pattern, "**"), "/"); dir != pattern && dir != "" {
+			if strings.HasPrefix(file, dir+"/") {
+				return true
+			}
+			continue
+		}
+		if ok, _ := filepath.Match(pattern, file); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
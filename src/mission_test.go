@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testMissionsYAML = `
+defaults:
+  model: base-model
+  pr:
+    base: develop
+    labels: [automated-pr]
+  guardrails:
+    timeout: 10m
+missions:
+  skills-audit:
+    template: skills-audit
+    context: ["**/skills/*.md", docs]
+    pr:
+      labels: [skills]
+    guardrails:
+      dry_run: false
+      max_changed_files: 5
+      allowed_paths: [.github/skills/]
+    schedule:
+      cron: "0 7 * * 1"
+  readme:
+    prompt: Improve the README
+    model: other-model
+    sources:
+      - name: docs
+        type: web
+        url: https://example.com/docs
+        enabled: true
+`
+
+func writeMissionsFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "agentic-audits.yml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadMissionsFile(t *testing.T) {
+	t.Run("Valid file merges defaults", func(t *testing.T) {
+		file, err := loadMissionsFile(writeMissionsFile(t, testMissionsYAML))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		audit := file.Mission("skills-audit")
+		if audit.Model != "base-model" || audit.PR.Base != "develop" || audit.Guardrails.Timeout != "10m" {
+			t.Errorf("defaults not applied: %+v", audit)
+		}
+		if !reflect.DeepEqual(audit.PR.Labels, []string{"skills"}) {
+			t.Errorf("mission labels should replace defaults, got %v", audit.PR.Labels)
+		}
+		if file.Mission("readme").Model != "other-model" {
+			t.Error("mission model should override the default")
+		}
+	})
+
+	t.Run("Invalid missions", func(t *testing.T) {
+		tests := map[string]string{
+			"unknown key":         "missions:\n  a:\n    template: x\n    modle: y\n",
+			"unknown source key":  "missions:\n  a:\n    template: x\n    sources:\n      - name: s\n        pakage: y\n",
+			"template and prompt": "missions:\n  a:\n    template: x\n    prompt: y\n",
+			"no template":         "missions:\n  a:\n    model: y\n",
+			"bad timeout":         "missions:\n  a:\n    template: x\n    guardrails:\n      timeout: soon\n",
+			"bad cron":            "missions:\n  a:\n    template: x\n    schedule:\n      cron: weekly\n",
+		}
+		for name, content := range tests {
+			if _, err := loadMissionsFile(writeMissionsFile(t, content)); err == nil {
+				t.Errorf("%s: expected error", name)
+			}
+		}
+	})
+
+	t.Run("Missing file", func(t *testing.T) {
+		if _, err := loadMissionsFile(filepath.Join(t.TempDir(), "missing.yml")); err == nil {
+			t.Error("expected error for missing file")
+		}
+	})
+}
+
+func TestMissionsPlan(t *testing.T) {
+	file, err := loadMissionsFile(writeMissionsFile(t, `
+missions:
+  audit: {prompt: a}
+  docs: {prompt: d, depends_on: [audit]}
+  release: {prompt: r, depends_on: [docs, audit]}
+  lint: {prompt: l}
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	order, err := file.Plan([]string{"lint", "release"})
+	if err != nil || strings.Join(order, ",") != "lint,audit,docs,release" {
+		t.Errorf("unexpected order %v (%v)", order, err)
+	}
+	order, _ = file.Plan([]string{"docs", "audit"})
+	if strings.Join(order, ",") != "audit,docs" {
+		t.Errorf("each mission should run once, after its dependencies: %v", order)
+	}
+	if _, err := file.Plan([]string{"nope"}); err == nil {
+		t.Error("expected error for undefined mission")
+	}
+
+	cyclic := "missions:\n  a: {prompt: a, depends_on: [b]}\n  b: {prompt: b, depends_on: [a]}\n"
+	if _, err := loadMissionsFile(writeMissionsFile(t, cyclic)); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("expected cycle error, got %v", err)
+	}
+	dangling := "missions:\n  a: {prompt: a, depends_on: [ghost]}\n"
+	if _, err := loadMissionsFile(writeMissionsFile(t, dangling)); err == nil || !strings.Contains(err.Error(), "ghost") {
+		t.Errorf("expected undefined dependency error, got %v", err)
+	}
+}
+
+func TestMissionNameConfig(t *testing.T) {
+	path := writeMissionsFile(t, testMissionsYAML)
+
+	t.Run("Mission fills unset inputs", func(t *testing.T) {
+		top, err := loadRunConfig([]string{"--missions-file", path, "--mission-name", "skills-audit"}, envLookup(nil))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		cfg := top.Plan[0]
+		if cfg.Template != "skills-audit" || cfg.Model != "base-model" || cfg.PRBase != "develop" {
+			t.Errorf("mission not applied: %+v", cfg)
+		}
+		if cfg.ContextFiles != "**/skills/*.md, docs" || cfg.MaxChangedFiles != 5 {
+			t.Errorf("unexpected context or guardrails: %q, %d", cfg.ContextFiles, cfg.MaxChangedFiles)
+		}
+		if cfg.Spec == nil || cfg.Spec.Schedule.Cron != "0 7 * * 1" {
+			t.Error("resolved spec should be kept on the config")
+		}
+	})
+
+	t.Run("Inputs override the mission", func(t *testing.T) {
+		top, err := loadRunConfig([]string{"--missions-file", path}, envLookup(map[string]string{
+			"INPUT_MISSION_NAME": "readme",
+			"INPUT_MODEL":        "input-model",
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		cfg := top.Plan[0]
+		if cfg.Mission != "Improve the README" || cfg.Model != "input-model" {
+			t.Errorf("unexpected config: %+v", cfg)
+		}
+	})
+
+	t.Run("Unknown mission", func(t *testing.T) {
+		_, err := loadRunConfig([]string{"--missions-file", path, "--mission-name", "nope"}, envLookup(nil))
+		if err == nil || !strings.Contains(err.Error(), "not defined") {
+			t.Errorf("expected unknown mission error, got %v", err)
+		}
+	})
+}
+
+func TestCheckGuardrails(t *testing.T) {
+	changes := GitChanges{Files: []string{".github/skills/a/SKILL.md", "README.md"}}
+
+	if err := checkGuardrails(changes, 0, nil); err != nil {
+		t.Errorf("no guardrails should pass, got %v", err)
+	}
+	if err := checkGuardrails(changes, 1, nil); err == nil {
+		t.Error("expected max changed files error")
+	}
+	err := checkGuardrails(changes, 0, []string{".github/skills/"})
+	if err == nil || !strings.Contains(err.Error(), "README.md") {
+		t.Errorf("expected README.md outside allowed paths, got %v", err)
+	}
+	if err := checkGuardrails(changes, 0, []string{".github/skills/**", "*.md"}); err != nil {
+		t.Errorf("expected all files allowed, got %v", err)
+	}
+}
+
+// The schema ships for editors; keep its keys in step with the structs.
+func TestMissionsSchemaMatchesStructs(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("..", "agentic-audits.schema.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+		Defs       map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+
+	check := func(def string, typ reflect.Type) {
+		var keys []string
+		for i := 0; i < typ.NumField(); i++ {
+			if key, _, _ := strings.Cut(typ.Field(i).Tag.Get("yaml"), ","); key != "-" {
+				keys = append(keys, key)
+			}
+		}
+		for _, key := range keys {
+			if _, ok := schema.Defs[def].Properties[key]; !ok {
+				t.Errorf("schema %s is missing %q", def, key)
+			}
+		}
+		if len(schema.Defs[def].Properties) != len(keys) {
+			t.Errorf("schema %s has %d properties, struct has %d", def, len(schema.Defs[def].Properties), len(keys))
+		}
+	}
+	check("mission", reflect.TypeOf(MissionSpec{}))
+	check("source", reflect.TypeOf(Source{}))
+	check("pr", reflect.TypeOf(MissionPR{}))
+	check("guardrails", reflect.TypeOf(MissionGuardrails{}))
+	check("schedule", reflect.TypeOf(MissionSchedule{}))
+	fileType := reflect.TypeOf(MissionsFile{})
+	for i := 0; i < fileType.NumField(); i++ {
+		if key := fileType.Field(i).Tag.Get("yaml"); key != "" {
+			if _, ok := schema.Properties[key]; !ok {
+				t.Errorf("schema is missing top-level %q", key)
+			}
+		}
+	}
+}
+
+func TestRepositoryMissionsFile(t *testing.T) {
+	if _, err := loadMissionsFile(filepath.Join("..", defaultMissionsFile)); err != nil {
+		t.Errorf("example missions file is invalid: %v", err)
+	}
+}
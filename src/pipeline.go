@@ -0,0 +1,357 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MissionOutput is the structured result of one mission. Missions that
+// depend on it receive it in their prompt.
+type MissionOutput struct {
+	Name         string   `json:"name"`
+	Model        string   `json:"model"`
+	Findings     string   `json:"findings"`
+	ChangedFiles []string `json:"changed_files"`
+	DiffStat     string   `json:"diff_stat"`
+	// Reported holds the findings the agent recorded with report_finding.
+	Reported []Finding `json:"reported_findings,omitempty"`
+	// Usage is what the agent backend reported for this mission's attempts.
+	Usage *UsageReport `json:"usage,omitempty"`
+}
+
+// missionRunner holds what every mission in a plan shares.
+type missionRunner struct {
+	Executor   CommandExecutor
+	HTTPClient HTTPClient
+	Env        []string
+	ConfigHome string
+	// RunDir holds per-run files: fetched web sources and the built-in MCP server's inputs and reports.
+	RunDir     string
+	ModelToken string
+	// OrgSources is the organization layer of every mission's sources.
+	OrgSources []Source
+	// ProbeMCP checks MCP servers before the agent starts; nil skips the check.
+	ProbeMCP MCPProbe
+}
+
+// findingsPath is where the agent writes its findings summary for the mission.
+func findingsPath(dir, mission string) string {
+	if mission == "" {
+		return filepath.Join(dir, "agentic-audits-findings.md")
+	}
+	return filepath.Join(dir, fmt.Sprintf("agentic-audits-findings-%s.md", mission))
+}
+
+// runMission runs one mission and returns its output and the changes it made
+// on top of whatever earlier missions left in the working tree. Its phases are
+// traced as children of span.
+func (r *missionRunner) runMission(cfg *RunConfig, previous []MissionOutput, span *Span) (MissionOutput, GitChanges, error) {
+	name := cfg.MissionName
+	if cfg.Spec != nil {
+		logInfo("Mission %q from %s", name, cfg.MissionsFile)
+		if cfg.Spec.Description != "" {
+			logInfo("%s", cfg.Spec.Description)
+		}
+		if cfg.Spec.Schedule.Cron != "" {
+			logInfo("Declared schedule: %s %s", cfg.Spec.Schedule.Cron, cfg.Spec.Schedule.Timezone)
+		}
+		outputEnv("MISSION_NAME", name)
+	}
+
+	// 1. Resolve Mission
+	resolvedMission, err := resolveMission(cfg.Mission, cfg.Template)
+	if err != nil {
+		return MissionOutput{}, GitChanges{}, err
+	}
+
+	// 2. Configure Sources
+	sourcesSpan := span.Child("sources")
+	sources, err := filterSources(r.effectiveSources(cfg), newSourceContext(cfg, ciProvider, os.LookupEnv))
+	if err != nil {
+		sourcesSpan.End(err)
+		return MissionOutput{}, GitChanges{}, err
+	}
+	processed := processSources(sources)
+
+	if err := pinMCPPackages(r.HTTPClient, &processed, cfg.SourcesLock, filepath.Join(r.RunDir, "npm")); err != nil {
+		sourcesSpan.End(err)
+		return MissionOutput{}, GitChanges{}, err
+	}
+	// Referenced secrets only reach their server through its config env; the
+	// agent and every other process get an environment without them.
+	childEnv := r.Env
+	if childEnv == nil {
+		childEnv = os.Environ()
+	}
+	childEnv = withoutEnv(childEnv, secretRefNames(processed.MCPServers)...)
+	if err := resolveSecretRefs(processed.MCPServers, os.LookupEnv); err != nil {
+		sourcesSpan.End(err)
+		return MissionOutput{}, GitChanges{}, err
+	}
+
+	var fetched []FetchedSource
+	webDir := filepath.Join(r.RunDir, "web", firstNonEmpty(name, "mission"))
+	if cfg.FetchWebSources && len(processed.Web) > 0 {
+		var failed []Source
+		fetched, failed = fetchWebSources(r.HTTPClient, processed.Web, WebFetchOptions{
+			CacheDir:     cfg.WebCacheDir,
+			OutputDir:    webDir,
+			MaxBytes:     cfg.WebMaxBytes,
+			AllowedHosts: cfg.WebAllowedHosts,
+		})
+		processed.WebSources = webSourcesPrompt(fetched, failed)
+		sourcesSpan.SetAttribute("sources.web_failed", len(failed))
+	}
+	sourcesSpan.SetAttribute("sources.count", len(sources))
+	sourcesSpan.SetAttribute("sources.mcp_servers", len(processed.MCPServers))
+	sourcesSpan.SetAttribute("sources.web", len(processed.Web))
+	sourcesSpan.End(nil)
+
+	// 3. Write Copilot Config
+	configSpan := span.Child("config.write")
+	configDir := filepath.Join(r.ConfigHome, "github-copilot")
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		err = fmt.Errorf("failed to create config dir: %w", err)
+		configSpan.End(err)
+		return MissionOutput{}, GitChanges{}, err
+	}
+
+	reportFile := filepath.Join(r.RunDir, firstNonEmpty(name, "mission")+"-findings.jsonl")
+	if cfg.BuiltinMCP {
+		server, err := r.builtinServer(webDir, reportFile, previous)
+		if err != nil {
+			configSpan.End(err)
+			return MissionOutput{}, GitChanges{}, err
+		}
+		if processed.MCPServers == nil {
+			processed.MCPServers = make(map[string]MCPServer)
+		}
+		processed.MCPServers[builtinMCPName] = server
+	}
+	if cfg.MCPHealthCheck && r.ProbeMCP != nil && len(processed.MCPServers) > 0 {
+		processed.MCPServers, err = checkMCPServers(r.ProbeMCP, processed.MCPServers, processed.Optional, []string{builtinMCPName}, childEnv, cfg.MCPTimeout)
+		if err != nil {
+			configSpan.End(err)
+			return MissionOutput{}, GitChanges{}, err
+		}
+	}
+
+	copilotConfig := CopilotConfig{
+		MCPServers: processed.MCPServers,
+	}
+	configData, _ := json.MarshalIndent(copilotConfig, "", "  ")
+	configFile := filepath.Join(configDir, "config.json")
+	if err := os.WriteFile(configFile, configData, 0600); err != nil {
+		err = fmt.Errorf("failed to write config file: %w", err)
+		configSpan.End(err)
+		return MissionOutput{}, GitChanges{}, err
+	}
+	configSpan.SetAttribute("mcp.servers", len(processed.MCPServers))
+	configSpan.End(nil)
+
+	// 4. Handle Output/Env
+	outputEnv("RESOLVED_MISSION", resolvedMission)
+	outputEnv("EXTRA_WEB_SOURCES", processed.WebSources)
+
+	// 5. Execute Mission
+	before, err := captureGitSnapshot(r.Executor)
+	if err != nil {
+		logWarn("Could not inspect git state: %v", err)
+	}
+
+	agentOpts := missionAgentOptions(cfg, resolvedMission, r.RunDir, fetched, previous)
+	agentOpts.CopilotToken = r.ModelToken
+	agentOpts.Env = childEnv
+	agentOpts.Executor = r.Executor
+	agentOpts.Span = span
+
+	result, err := executeMission(agentOpts, processed.WebSources)
+	usage := &result.Usage
+	if err != nil {
+		// The usage is returned with the error so failed missions are still accounted for.
+		return MissionOutput{Name: name, Usage: usage}, GitChanges{}, fmt.Errorf("mission execution failed: %w", err)
+	}
+
+	span.SetAttribute("agent.model", result.Model)
+
+	// 6. Inspect this mission's changes
+	changes, err := missionChanges(r.Executor, before)
+	if err != nil {
+		if !cfg.DryRun {
+			return MissionOutput{Name: name, Usage: usage}, GitChanges{}, fmt.Errorf("failed to inspect changes: %w", err)
+		}
+		logWarn("Could not inspect changes: %v", err)
+	}
+	if err := checkGuardrails(changes, cfg.MaxChangedFiles, cfg.AllowedPaths); err != nil {
+		return MissionOutput{Name: name, Usage: usage}, GitChanges{}, fmt.Errorf("guardrail violated: %w", err)
+	}
+
+	// Print summary (mimics ::group:: behavior)
+	logInfo("Copilot config written to %s", configFile)
+	logInfo("%s", redactedConfig(copilotConfig))
+
+	return MissionOutput{
+		Name:         name,
+		Model:        result.Model,
+		Findings:     readFindingsSummary(agentOpts.FindingsFile),
+		ChangedFiles: changes.Files,
+		DiffStat:     changes.DiffStat,
+		Reported:     readReportedFindings(reportFile),
+		Usage:        usage,
+	}, changes, nil
+}
+
+// missionAgentOptions wires a resolved mission, the web sources fetched for
+// it and the outputs of its dependencies into everything that shapes the
+// agent's prompt. The caller adds the token, environment and executor.
+func missionAgentOptions(cfg *RunConfig, resolvedMission, runDir string, fetched []FetchedSource, previous []MissionOutput) AgentOptions {
+	contextFiles := cfg.ContextFiles
+	for _, f := range fetched {
+		contextFiles += ", " + f.Path
+	}
+	return AgentOptions{
+		FullMission:     resolvedMission,
+		ContextFiles:    contextFiles,
+		Model:           cfg.Model,
+		FallbackModel:   cfg.FallbackModel,
+		DryRun:          cfg.DryRun,
+		FindingsFile:    findingsPath(runDir, cfg.MissionName),
+		ReportTool:      cfg.BuiltinMCP,
+		PreviousOutputs: previous,
+		Timeout:         cfg.Timeout,
+		Budget:          UsageBudget{MaxPremiumRequests: cfg.MaxPremiumRequests, MaxTokens: cfg.MaxTokens},
+	}
+}
+
+// builtinServer describes how the agent starts this binary as its MCP server.
+// The outputs of the missions this one depends on are written for
+// get_prior_findings to serve.
+func (r *missionRunner) builtinServer(webDir, reportFile string, previous []MissionOutput) (MCPServer, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return MCPServer{}, fmt.Errorf("failed to locate the agentic-audits binary: %w", err)
+	}
+	templatesDir, _ := filepath.Abs(filepath.Join(".github", "templates"))
+	os.Remove(reportFile)
+
+	args := []string{"mcp-server", "--web-dir", webDir, "--templates-dir", templatesDir, "--report-file", reportFile}
+	if len(previous) > 0 {
+		outputsFile := strings.TrimSuffix(reportFile, "-findings.jsonl") + "-prior.json"
+		data, _ := json.MarshalIndent(previous, "", "  ")
+		if err := os.WriteFile(outputsFile, data, 0644); err != nil {
+			return MCPServer{}, fmt.Errorf("failed to write prior outputs: %w", err)
+		}
+		args = append(args, "--outputs-file", outputsFile)
+	}
+	return MCPServer{Command: self, Args: args}, nil
+}
+
+// effectiveSources merges the org, repository and mission source layers and
+// prints the result.
+func (r *missionRunner) effectiveSources(cfg *RunConfig) []Source {
+	merged := mergeSourceLayers(sourceLayers(cfg, r.OrgSources))
+	if len(merged) > 0 {
+		endGroup := logGroup("Effective sources")
+		logInfo("%s", formatEffectiveSources(merged))
+		endGroup()
+	}
+
+	sources := make([]Source, len(merged))
+	for i, s := range merged {
+		sources[i] = s.Source
+	}
+	return sources
+}
+
+// missionChanges diffs the working tree against before. Snapshots without a
+// tree (e.g. when git state could not be read) fall back to a HEAD diff.
+func missionChanges(executor CommandExecutor, before GitSnapshot) (GitChanges, error) {
+	if before.Tree != "" {
+		after, err := captureGitSnapshot(executor)
+		if err == nil && after.Tree != "" {
+			return diffSnapshots(executor, before, after)
+		}
+	}
+	return collectGitChanges(executor, before)
+}
+
+// dependencyOutputs selects the outputs of the missions cfg depends on.
+func dependencyOutputs(cfg *RunConfig, outputs []MissionOutput) []MissionOutput {
+	if cfg.Spec == nil {
+		return nil
+	}
+	var selected []MissionOutput
+	for _, output := range outputs {
+		for _, dep := range cfg.Spec.DependsOn {
+			if output.Name == dep {
+				// Usage is accounting, not context for the agent.
+				output.Usage = nil
+				selected = append(selected, output)
+			}
+		}
+	}
+	return selected
+}
+
+// combineMissions merges a plan into the config and output used for one
+// combined PR. PR settings come from the first mission; labels are merged.
+func combineMissions(plan []*RunConfig, outputs []MissionOutput) (*RunConfig, MissionOutput) {
+	if len(plan) == 1 {
+		return plan[0], outputs[0]
+	}
+
+	combined := *plan[0]
+	var models, findings, labels []string
+	var reported []Finding
+	seenLabels, seenModels := make(map[string]bool), make(map[string]bool)
+	for i, cfg := range plan {
+		if cfg.Template != combined.Template {
+			combined.Template = ""
+		}
+		for _, label := range cfg.PRLabels {
+			if !seenLabels[label] {
+				seenLabels[label] = true
+				labels = append(labels, label)
+			}
+		}
+		output := outputs[i]
+		if output.Model != "" && !seenModels[output.Model] {
+			seenModels[output.Model] = true
+			models = append(models, output.Model)
+		}
+		reported = append(reported, output.Reported...)
+		if output.Findings != "" {
+			findings = append(findings, fmt.Sprintf("#### %s\n%s", output.Name, output.Findings))
+		}
+	}
+	combined.MissionName = strings.Join(missionNames(plan), "-")
+	combined.PRLabels = labels
+	return &combined, MissionOutput{
+		Name:     combined.MissionName,
+		Model:    strings.Join(models, ", "),
+		Findings: strings.Join(findings, "\n\n"),
+		Reported: reported,
+	}
+}
+
+func missionNames(plan []*RunConfig) []string {
+	names := make([]string, len(plan))
+	for i, cfg := range plan {
+		names[i] = cfg.MissionName
+	}
+	return names
+}
+
+// writeMissionOutputs saves every mission's output as JSON for later workflow steps.
+func writeMissionOutputs(outputs []MissionOutput) {
+	data, _ := json.MarshalIndent(outputs, "", "  ")
+	path := filepath.Join(ciProvider.TempDir(), "agentic-audits-outputs.json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		logWarn("Could not write mission outputs: %v", err)
+		return
+	}
+	outputEnv("MISSION_OUTPUTS", path)
+}
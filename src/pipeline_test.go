@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testPipelineYAML = `
+missions:
+  audit:
+    prompt: Audit the skills
+    pr:
+      labels: [skills]
+  docs:
+    prompt: Update the docs
+    depends_on: [audit]
+    pr:
+      labels: [docs]
+`
+
+// pipelineMock emulates git (a fresh tree per snapshot, one changed file per
+// mission), records agent prompts and PR bases, and writes findings.
+type pipelineMock struct {
+	trees   int
+	prompts []string
+	bases   []string
+	bodies  []string
+	// reverted lists the patches applied in reverse to set changes aside.
+	reverted []string
+}
+
+func (m *pipelineMock) executor() *MockCommandExecutor {
+	return &MockCommandExecutor{
+		RunFunc: func(name string, args []string, env []string, stdout, stderr io.Writer) error {
+			key := strings.Join(args, " ")
+			switch {
+			case name == "git" && key == "write-tree":
+				m.trees++
+				fmt.Fprintf(stdout, "tree%d\n", m.trees)
+			case name == "git" && key == "diff --name-only tree2 tree3":
+				fmt.Fprintln(stdout, ".github/skills/a.md")
+			case name == "git" && key == "diff --name-only tree4 tree5":
+				fmt.Fprintln(stdout, "docs/b.md")
+			case name == "git" && args[0] == "apply":
+				m.reverted = append(m.reverted, filepath.Base(args[len(args)-1]))
+			case name == "git" && strings.HasPrefix(key, "diff --name-only"):
+				fmt.Fprintln(stdout, ".github/skills/a.md\ndocs/b.md")
+			case name == "gh" && args[0] == "copilot":
+				prompt := args[3]
+				m.prompts = append(m.prompts, prompt)
+				if strings.Contains(prompt, "Audit the skills") {
+					runDirs, _ := filepath.Glob(filepath.Join(os.Getenv("RUNNER_TEMP"), "agentic-audits-run-*"))
+					for _, dir := range runDirs {
+						os.WriteFile(filepath.Join(dir, "agentic-audits-findings-audit.md"), []byte("Two stale skills."), 0644)
+						os.WriteFile(filepath.Join(dir, "audit-findings.jsonl"), []byte(`{"title":"Stale skill","severity":"high","file":".github/skills/a.md","description":"Outdated."}`+"\n"), 0644)
+					}
+				}
+			case name == "gh" && args[0] == "pr":
+				for i, arg := range args {
+					if arg == "--base" {
+						m.bases = append(m.bases, args[i+1])
+					}
+					if arg == "--body" {
+						m.bodies = append(m.bodies, args[i+1])
+					}
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func TestRunMissionPlan(t *testing.T) {
+	missionsFile := writeMissionsFile(t, testPipelineYAML)
+	httpClient := &MockHTTPClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(`{}`))}, nil
+		},
+	}
+	t.Setenv("GITHUB_REPOSITORY", "")
+	t.Setenv("GITHUB_ENV", filepath.Join(t.TempDir(), "env"))
+	t.Setenv("RUNNER_TEMP", t.TempDir())
+	baseArgs := []string{"--missions-file", missionsFile, "--mission-name", "docs", "--github-token", "tok", "--skip-setup", "--skip-preflight"}
+
+	t.Run("Dependencies run first and pass their output", func(t *testing.T) {
+		mock := &pipelineMock{}
+		if err := run(append(baseArgs, "--dry-run"), mock.executor(), httpClient); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(mock.prompts) != 2 || !strings.Contains(mock.prompts[0], "Audit the skills") {
+			t.Fatalf("expected audit then docs, got %d prompts", len(mock.prompts))
+		}
+		if strings.Contains(mock.prompts[0], "Previous Missions") {
+			t.Error("first mission should not get previous outputs")
+		}
+		docs := mock.prompts[1]
+		if !strings.Contains(docs, "Output of Previous Missions") || !strings.Contains(docs, "Two stale skills.") || !strings.Contains(docs, ".github/skills/a.md") {
+			t.Errorf("docs prompt should carry the audit output:\n%s", docs)
+		}
+		if len(mock.bases) != 0 {
+			t.Error("dry run should not open PRs")
+		}
+	})
+
+	t.Run("One combined PR", func(t *testing.T) {
+		mock := &pipelineMock{}
+		if err := run(baseArgs, mock.executor(), httpClient); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(mock.bases, []string{"main"}) {
+			t.Errorf("expected one PR against main, got %v", mock.bases)
+		}
+		if !strings.Contains(mock.bodies[0], "**high** Stale skill (`.github/skills/a.md`): Outdated.") {
+			t.Errorf("PR body should list the reported finding:\n%s", mock.bodies[0])
+		}
+		if !strings.Contains(mock.prompts[0], "report_finding") {
+			t.Error("prompt should point the agent at report_finding")
+		}
+	})
+
+	t.Run("Stacked PR per mission", func(t *testing.T) {
+		mock := &pipelineMock{}
+		if err := run(append(baseArgs, "--pr-mode", "per-mission"), mock.executor(), httpClient); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(mock.bases) != 2 || mock.bases[0] != "main" || !strings.HasPrefix(mock.bases[1], "agent/audit-") {
+			t.Errorf("expected docs PR stacked on the audit branch, got %v", mock.bases)
+		}
+		if len(mock.reverted) != 0 {
+			t.Errorf("missions that open a PR should not be reverted, got %v", mock.reverted)
+		}
+	})
+
+	t.Run("All dry-run missions keep their changes", func(t *testing.T) {
+		mock := &pipelineMock{}
+		if err := run(append(baseArgs, "--pr-mode", "per-mission", "--dry-run"), mock.executor(), httpClient); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(mock.reverted) != 0 || len(mock.bases) != 0 {
+			t.Errorf("expected no reverts and no PRs, got %v / %v", mock.reverted, mock.bases)
+		}
+	})
+
+	mixedFile := writeMissionsFile(t, strings.Replace(testPipelineYAML, "    prompt: Audit the skills\n", "    prompt: Audit the skills\n    guardrails:\n      dry_run: true\n", 1))
+	mixedArgs := append([]string{"--missions-file", mixedFile}, baseArgs[2:]...)
+	for _, mode := range []string{"combined", "per-mission"} {
+		t.Run("Mixed dry-run plan, "+mode, func(t *testing.T) {
+			mock := &pipelineMock{}
+			if err := run(append(mixedArgs, "--pr-mode", mode), mock.executor(), httpClient); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(mock.reverted, []string{"agentic-audits-audit-dry-run.patch"}) {
+				t.Errorf("the dry-run audit's changes should be set aside, got %v", mock.reverted)
+			}
+			if !reflect.DeepEqual(mock.bases, []string{"main"}) {
+				t.Fatalf("expected one PR for docs against main, got %v", mock.bases)
+			}
+			if strings.Contains(mock.bodies[0], "Stale skill") {
+				t.Errorf("the PR should not carry the dry-run mission's findings:\n%s", mock.bodies[0])
+			}
+		})
+	}
+}
+
+func TestRunMissionSecretEnv(t *testing.T) {
+	missionsFile := writeMissionsFile(t, `
+missions:
+  audit:
+    prompt: Audit the docs
+    sources:
+      - name: docs
+        type: mcp
+        package: docs-mcp
+        enabled: true
+        env:
+          API_KEY: secret:AUDIT_API_TOKEN
+`)
+	t.Setenv("AUDIT_API_TOKEN", "s3cret")
+	t.Setenv("RUNNER_TEMP", t.TempDir())
+	t.Setenv("GITHUB_ENV", filepath.Join(t.TempDir(), "env"))
+
+	var agentEnv []string
+	executor := &MockCommandExecutor{
+		RunFunc: func(name string, args []string, env []string, stdout, stderr io.Writer) error {
+			if name == "gh" && args[0] == "copilot" {
+				agentEnv = env
+			}
+			return nil
+		},
+	}
+	args := []string{"--missions-file", missionsFile, "--mission-name", "audit", "--github-token", "tok", "--skip-setup", "--skip-preflight", "--dry-run"}
+	if err := run(args, executor, &MockHTTPClient{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if agentEnv == nil {
+		t.Fatal("the agent did not run")
+	}
+	for _, kv := range agentEnv {
+		if strings.HasPrefix(kv, "AUDIT_API_TOKEN=") {
+			t.Error("a secret referenced by an MCP server must not reach the agent")
+		}
+	}
+}
+
+func TestCombineMissions(t *testing.T) {
+	plan := []*RunConfig{
+		{MissionName: "audit", Template: "skills-audit", PRBase: "main", PRLabels: []string{"automated-pr", "skills"}},
+		{MissionName: "docs", PRBase: "develop", PRLabels: []string{"automated-pr", "docs"}},
+	}
+	outputs := []MissionOutput{
+		{Name: "audit", Model: "m1", Findings: "Audit findings"},
+		{Name: "docs", Model: "m1"},
+	}
+
+	cfg, output := combineMissions(plan, outputs)
+	if cfg.PRBase != "main" || cfg.MissionName != "audit-docs" || cfg.Template != "" {
+		t.Errorf("unexpected combined config: %+v", cfg)
+	}
+	if !reflect.DeepEqual(cfg.PRLabels, []string{"automated-pr", "skills", "docs"}) {
+		t.Errorf("unexpected labels: %v", cfg.PRLabels)
+	}
+	if output.Model != "m1" || !strings.Contains(output.Findings, "#### audit\nAudit findings") {
+		t.Errorf("unexpected combined output: %+v", output)
+	}
+	if plan[0].Template != "skills-audit" {
+		t.Error("combining must not modify the plan")
+	}
+
+	single, _ := combineMissions(plan[:1], outputs[:1])
+	if single != plan[0] {
+		t.Error("a single mission should be used as is")
+	}
+}
+
+func TestDependencyOutputs(t *testing.T) {
+	outputs := []MissionOutput{{Name: "a"}, {Name: "b"}}
+	cfg := &RunConfig{Spec: &MissionSpec{DependsOn: []string{"b"}}}
+	if got := dependencyOutputs(cfg, outputs); len(got) != 1 || got[0].Name != "b" {
+		t.Errorf("expected only b, got %v", got)
+	}
+	if got := dependencyOutputs(&RunConfig{}, outputs); got != nil {
+		t.Errorf("missions without a spec get no outputs, got %v", got)
+	}
+}
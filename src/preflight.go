@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// TokenCapabilities is what the preflight learned about the token.
+type TokenCapabilities struct {
+	Login       string
+	Scopes      []string
+	FineGrained bool
+	CanPush     bool
+	// PushUnknown is set when GitHub did not report the push permission,
+	// which it only does for user tokens.
+	PushUnknown bool
+	Copilot     bool
+}
+
+type repoPermissions struct {
+	Archived bool `json:"archived"`
+	// Permissions is missing for installation tokens (GITHUB_TOKEN, Apps).
+	Permissions *struct {
+		Push bool `json:"push"`
+		Pull bool `json:"pull"`
+	} `json:"permissions"`
+}
+
+// verifyTokenCapabilities checks, before any model quota is spent, that the
+// repository token is valid, can see the repository and can push and open pull
+// requests (when needsWrite is set), and that the Copilot token is entitled to
+// Copilot. All problems are reported together so they can be fixed in one go.
+func verifyTokenCapabilities(client HTTPClient, host GitHubHost, token, copilotToken, repo string, needsWrite bool) (TokenCapabilities, error) {
+	defer logGroup("Verifying token capabilities")()
+
+	var caps TokenCapabilities
+	var problems []string
+
+	// 1. Token validity and classic scopes
+	resp, err := githubGet(client, host, token, "/user")
+	if err != nil {
+		return caps, fmt.Errorf("preflight failed: %w", err)
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+		return caps, fmt.Errorf("preflight failed: token was rejected by %s (401); it is invalid, expired or revoked", host.APIURL)
+	}
+	var user GitHubUser
+	json.NewDecoder(resp.Body).Decode(&user)
+	resp.Body.Close()
+	caps.Login = user.Login
+
+	if header, ok := resp.Header["X-Oauth-Scopes"]; ok {
+		caps.Scopes = splitList(strings.Join(header, ","))
+		logInfo("Token scopes: %s", strings.Join(caps.Scopes, ", "))
+		if needsWrite && !hasAnyScope(caps.Scopes, "repo", "public_repo") {
+			problems = append(problems, "classic token is missing the 'repo' scope needed to push branches and open pull requests")
+		}
+	} else {
+		caps.FineGrained = true
+		logInfo("Token has no OAuth scopes header; treating it as a fine-grained or app token.")
+	}
+
+	// 2. Repository access and push permission
+	if repo == "" {
+		logWarn("The repository is not known (set --repository); skipping repository permission checks.")
+	} else {
+		problems = append(problems, checkRepoAccess(client, host, token, repo, needsWrite, &caps)...)
+	}
+
+	// 3. Copilot entitlement, which only github.com can tell
+	if !host.IsDotCom() {
+		logInfo("Skipping the Copilot entitlement check on %s.", host.Name)
+	} else {
+		resp, err = githubGet(client, host, copilotToken, "/copilot_internal/user")
+		if err != nil {
+			return caps, fmt.Errorf("preflight failed: %w", err)
+		}
+		resp.Body.Close()
+		caps.Copilot = resp.StatusCode == http.StatusOK
+		if !caps.Copilot {
+			problems = append(problems, fmt.Sprintf("Copilot token has no Copilot entitlement (HTTP %d); use a token from a user with an active Copilot seat", resp.StatusCode))
+		}
+	}
+
+	if len(problems) > 0 {
+		return caps, fmt.Errorf("token preflight failed:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	logInfo("Token preflight passed.")
+	return caps, nil
+}
+
+func checkRepoAccess(client HTTPClient, host GitHubHost, token, repo string, needsWrite bool, caps *TokenCapabilities) []string {
+	resp, err := githubGet(client, host, token, "/repos/"+repo)
+	if err != nil {
+		return []string{fmt.Sprintf("could not query repository %s: %v", repo, err)}
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return []string{fmt.Sprintf("token cannot access repository %s (HTTP %d); for fine-grained tokens add it under 'Repository access'", repo, resp.StatusCode)}
+	}
+	var perms repoPermissions
+	json.NewDecoder(resp.Body).Decode(&perms)
+	resp.Body.Close()
+	if perms.Permissions != nil {
+		caps.CanPush = perms.Permissions.Push
+	} else {
+		caps.PushUnknown = true
+		logInfo("GitHub does not report push permission for this token; relying on the pull request check.")
+	}
+
+	if !needsWrite {
+		return nil
+	}
+
+	var problems []string
+	if perms.Archived {
+		problems = append(problems, fmt.Sprintf("repository %s is archived; pull requests cannot be opened", repo))
+	}
+	if !caps.CanPush && !caps.PushUnknown {
+		problems = append(problems, fmt.Sprintf("token cannot push to %s; grant 'Contents: write' (fine-grained) or use a token with write access", repo))
+	}
+
+	// Creating a pull request without head and base fails validation (422)
+	// only once the token is allowed to create one; otherwise it is refused.
+	resp, err = githubRequest(client, host, token, "POST", "/repos/"+repo+"/pulls", strings.NewReader("{}"))
+	if err != nil {
+		return append(problems, fmt.Sprintf("could not check pull request access on %s: %v", repo, err))
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		problems = append(problems, fmt.Sprintf("token cannot create pull requests on %s (HTTP %d); grant 'Pull requests: write'", repo, resp.StatusCode))
+	}
+	return problems
+}
+
+func githubGet(client HTTPClient, host GitHubHost, token, path string) (*http.Response, error) {
+	return githubRequest(client, host, token, "GET", path, nil)
+}
+
+func githubRequest(client HTTPClient, host GitHubHost, token, method, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, host.APIURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "token "+token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	if resp.Body == nil {
+		resp.Body = io.NopCloser(strings.NewReader(""))
+	}
+	return resp, nil
+}
+
+func hasAnyScope(scopes []string, wanted ...string) bool {
+	for _, scope := range scopes {
+		for _, w := range wanted {
+			if scope == w {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type fakeRoute struct {
+	status int
+	body   string
+	header http.Header
+}
+
+func routedHTTPClient(routes map[string]fakeRoute) *MockHTTPClient {
+	return &MockHTTPClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			route, ok := routes[req.URL.RequestURI()]
+			if !ok {
+				route = fakeRoute{status: http.StatusNotFound, body: `{}`}
+			}
+			return &http.Response{
+				StatusCode: route.status,
+				Header:     route.header,
+				Body:       io.NopCloser(bytes.NewBufferString(route.body)),
+			}, nil
+		},
+	}
+}
+
+func TestVerifyTokenCapabilities(t *testing.T) {
+	host := GitHubHost{Name: "github.com", APIURL: "https://api.github.com"}
+	healthy := func() map[string]fakeRoute {
+		return map[string]fakeRoute{
+			"/user":                  {status: 200, body: `{"login":"bot"}`, header: http.Header{"X-Oauth-Scopes": {"repo, workflow"}}},
+			"/repos/o/r":             {status: 200, body: `{"permissions":{"push":true,"pull":true}}`},
+			"/repos/o/r/pulls":       {status: 422, body: `{"message":"Validation Failed"}`},
+			"/copilot_internal/user": {status: 200, body: `{}`},
+		}
+	}
+
+	t.Run("All capabilities present", func(t *testing.T) {
+		caps, err := verifyTokenCapabilities(routedHTTPClient(healthy()), host, "tok", "tok", "o/r", true)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if caps.Login != "bot" || !caps.CanPush || !caps.Copilot || caps.FineGrained {
+			t.Errorf("unexpected capabilities: %+v", caps)
+		}
+	})
+
+	t.Run("Invalid token", func(t *testing.T) {
+		routes := healthy()
+		routes["/user"] = fakeRoute{status: 401, body: `{}`}
+		_, err := verifyTokenCapabilities(routedHTTPClient(routes), host, "tok", "tok", "o/r", true)
+		if err == nil || !strings.Contains(err.Error(), "401") {
+			t.Errorf("expected 401 error, got %v", err)
+		}
+	})
+
+	t.Run("Missing scope, push and Copilot are all reported", func(t *testing.T) {
+		routes := healthy()
+		routes["/user"] = fakeRoute{status: 200, body: `{"login":"bot"}`, header: http.Header{"X-Oauth-Scopes": {"read:org"}}}
+		routes["/repos/o/r"] = fakeRoute{status: 200, body: `{"permissions":{"push":false,"pull":true}}`}
+		delete(routes, "/copilot_internal/user")
+
+		_, err := verifyTokenCapabilities(routedHTTPClient(routes), host, "tok", "tok", "o/r", true)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		for _, want := range []string{"'repo' scope", "cannot push", "Copilot entitlement"} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("error should mention %q, got: %v", want, err)
+			}
+		}
+	})
+
+	t.Run("Fine-grained token without repository access", func(t *testing.T) {
+		routes := healthy()
+		routes["/user"] = fakeRoute{status: 200, body: `{"login":"bot"}`}
+		delete(routes, "/repos/o/r")
+
+		caps, err := verifyTokenCapabilities(routedHTTPClient(routes), host, "tok", "tok", "o/r", true)
+		if err == nil || !strings.Contains(err.Error(), "Repository access") {
+			t.Errorf("expected repository access error, got %v", err)
+		}
+		if !caps.FineGrained {
+			t.Error("token without scopes header should be treated as fine-grained")
+		}
+	})
+
+	t.Run("Copilot entitlement is checked with the Copilot token", func(t *testing.T) {
+		client := routedHTTPClient(healthy())
+		base := client.DoFunc
+		client.DoFunc = func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path == "/copilot_internal/user" && req.Header.Get("Authorization") != "token seat" {
+				return &http.Response{StatusCode: 403, Body: io.NopCloser(bytes.NewBufferString(`{}`))}, nil
+			}
+			return base(req)
+		}
+		if _, err := verifyTokenCapabilities(client, host, "tok", "seat", "o/r", true); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("Installation token without permissions", func(t *testing.T) {
+		routes := healthy()
+		routes["/user"] = fakeRoute{status: 403, body: `{"message":"Resource not accessible by integration"}`}
+		routes["/repos/o/r"] = fakeRoute{status: 200, body: `{"full_name":"o/r","archived":false}`}
+
+		caps, err := verifyTokenCapabilities(routedHTTPClient(routes), host, "ghs_x", "tok", "o/r", true)
+		if err != nil {
+			t.Fatalf("a missing permissions object must not fail preflight: %v", err)
+		}
+		if caps.CanPush || !caps.PushUnknown {
+			t.Errorf("push permission should be unknown, got %+v", caps)
+		}
+
+		routes["/repos/o/r/pulls"] = fakeRoute{status: 403, body: `{}`}
+		if _, err := verifyTokenCapabilities(routedHTTPClient(routes), host, "ghs_x", "tok", "o/r", true); err == nil || !strings.Contains(err.Error(), "cannot create pull requests") {
+			t.Errorf("the pull request check should still apply, got %v", err)
+		}
+	})
+
+	t.Run("Read-only pull request access is reported", func(t *testing.T) {
+		routes := healthy()
+		routes["/repos/o/r/pulls"] = fakeRoute{status: 403, body: `{"message":"Resource not accessible by personal access token"}`}
+
+		_, err := verifyTokenCapabilities(routedHTTPClient(routes), host, "tok", "tok", "o/r", true)
+		if err == nil || !strings.Contains(err.Error(), "cannot create pull requests") {
+			t.Errorf("expected pull request write error, got %v", err)
+		}
+	})
+
+	t.Run("Copilot entitlement is skipped on enterprise hosts", func(t *testing.T) {
+		routes := make(map[string]fakeRoute)
+		for path, route := range healthy() {
+			if path != "/copilot_internal/user" {
+				routes["/api/v3"+path] = route
+			}
+		}
+		ghes := GitHubHost{Name: "ghe.example.com", APIURL: "https://ghe.example.com/api/v3"}
+
+		if _, err := verifyTokenCapabilities(routedHTTPClient(routes), ghes, "tok", "tok", "o/r", true); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("Read-only is enough for dry runs", func(t *testing.T) {
+		routes := healthy()
+		routes["/repos/o/r"] = fakeRoute{status: 200, body: `{"permissions":{"push":false,"pull":true}}`}
+		delete(routes, "/repos/o/r/pulls")
+
+		if _, err := verifyTokenCapabilities(routedHTTPClient(routes), host, "tok", "tok", "o/r", false); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+const defaultPRTitleTemplate = `chore({{if gt (len .Missions) 1}}{{range $i, $m := .Missions}}{{if $i}}, {{end}}{{$m}}{{end}}{{else if .Template}}{{.Template}}{{else}}audit{{end}}): [AI-GENERATED] agentic audit`
+
+const defaultPRBodyTemplate = `### 🔎 Audit Overview
+{{if .FindingsSummary}}{{.FindingsSummary}}{{else}}_The agent did not report a findings summary._{{end}}
+{{if .Findings}}
+### 📋 Reported Findings
+{{range .Findings}}- **{{.Severity}}** {{.Title}}{{if .File}} (` + "`{{.File}}{{if .Line}}:{{.Line}}{{end}}`" + `){{end}}: {{.Description}}
+{{end}}{{end}}
+### 🛠 Changed Files
+{{range .ChangedFiles}}- ` + "`{{.}}`" + `
+{{else}}_No files changed._
+{{end}}
+---
+Generated by [agentic-audits](https://github.com/petermefrandsen/agentic-audits){{if .Model}} using ` + "`{{.Model}}`" + `{{end}}.{{if .RunURL}} [View workflow run]({{.RunURL}}){{end}}
+`
+
+// PRTemplateData holds the mission variables available to PR title and body templates.
+type PRTemplateData struct {
+	Template string
+	// Missions names every mission whose changes the PR carries.
+	Missions        []string
+	Model           string
+	RunURL          string
+	FindingsSummary string
+	Findings        []Finding
+	ChangedFiles    []string
+	DiffStat        string
+}
+
+// loadPRTemplate returns the template text to use. An inline override (e.g. from
+// PR_TITLE/PR_BODY) wins, then the template file, then the built-in fallback.
+func loadPRTemplate(path, override, fallback string) (string, error) {
+	if override != "" {
+		return override, nil
+	}
+	if path == "" {
+		return fallback, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fallback, nil
+		}
+		return "", fmt.Errorf("failed to read PR template %s: %w", path, err)
+	}
+	return string(data), nil
+}
+
+func renderPRTemplate(name, text string, data PRTemplateData) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid PR template %s: %w", name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render PR template %s: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
+// renderPRText renders the title and body. Titles are collapsed to a single line.
+func renderPRText(titleTemplate, bodyTemplate string, data PRTemplateData) (string, string, error) {
+	title, err := renderPRTemplate("title", titleTemplate, data)
+	if err != nil {
+		return "", "", err
+	}
+	title = strings.Join(strings.Fields(title), " ")
+	if title == "" {
+		return "", "", fmt.Errorf("PR title template rendered an empty title")
+	}
+
+	body, err := renderPRTemplate("body", bodyTemplate, data)
+	if err != nil {
+		return "", "", err
+	}
+	return title, strings.TrimSpace(body) + "\n", nil
+}
+
+func readFindingsSummary(path string) string {
+	if path == "" {
+		return ""
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
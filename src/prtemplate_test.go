@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadPRTemplate(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "body.md")
+	os.WriteFile(path, []byte("from file"), 0644)
+
+	t.Run("Override wins", func(t *testing.T) {
+		text, err := loadPRTemplate(path, "inline", "fallback")
+		if err != nil || text != "inline" {
+			t.Errorf("expected inline override, got %q (%v)", text, err)
+		}
+	})
+
+	t.Run("File", func(t *testing.T) {
+		text, err := loadPRTemplate(path, "", "fallback")
+		if err != nil || text != "from file" {
+			t.Errorf("expected file contents, got %q (%v)", text, err)
+		}
+	})
+
+	t.Run("Missing file uses fallback", func(t *testing.T) {
+		text, err := loadPRTemplate(filepath.Join(tmpDir, "missing.md"), "", "fallback")
+		if err != nil || text != "fallback" {
+			t.Errorf("expected fallback, got %q (%v)", text, err)
+		}
+	})
+}
+
+func TestRenderPRText(t *testing.T) {
+	data := PRTemplateData{
+		Template:        "skills-audit",
+		Model:           "gpt-5-mini",
+		RunURL:          "https://github.com/o/r/actions/runs/1",
+		FindingsSummary: "Tightened two skills.",
+		ChangedFiles:    []string{"a.md", "b.md"},
+		Findings:        []Finding{{Title: "Stale", Severity: "low", File: "a.md", Line: 2, Description: "Old."}},
+	}
+
+	t.Run("Defaults", func(t *testing.T) {
+		title, body, err := renderPRText(defaultPRTitleTemplate, defaultPRBodyTemplate, data)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if title != "chore(skills-audit): [AI-GENERATED] agentic audit" {
+			t.Errorf("unexpected title: %q", title)
+		}
+		for _, want := range []string{"Tightened two skills.", "- `a.md`", "- `b.md`", "`gpt-5-mini`", data.RunURL, "- **low** Stale (`a.md:2`): Old."} {
+			if !strings.Contains(body, want) {
+				t.Errorf("body should contain %q, got:\n%s", want, body)
+			}
+		}
+	})
+
+	t.Run("Combined missions", func(t *testing.T) {
+		combined := data
+		combined.Missions = []string{"audit", "docs"}
+		title, _, err := renderPRText(defaultPRTitleTemplate, "body", combined)
+		if err != nil || title != "chore(audit, docs): [AI-GENERATED] agentic audit" {
+			t.Errorf("unexpected title %q (%v)", title, err)
+		}
+	})
+
+	t.Run("Multi-line title is collapsed", func(t *testing.T) {
+		title, _, err := renderPRText("fix:\n  {{.Template}}\n", "body", data)
+		if err != nil || title != "fix: skills-audit" {
+			t.Errorf("unexpected title %q (%v)", title, err)
+		}
+	})
+
+	t.Run("Empty title", func(t *testing.T) {
+		if _, _, err := renderPRText("  ", "body", data); err == nil {
+			t.Error("expected error for empty title")
+		}
+	})
+
+	t.Run("Unknown variable", func(t *testing.T) {
+		if _, _, err := renderPRText("{{.Nope}}", "body", data); err == nil {
+			t.Error("expected error for unknown variable")
+		}
+	})
+}
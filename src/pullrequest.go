@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// GitIdentity is the author and committer of the pull request commit.
+type GitIdentity struct {
+	Name  string
+	Email string
+}
+
+var defaultGitIdentity = GitIdentity{Name: "github-actions[bot]", Email: "github-actions[bot]@users.noreply.github.com"}
+
+type PullRequestSpec struct {
+	Repository string
+	Base       string
+	Branch     string
+	Title      string
+	Body       string
+	Labels     []string
+	// Author defaults to github-actions[bot].
+	Author GitIdentity
+}
+
+// openPullRequest pushes the changes and opens the PR with the repository token.
+// The token is handed to git through GIT_CONFIG_* so it replaces any checkout
+// credentials without appearing in the process arguments.
+func openPullRequest(executor CommandExecutor, spec PullRequestSpec, host GitHubHost, token string, baseEnv []string) error {
+	defer logGroup("Opening Pull Request")()
+
+	basicAuth := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + token))
+	extraHeader := "http." + host.WebURL + "/.extraheader"
+	overrides := map[string]string{
+		"GH_TOKEN":           token,
+		"GIT_CONFIG_COUNT":   "2",
+		"GIT_CONFIG_KEY_0":   extraHeader,
+		"GIT_CONFIG_VALUE_0": "",
+		"GIT_CONFIG_KEY_1":   extraHeader,
+		"GIT_CONFIG_VALUE_1": "AUTHORIZATION: basic " + basicAuth,
+	}
+	if !host.IsDotCom() {
+		// gh ignores GH_TOKEN for enterprise hosts and would fall back to the
+		// Copilot token in hosts.yml.
+		overrides["GH_ENTERPRISE_TOKEN"] = token
+		overrides["GITHUB_ENTERPRISE_TOKEN"] = token
+	}
+	env := overrideEnv(baseEnv, overrides)
+	author := spec.Author
+	if author.Name == "" {
+		author = defaultGitIdentity
+	}
+	gitIdentity := []string{"-c", "user.name=" + author.Name, "-c", "user.email=" + author.Email}
+
+	commands := [][]string{
+		{"git", "checkout", "-B", spec.Branch},
+		{"git", "add", "-A"},
+		append(append([]string{"git"}, gitIdentity...), "commit", "-m", spec.Title),
+		// The lease with an empty value refuses to overwrite a branch that
+		// already exists on the remote, e.g. a pr_branch with human commits.
+		{"git", "push", "--force-with-lease=" + spec.Branch + ":", "-u", "origin", spec.Branch},
+	}
+	for _, cmdArgs := range commands {
+		if err := executor.RunCommand(cmdArgs[0], cmdArgs[1:], env, os.Stdout, os.Stderr); err != nil {
+			return fmt.Errorf("failed to run %v: %w", cmdArgs, err)
+		}
+	}
+
+	args := []string{"pr", "create", "--base", spec.Base, "--head", spec.Branch, "--title", spec.Title, "--body", spec.Body}
+	if spec.Repository != "" {
+		args = append(args, "--repo", spec.Repository)
+	}
+	for _, label := range spec.Labels {
+		args = append(args, "--label", label)
+	}
+	if err := executor.RunCommand("gh", args, env, os.Stdout, os.Stderr); err != nil {
+		return fmt.Errorf("failed to create pull request: %w", err)
+	}
+	return nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
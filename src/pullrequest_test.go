@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestOpenPullRequest(t *testing.T) {
+	spec := PullRequestSpec{
+		Repository: "o/r",
+		Base:       "main",
+		Branch:     "agent/audit",
+		Title:      "chore: audit",
+		Body:       "body",
+		Labels:     []string{"automated-pr", "ai"},
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		var calls []string
+		var prEnv []string
+		mock := &MockCommandExecutor{
+			RunFunc: func(name string, args []string, env []string, stdout, stderr io.Writer) error {
+				calls = append(calls, name+" "+strings.Join(args, " "))
+				if name == "gh" {
+					prEnv = env
+				}
+				return nil
+			},
+		}
+
+		if err := openPullRequest(mock, spec, GitHubHost{Name: "github.com", WebURL: "https://github.com"}, "tok", nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(calls) != 5 {
+			t.Fatalf("expected 5 calls, got %d: %v", len(calls), calls)
+		}
+		if calls[3] != "git push --force-with-lease=agent/audit: -u origin agent/audit" {
+			t.Errorf("push must not overwrite an existing remote branch, got %s", calls[3])
+		}
+		last := calls[4]
+		for _, want := range []string{"pr create", "--base main", "--head agent/audit", "--repo o/r", "--label automated-pr", "--label ai"} {
+			if !strings.Contains(last, want) {
+				t.Errorf("gh call should contain %q, got %s", want, last)
+			}
+		}
+		envText := strings.Join(prEnv, "\n")
+		if !strings.Contains(envText, "GH_TOKEN=tok") {
+			t.Error("gh pr create should receive GH_TOKEN")
+		}
+		if !strings.Contains(envText, "GIT_CONFIG_KEY_1=http.https://github.com/.extraheader") {
+			t.Error("git should authenticate with the repository token")
+		}
+		for _, call := range calls {
+			if strings.Contains(call, "x-access-token") {
+				t.Errorf("token must not appear in command arguments: %s", call)
+			}
+		}
+	})
+
+	t.Run("Enterprise host", func(t *testing.T) {
+		var prEnv []string
+		mock := &MockCommandExecutor{
+			RunFunc: func(name string, args []string, env []string, stdout, stderr io.Writer) error {
+				if name == "gh" {
+					prEnv = env
+				}
+				return nil
+			},
+		}
+		host := GitHubHost{Name: "ghe.example.com", WebURL: "https://ghe.example.com", APIURL: "https://ghe.example.com/api/v3"}
+		base := []string{"GH_ENTERPRISE_TOKEN=copilot-seat"}
+		if err := openPullRequest(mock, spec, host, "tok", base); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		envText := strings.Join(prEnv, "\n")
+		for _, want := range []string{"GH_TOKEN=tok", "GH_ENTERPRISE_TOKEN=tok", "GITHUB_ENTERPRISE_TOKEN=tok"} {
+			if !strings.Contains(envText, want) {
+				t.Errorf("gh pr create should receive %s, got:\n%s", want, envText)
+			}
+		}
+		if strings.Contains(envText, "copilot-seat") {
+			t.Error("the Copilot token must not reach gh pr create")
+		}
+	})
+
+	t.Run("App author", func(t *testing.T) {
+		var commit string
+		mock := &MockCommandExecutor{
+			RunFunc: func(name string, args []string, env []string, stdout, stderr io.Writer) error {
+				if strings.Contains(strings.Join(args, " "), "commit") {
+					commit = strings.Join(args, " ")
+				}
+				return nil
+			},
+		}
+		appSpec := spec
+		appSpec.Author = GitIdentity{Name: "audit-bot[bot]", Email: "99+audit-bot[bot]@users.noreply.github.com"}
+		if err := openPullRequest(mock, appSpec, GitHubHost{Name: "github.com", WebURL: "https://github.com"}, "tok", nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(commit, "user.name=audit-bot[bot]") || !strings.Contains(commit, "user.email=99+audit-bot[bot]@users.noreply.github.com") {
+			t.Errorf("commit should use the App's bot identity, got %s", commit)
+		}
+	})
+
+	t.Run("Push failure", func(t *testing.T) {
+		mock := &MockCommandExecutor{
+			RunFunc: func(name string, args []string, env []string, stdout, stderr io.Writer) error {
+				if len(args) > 0 && args[0] == "push" {
+					return fmt.Errorf("denied")
+				}
+				return nil
+			},
+		}
+		if err := openPullRequest(mock, spec, GitHubHost{Name: "github.com", WebURL: "https://github.com"}, "tok", nil); err == nil {
+			t.Error("expected error when push fails")
+		}
+	})
+}
+
+func TestSplitList(t *testing.T) {
+	got := splitList("a, b,\nc,,")
+	if strings.Join(got, "|") != "a|b|c" {
+		t.Errorf("unexpected list: %v", got)
+	}
+}
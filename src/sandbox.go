@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Sandbox is the HOME/XDG_CONFIG_HOME that child processes see during a run.
+// When isolated, it lives in a temporary directory that is wiped on exit so
+// credentials written to hosts.yml never outlive the mission.
+type Sandbox struct {
+	Home       string
+	ConfigHome string
+	DataHome   string
+	Isolated   bool
+	root       string
+	env        []string
+}
+
+func newSandbox(isolate bool) (*Sandbox, error) {
+	realHome := os.Getenv("HOME")
+	dataHome := getEnvOrDefault("XDG_DATA_HOME", filepath.Join(realHome, ".local", "share"))
+	if !isolate {
+		return &Sandbox{
+			Home:       realHome,
+			ConfigHome: getEnvOrDefault("XDG_CONFIG_HOME", filepath.Join(realHome, ".config")),
+			DataHome:   dataHome,
+			env:        os.Environ(),
+		}, nil
+	}
+
+	root, err := os.MkdirTemp(ciProvider.TempDir(), "agentic-audits-home-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sandbox dir: %w", err)
+	}
+	home := filepath.Join(root, "home")
+	configHome := filepath.Join(home, ".config")
+	if err := os.MkdirAll(configHome, 0700); err != nil {
+		os.RemoveAll(root)
+		return nil, fmt.Errorf("failed to create sandbox config dir: %w", err)
+	}
+
+	// Data and cache stay in the real HOME so installed gh extensions and npm
+	// caches are still found; only config (and with it the token) is isolated.
+	s := &Sandbox{
+		Home:       home,
+		ConfigHome: configHome,
+		DataHome:   dataHome,
+		Isolated:   true,
+		root:       root,
+		env: overrideEnv(os.Environ(), map[string]string{
+			"HOME":            home,
+			"XDG_CONFIG_HOME": configHome,
+			"XDG_DATA_HOME":   dataHome,
+			"XDG_CACHE_HOME":  getEnvOrDefault("XDG_CACHE_HOME", filepath.Join(realHome, ".cache")),
+		}),
+	}
+
+	logInfo("Using isolated HOME: %s", home)
+	return s, nil
+}
+
+// Environ returns the environment for child processes.
+func (s *Sandbox) Environ() []string {
+	return append([]string{}, s.env...)
+}
+
+func (s *Sandbox) Cleanup() error {
+	if !s.Isolated {
+		return nil
+	}
+	return os.RemoveAll(s.root)
+}
+
+// overrideEnv replaces or appends the given variables in env.
+func overrideEnv(env []string, overrides map[string]string) []string {
+	result := make([]string, 0, len(env)+len(overrides))
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		if _, ok := overrides[name]; !ok {
+			result = append(result, kv)
+		}
+	}
+	names := make([]string, 0, len(overrides))
+	for name := range overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		result = append(result, name+"="+overrides[name])
+	}
+	return result
+}
+
+// withoutEnv drops the named variables from env.
+func withoutEnv(env []string, names ...string) []string {
+	drop := make(map[string]bool, len(names))
+	for _, name := range names {
+		drop[name] = true
+	}
+	result := make([]string, 0, len(env))
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		if !drop[name] {
+			result = append(result, kv)
+		}
+	}
+	return result
+}
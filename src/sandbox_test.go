@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewSandbox(t *testing.T) {
+	realHome := t.TempDir()
+	t.Setenv("HOME", realHome)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("RUNNER_TEMP", t.TempDir())
+
+	t.Run("Isolated", func(t *testing.T) {
+		s, err := newSandbox(true)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !s.Isolated || s.Home == realHome {
+			t.Fatalf("expected an isolated home, got %+v", s)
+		}
+
+		env := strings.Join(s.Environ(), "\n")
+		for _, want := range []string{
+			"HOME=" + s.Home,
+			"XDG_CONFIG_HOME=" + s.ConfigHome,
+			"XDG_DATA_HOME=" + filepath.Join(realHome, ".local", "share"),
+		} {
+			if !strings.Contains(env, want) {
+				t.Errorf("sandbox env should contain %q", want)
+			}
+		}
+		if strings.Contains(env, "HOME="+realHome+"\n") {
+			t.Error("sandbox env should not expose the real HOME")
+		}
+
+		secret := filepath.Join(s.ConfigHome, "gh", "hosts.yml")
+		os.MkdirAll(filepath.Dir(secret), 0700)
+		os.WriteFile(secret, []byte("oauth_token: tok"), 0600)
+
+		if err := s.Cleanup(); err != nil {
+			t.Fatalf("cleanup failed: %v", err)
+		}
+		if _, err := os.Stat(s.Home); !os.IsNotExist(err) {
+			t.Error("sandbox should be removed after cleanup")
+		}
+	})
+
+	t.Run("Shared", func(t *testing.T) {
+		s, err := newSandbox(false)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if s.Isolated || s.Home != realHome || s.ConfigHome != filepath.Join(realHome, ".config") {
+			t.Errorf("expected the real home, got %+v", s)
+		}
+		if err := s.Cleanup(); err != nil {
+			t.Errorf("cleanup of shared home should be a no-op, got %v", err)
+		}
+		if _, err := os.Stat(realHome); err != nil {
+			t.Error("shared home must not be removed")
+		}
+	})
+}
+
+func TestOverrideEnv(t *testing.T) {
+	env := overrideEnv([]string{"A=1", "B=2", "C"}, map[string]string{"B": "3", "D": "4"})
+	if strings.Join(env, ",") != "A=1,C,B=3,D=4" {
+		t.Errorf("unexpected env: %v", env)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var envRefPattern = regexp.MustCompile(`\$\{\{\s*env\.([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// resolveSecretRef resolves one MCP env or header value:
+//
+//	${{ env.NAME }}  the environment variable, also inside a longer value ("Bearer ${{ env.TOKEN }}")
+//	secret:NAME      the environment variable NAME, which must be set
+//	file:/path       the file's contents without the trailing newline
+//
+// Anything else is a literal. The second result reports whether the value
+// came from a reference and must be masked.
+func resolveSecretRef(value string, lookupEnv func(string) (string, bool)) (string, bool, error) {
+	switch {
+	case strings.HasPrefix(value, "secret:"):
+		name := strings.TrimPrefix(value, "secret:")
+		resolved, ok := lookupEnv(name)
+		if !ok || resolved == "" {
+			return "", false, fmt.Errorf("secret %s is not set", name)
+		}
+		return resolved, true, nil
+	case strings.HasPrefix(value, "file:"):
+		path := strings.TrimPrefix(value, "file:")
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", false, fmt.Errorf("cannot read %s: %w", path, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), true, nil
+	case envRefPattern.MatchString(value):
+		var missing []string
+		resolved := envRefPattern.ReplaceAllStringFunc(value, func(ref string) string {
+			name := envRefPattern.FindStringSubmatch(ref)[1]
+			v, ok := lookupEnv(name)
+			if !ok {
+				missing = append(missing, name)
+			}
+			return v
+		})
+		if len(missing) > 0 {
+			return "", false, fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+		}
+		return resolved, true, nil
+	}
+	return value, false, nil
+}
+
+// resolveSecretRefs resolves the env and headers of every server in place and
+// masks each resolved value in the Actions log. Errors name the server and
+// key but never a value.
+func resolveSecretRefs(servers map[string]MCPServer, lookupEnv func(string) (string, bool)) error {
+	names := make([]string, 0, len(servers))
+	for name := range servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		server := servers[name]
+		env, err := resolveSecretMap(server.Env, lookupEnv)
+		if err != nil {
+			return fmt.Errorf("MCP server %s env %w", name, err)
+		}
+		headers, err := resolveSecretMap(server.Headers, lookupEnv)
+		if err != nil {
+			return fmt.Errorf("MCP server %s header %w", name, err)
+		}
+		server.Env, server.Headers = env, headers
+		servers[name] = server
+	}
+	return nil
+}
+
+// secretRefNames lists the environment variables the servers' env and
+// headers reference, so they can be kept out of every other process.
+func secretRefNames(servers map[string]MCPServer) []string {
+	seen := make(map[string]bool)
+	for _, server := range servers {
+		for _, values := range []map[string]string{server.Env, server.Headers} {
+			for _, value := range values {
+				if strings.HasPrefix(value, "secret:") {
+					seen[strings.TrimPrefix(value, "secret:")] = true
+				}
+				for _, match := range envRefPattern.FindAllStringSubmatch(value, -1) {
+					seen[match[1]] = true
+				}
+			}
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func resolveSecretMap(values map[string]string, lookupEnv func(string) (string, bool)) (map[string]string, error) {
+	if len(values) == 0 {
+		return values, nil
+	}
+	resolved := make(map[string]string, len(values))
+	for key, value := range values {
+		v, secret, err := resolveSecretRef(value, lookupEnv)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		if secret {
+			maskSecret(v)
+		}
+		resolved[key] = v
+	}
+	return resolved, nil
+}
+
+// redactedConfig renders config for logs with every env and header value
+// replaced, whether or not it came from a reference.
+func redactedConfig(config CopilotConfig) string {
+	redacted := CopilotConfig{MCPServers: make(map[string]MCPServer, len(config.MCPServers))}
+	for name, server := range config.MCPServers {
+		server.Env = redactValues(server.Env)
+		server.Headers = redactValues(server.Headers)
+		redacted.MCPServers[name] = server
+	}
+	data, _ := json.MarshalIndent(redacted, "", "  ")
+	return string(data)
+}
+
+func redactValues(values map[string]string) map[string]string {
+	if len(values) == 0 {
+		return values
+	}
+	redacted := make(map[string]string, len(values))
+	for key := range values {
+		redacted[key] = "***"
+	}
+	return redacted
+}
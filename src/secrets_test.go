@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// captureStdout returns what fn prints to stdout.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	fn()
+	w.Close()
+	out, _ := io.ReadAll(r)
+	return string(out)
+}
+
+func TestResolveSecretRef(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "key")
+	os.WriteFile(keyFile, []byte("file-secret\n"), 0600)
+	lookup := envLookup(map[string]string{"API_KEY": "env-secret", "EMPTY": ""})
+
+	tests := []struct {
+		value, want string
+		secret      bool
+	}{
+		{"plain", "plain", false},
+		{"${{ env.API_KEY }}", "env-secret", true},
+		{"Bearer ${{env.API_KEY}}", "Bearer env-secret", true},
+		{"${{ env.EMPTY }}", "", true},
+		{"secret:API_KEY", "env-secret", true},
+		{"file:" + keyFile, "file-secret", true},
+	}
+	for _, tt := range tests {
+		got, secret, err := resolveSecretRef(tt.value, lookup)
+		if err != nil || got != tt.want || secret != tt.secret {
+			t.Errorf("resolveSecretRef(%q) = %q, %v, %v; want %q, %v", tt.value, got, secret, err, tt.want, tt.secret)
+		}
+	}
+
+	for _, value := range []string{"${{ env.MISSING }}", "secret:MISSING", "secret:EMPTY", "file:/does/not/exist"} {
+		if _, _, err := resolveSecretRef(value, lookup); err == nil {
+			t.Errorf("resolveSecretRef(%q): expected an error", value)
+		}
+	}
+}
+
+func TestResolveSecretRefs(t *testing.T) {
+	lookup := envLookup(map[string]string{"CONTEXT7_API_KEY": "c7-secret", "REMOTE_TOKEN": "remote-secret"})
+	servers := map[string]MCPServer{
+		"context7": {Command: "npx", Args: []string{"-y", "c7"}, Env: map[string]string{"API_KEY": "secret:CONTEXT7_API_KEY", "MODE": "fast"}},
+		"remote":   {Type: "http", URL: "https://mcp.example.com", Headers: map[string]string{"Authorization": "Bearer ${{ env.REMOTE_TOKEN }}"}},
+	}
+
+	out := captureStdout(t, func() {
+		if err := resolveSecretRefs(servers, lookup); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+	if servers["context7"].Env["API_KEY"] != "c7-secret" || servers["context7"].Env["MODE"] != "fast" || servers["remote"].Headers["Authorization"] != "Bearer remote-secret" {
+		t.Errorf("unexpected servers %+v", servers)
+	}
+	if out != "::add-mask::c7-secret\n::add-mask::Bearer remote-secret\n" {
+		t.Errorf("resolved values should be masked, got %q", out)
+	}
+
+	logged := redactedConfig(CopilotConfig{MCPServers: servers})
+	if strings.Contains(logged, "secret") || !strings.Contains(logged, `"API_KEY": "***"`) || !strings.Contains(logged, `"Authorization": "***"`) {
+		t.Errorf("logged config leaks values:\n%s", logged)
+	}
+
+	bad := map[string]MCPServer{"broken": {Env: map[string]string{"TOKEN": "secret:NOT_SET"}}}
+	err := resolveSecretRefs(bad, lookup)
+	if err == nil || err.Error() != "MCP server broken env TOKEN: secret NOT_SET is not set" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestSecretRefNames(t *testing.T) {
+	servers := map[string]MCPServer{
+		"context7": {Env: map[string]string{"API_KEY": "secret:CONTEXT7_API_KEY", "MODE": "fast"}},
+		"remote":   {Headers: map[string]string{"Authorization": "Bearer ${{ env.REMOTE_TOKEN }}", "X-Team": "${{env.TEAM}}-${{ env.REMOTE_TOKEN }}"}},
+		"file":     {Env: map[string]string{"KEY": "file:/run/key"}},
+	}
+	if got := strings.Join(secretRefNames(servers), ","); got != "CONTEXT7_API_KEY,REMOTE_TOKEN,TEAM" {
+		t.Errorf("unexpected names: %s", got)
+	}
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
 
@@ -11,8 +15,7 @@ func installGitHubCLI(executor CommandExecutor) error {
 	// Let's assume the caller handles basic existence check or the executor does.
 	// Actually, let's keep it simple and just run the commands.
 	
-	fmt.Println("::group::Installing GitHub CLI")
-	defer fmt.Println("::endgroup::")
+	defer logGroup("Installing GitHub CLI")()
 
 
 	// This follows the logic from install_gh.sh for Debian-based systems (common in GH Actions)
@@ -34,14 +37,205 @@ func installGitHubCLI(executor CommandExecutor) error {
 	return nil
 }
 
-func installCopilotExtension(executor CommandExecutor) error {
-	fmt.Println("::group::Installing gh-copilot extension")
-	defer fmt.Println("::endgroup::")
+// installCopilotExtension installs gh-copilot from GitHub, or from a local
+// checkout/cache directory when source is a path (for air-gapped runners).
+// A non-empty version pins the release.
+func installCopilotExtension(executor CommandExecutor, env []string, source, version string) error {
+	defer logGroup("Installing gh-copilot extension")()
 
-	fmt.Println("Installing github/gh-copilot extension...")
-	return executor.RunCommand("gh", []string{"extension", "install", "github/gh-copilot", "--force"}, os.Environ(), os.Stdout, os.Stderr)
+	if source == "" {
+		source = "github/gh-copilot"
+	}
+	args := []string{"extension", "install", source}
+	if version != "" {
+		args = append(args, "--pin", version)
+	}
+	logInfo("Installing %s extension...", source)
+	return executor.RunCommand("gh", args, env, os.Stdout, os.Stderr)
+}
+
+// SetupStep records what setup did for one component.
+type SetupStep struct {
+	Component string
+	Action    string
+	Version   string
+}
+
+type SetupReport struct {
+	Steps []SetupStep
+}
+
+func (r *SetupReport) Add(step SetupStep) {
+	r.Steps = append(r.Steps, step)
 }
 
+func (r SetupReport) String() string {
+	var b strings.Builder
+	for _, step := range r.Steps {
+		version := step.Version
+		if version == "" {
+			version = "unknown"
+		}
+		fmt.Fprintf(&b, "%s: %s (%s)\n", step.Component, step.Action, version)
+	}
+	return b.String()
+}
+
+// ensureGitHubCLI installs gh with the selected strategy and fails if no
+// usable gh is available afterwards.
+func ensureGitHubCLI(executor CommandExecutor, opts InstallOptions) (SetupStep, error) {
+	step := SetupStep{Component: "gh"}
+
+	strategy, err := selectInstallStrategy(executor, opts)
+	if err != nil {
+		return step, err
+	}
+	if err := strategy.Install(executor); err != nil {
+		return step, fmt.Errorf("%s install failed: %w", strategy.Name(), err)
+	}
+
+	step.Version, err = detectGhVersion(executor)
+	if err != nil {
+		return step, fmt.Errorf("gh is required but not usable after setup: %w", err)
+	}
+	step.Action = "installed (" + strategy.Name() + ")"
+	if strategy.Name() == "skip" {
+		step.Action = "reused"
+	}
+	return step, nil
+}
+
+type ExtensionOptions struct {
+	Source   string
+	Version  string
+	CacheDir string
+	DataHome string
+}
+
+// ensureCopilotExtension makes gh-copilot available without reinstalling it on
+// every run: an installed copy (at the pinned version, if any) is reused, then
+// the cache directory (keyed by version) is tried, and only then is the
+// extension installed and stored in the cache for the next run.
+func ensureCopilotExtension(executor CommandExecutor, env []string, opts ExtensionOptions) (SetupStep, error) {
+	step := SetupStep{Component: "gh-copilot"}
+
+	if version, ok := installedCopilotVersion(executor, env); ok && (opts.Version == "" || version == opts.Version) {
+		step.Action, step.Version = "reused", version
+		return step, nil
+	}
+
+	extensionDir := filepath.Join(opts.DataHome, "gh", "extensions", "gh-copilot")
+	if cached := cachedExtensionVersion(opts.CacheDir, opts.Version); cached != "" {
+		os.RemoveAll(extensionDir)
+		if err := copyDir(filepath.Join(opts.CacheDir, cached), extensionDir); err == nil {
+			if version, ok := installedCopilotVersion(executor, env); ok {
+				step.Action, step.Version = "restored from cache", version
+				return step, nil
+			}
+		}
+	}
+
+	// gh extension install refuses to replace an installed extension.
+	if installed, ok := installedCopilotVersion(executor, env); ok {
+		logInfo("Removing gh-copilot %s to install %s", installed, opts.Version)
+		if err := executor.RunCommand("gh", []string{"extension", "remove", "copilot"}, env, os.Stdout, os.Stderr); err != nil {
+			return step, fmt.Errorf("could not remove gh-copilot %s: %w", installed, err)
+		}
+	}
+	if err := installCopilotExtension(executor, env, opts.Source, opts.Version); err != nil {
+		return step, fmt.Errorf("gh-copilot is required but could not be installed: %w", err)
+	}
+	version, ok := installedCopilotVersion(executor, env)
+	if !ok {
+		return step, fmt.Errorf("gh-copilot is required but not listed after install")
+	}
+	step.Action, step.Version = "installed", version
+
+	if opts.CacheDir != "" && version != "" {
+		dest := filepath.Join(opts.CacheDir, version)
+		if _, err := os.Stat(dest); os.IsNotExist(err) {
+			if err := copyDir(extensionDir, dest); err != nil {
+				logWarn("Could not cache gh-copilot %s: %v", version, err)
+			}
+		}
+	}
+	return step, nil
+}
+
+func installedCopilotVersion(executor CommandExecutor, env []string) (string, bool) {
+	var out bytes.Buffer
+	if err := executor.RunCommand("gh", []string{"extension", "list"}, env, &out, io.Discard); err != nil {
+		return "", false
+	}
+	for _, line := range strings.Split(out.String(), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) >= 2 && strings.HasSuffix(strings.TrimSpace(fields[1]), "gh-copilot") {
+			if len(fields) >= 3 {
+				return strings.TrimSpace(fields[2]), true
+			}
+			return "", true
+		}
+	}
+	return "", false
+}
+
+// cachedExtensionVersion returns the cache entry to use: the pinned version if
+// cached, otherwise the newest cached version.
+func cachedExtensionVersion(cacheDir, pinned string) string {
+	if cacheDir == "" {
+		return ""
+	}
+	if pinned != "" {
+		if info, err := os.Stat(filepath.Join(cacheDir, pinned)); err == nil && info.IsDir() {
+			return pinned
+		}
+		return ""
+	}
+
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		return ""
+	}
+	newest := ""
+	for _, entry := range entries {
+		if entry.IsDir() && (newest == "" || compareVersions(entry.Name(), newest) > 0) {
+			newest = entry.Name()
+		}
+	}
+	return newest
+}
+
+// copyDir copies src to dest. A symlinked src (as gh creates for extensions
+// installed from a local directory) is copied as its target; symlinks inside
+// src are recreated as symlinks.
+func copyDir(src, dest string) error {
+	src, err := filepath.EvalSymlinks(src)
+	if err != nil {
+		return err
+	}
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, path)
+		target := filepath.Join(dest, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, info.Mode().Perm())
+	})
+}
 
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && stringContains(s, substr)
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -14,6 +18,10 @@ func (m *MockCommandExecutor) RunCommand(name string, args []string, env []strin
 	return m.RunFunc(name, args, env, stdout, stderr)
 }
 
+func (m *MockCommandExecutor) RunCommandContext(ctx context.Context, name string, args []string, env []string, stdout, stderr io.Writer) error {
+	return m.RunFunc(name, args, env, stdout, stderr)
+}
+
 func TestInstallGitHubCLI(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
 		callCount := 0
@@ -52,13 +60,179 @@ func TestInstallCopilotExtension(t *testing.T) {
 				return nil
 			},
 		}
-		err := installCopilotExtension(mock)
+		err := installCopilotExtension(mock, nil, "", "")
 		if err != nil {
 			t.Errorf("unexpected error: %v", err)
 		}
 	})
 }
 
+func TestInstallCopilotExtensionPinned(t *testing.T) {
+	var got []string
+	mock := &MockCommandExecutor{
+		RunFunc: func(name string, args []string, env []string, stdout, stderr io.Writer) error {
+			got = args
+			return nil
+		},
+	}
+	if err := installCopilotExtension(mock, nil, "/opt/gh-copilot", "v1.0.5"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(got, " ") != "extension install /opt/gh-copilot --pin v1.0.5" {
+		t.Errorf("unexpected args: %v", got)
+	}
+}
+
+// fakeGh emulates gh --version, gh extension list and gh extension install.
+// Installing writes the extension into dataHome so it can be cached.
+type fakeGh struct {
+	version   string
+	extension string
+	dataHome  string
+	installs  int
+	removes   int
+}
+
+func (f *fakeGh) executor() *MockCommandExecutor {
+	return &MockCommandExecutor{
+		RunFunc: func(name string, args []string, env []string, stdout, stderr io.Writer) error {
+			switch strings.Join(args, " ") {
+			case "--version":
+				if f.version == "" {
+					return fmt.Errorf("gh not found")
+				}
+				fmt.Fprintf(stdout, "gh version %s (2024-01-01)\n", f.version)
+				return nil
+			case "extension list":
+				if f.extension == "" {
+					if data, err := os.ReadFile(filepath.Join(f.dataHome, "gh", "extensions", "gh-copilot", "version")); err == nil {
+						f.extension = string(data)
+					}
+				}
+				if f.extension != "" {
+					fmt.Fprintf(stdout, "gh copilot\tgithub/gh-copilot\t%s\n", f.extension)
+				}
+				return nil
+			}
+			if len(args) > 1 && args[0] == "extension" && args[1] == "remove" {
+				f.removes++
+				f.extension = ""
+				return os.RemoveAll(filepath.Join(f.dataHome, "gh", "extensions", "gh-copilot"))
+			}
+			if len(args) > 1 && args[0] == "extension" && args[1] == "install" {
+				if f.extension != "" {
+					return fmt.Errorf("there is already an installed extension that provides the \"copilot\" command")
+				}
+				f.installs++
+				f.extension = "v1.0.5"
+				dir := filepath.Join(f.dataHome, "gh", "extensions", "gh-copilot")
+				os.MkdirAll(dir, 0755)
+				os.WriteFile(filepath.Join(dir, "version"), []byte(f.extension), 0644)
+			}
+			return nil
+		},
+	}
+}
+
+func TestEnsureGitHubCLI(t *testing.T) {
+	t.Run("Reuses existing gh", func(t *testing.T) {
+		gh := &fakeGh{version: "2.50.0"}
+		step, err := ensureGitHubCLI(gh.executor(), InstallOptions{MinVersion: "2.40.0"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if step.Action != "reused" || step.Version != "2.50.0" {
+			t.Errorf("unexpected step: %+v", step)
+		}
+	})
+
+	t.Run("Fails fast when gh is unusable", func(t *testing.T) {
+		gh := &fakeGh{}
+		if _, err := ensureGitHubCLI(gh.executor(), InstallOptions{Mode: "skip"}); err == nil {
+			t.Error("expected error when gh is missing after setup")
+		}
+	})
+}
+
+func TestEnsureCopilotExtension(t *testing.T) {
+	t.Run("Reuses installed extension", func(t *testing.T) {
+		gh := &fakeGh{extension: "v1.0.5", dataHome: t.TempDir()}
+		step, err := ensureCopilotExtension(gh.executor(), nil, ExtensionOptions{DataHome: gh.dataHome})
+		if err != nil || step.Action != "reused" || gh.installs != 0 {
+			t.Errorf("expected reuse without install, got %+v (%v, %d installs)", step, err, gh.installs)
+		}
+	})
+
+	t.Run("Installs, caches, then restores from cache", func(t *testing.T) {
+		cacheDir := t.TempDir()
+		gh := &fakeGh{dataHome: t.TempDir()}
+		step, err := ensureCopilotExtension(gh.executor(), nil, ExtensionOptions{DataHome: gh.dataHome, CacheDir: cacheDir})
+		if err != nil || step.Action != "installed" {
+			t.Fatalf("expected install, got %+v (%v)", step, err)
+		}
+		if _, err := os.Stat(filepath.Join(cacheDir, "v1.0.5", "version")); err != nil {
+			t.Fatalf("extension should be cached by version: %v", err)
+		}
+
+		fresh := &fakeGh{dataHome: t.TempDir()}
+		step, err = ensureCopilotExtension(fresh.executor(), nil, ExtensionOptions{DataHome: fresh.dataHome, CacheDir: cacheDir, Version: "v1.0.5"})
+		if err != nil || step.Action != "restored from cache" || fresh.installs != 0 {
+			t.Errorf("expected cache restore, got %+v (%v, %d installs)", step, err, fresh.installs)
+		}
+	})
+
+	t.Run("Replaces an installed extension at another version", func(t *testing.T) {
+		gh := &fakeGh{extension: "v1.0.4", dataHome: t.TempDir()}
+		step, err := ensureCopilotExtension(gh.executor(), nil, ExtensionOptions{DataHome: gh.dataHome, Version: "v1.0.5"})
+		if err != nil || step.Action != "installed" || step.Version != "v1.0.5" || gh.removes != 1 {
+			t.Errorf("expected v1.0.4 to be replaced, got %+v (%v, %d removes)", step, err, gh.removes)
+		}
+	})
+
+	t.Run("Fails fast when install fails", func(t *testing.T) {
+		mock := &MockCommandExecutor{
+			RunFunc: func(name string, args []string, env []string, stdout, stderr io.Writer) error {
+				return fmt.Errorf("offline")
+			},
+		}
+		if _, err := ensureCopilotExtension(mock, nil, ExtensionOptions{DataHome: t.TempDir()}); err == nil {
+			t.Error("expected error when the extension cannot be installed")
+		}
+	})
+}
+
+func TestCopyDirSymlinks(t *testing.T) {
+	checkout := t.TempDir()
+	os.WriteFile(filepath.Join(checkout, "gh-copilot"), []byte("#!/bin/sh\n"), 0755)
+	os.Symlink("gh-copilot", filepath.Join(checkout, "copilot"))
+	// gh links extensions installed from a local directory.
+	extension := filepath.Join(t.TempDir(), "gh-copilot")
+	os.Symlink(checkout, extension)
+
+	dest := filepath.Join(t.TempDir(), "v1.0.5")
+	if err := copyDir(extension, dest); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info, err := os.Lstat(dest); err != nil || !info.IsDir() {
+		t.Errorf("a symlinked extension should be copied as a directory: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dest, "gh-copilot")); err != nil || string(data) != "#!/bin/sh\n" {
+		t.Errorf("unexpected copy: %q (%v)", data, err)
+	}
+	if link, err := os.Readlink(filepath.Join(dest, "copilot")); err != nil || link != "gh-copilot" {
+		t.Errorf("inner symlinks should be kept, got %q (%v)", link, err)
+	}
+}
+
+func TestSetupReport(t *testing.T) {
+	var report SetupReport
+	report.Add(SetupStep{Component: "gh", Action: "reused", Version: "2.50.0"})
+	report.Add(SetupStep{Component: "gh-copilot", Action: "installed"})
+	if report.String() != "gh: reused (2.50.0)\ngh-copilot: installed (unknown)\n" {
+		t.Errorf("unexpected report: %q", report.String())
+	}
+}
+
 func TestContains(t *testing.T) {
 	if !contains("hello world", "world") {
 		t.Error("expected true")
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SourceLayer is one level of the sources configuration. Later layers
+// override earlier ones by source name.
+type SourceLayer struct {
+	Name    string
+	Sources []Source
+}
+
+// EffectiveSource is a merged source and the layer it came from.
+type EffectiveSource struct {
+	Source
+	Layer string
+	// Overrides lists the fields later layers changed, e.g. "url from repo".
+	Overrides []string
+}
+
+// mergeSourceLayers merges layers in order. An entry overrides only the
+// fields it sets on the earlier entry of the same name (so `enabled: false`
+// disables it, and an entry that only sets `url` keeps it enabled) and
+// `remove: true` deletes it. Mandatory entries cannot be changed, disabled or
+// removed by later layers.
+func mergeSourceLayers(layers []SourceLayer) []EffectiveSource {
+	var merged []EffectiveSource
+	find := func(name string) int {
+		for i, s := range merged {
+			if s.Name == name {
+				return i
+			}
+		}
+		return -1
+	}
+
+	for _, layer := range layers {
+		for _, source := range layer.Sources {
+			i := find(source.Name)
+			if i >= 0 && merged[i].Mandatory {
+				logWarn("Source %s is mandatory in %s; ignoring the override from %s", source.Name, merged[i].Layer, layer.Name)
+				continue
+			}
+			switch {
+			case source.Remove:
+				if i >= 0 {
+					merged = append(merged[:i], merged[i+1:]...)
+				}
+			case i >= 0 && source.keys != nil:
+				fields := overrideSource(&merged[i].Source, source)
+				merged[i].Overrides = append(merged[i].Overrides, strings.Join(fields, ", ")+" from "+layer.Name)
+			case i >= 0:
+				merged[i] = EffectiveSource{Source: source, Layer: layer.Name}
+			default:
+				merged = append(merged, EffectiveSource{Source: source, Layer: layer.Name})
+			}
+		}
+	}
+	return merged
+}
+
+// overrideSource copies the fields override sets onto base and returns
+// their keys.
+func overrideSource(base *Source, override Source) []string {
+	var fields []string
+	for _, key := range override.keys {
+		switch key {
+		case "type":
+			base.Type = override.Type
+		case "package":
+			base.Package = override.Package
+		case "url":
+			base.URL = override.URL
+		case "enabled":
+			base.Enabled = override.Enabled
+		case "optional":
+			base.Optional = override.Optional
+		case "when":
+			base.When = override.When
+		case "mandatory":
+			base.Mandatory = override.Mandatory
+		case "env":
+			base.Env = override.Env
+		case "headers":
+			base.Headers = override.Headers
+		default:
+			continue
+		}
+		fields = append(fields, key)
+	}
+	return fields
+}
+
+// sourceLayers builds the org, repository and mission layers for cfg.
+func sourceLayers(cfg *RunConfig, orgSources []Source) []SourceLayer {
+	var layers []SourceLayer
+	if cfg.OrgSources != "" {
+		layers = append(layers, SourceLayer{Name: "org " + cfg.OrgSources, Sources: orgSources})
+	}
+	repoSources, err := readSources(cfg.SourcesConfig)
+	if err != nil {
+		// A broken repository file doesn't stop the mission; it runs without those sources.
+		logError("Error parsing sources: %v", err)
+	}
+	layers = append(layers, SourceLayer{Name: cfg.SourcesConfig, Sources: repoSources})
+	if cfg.Spec != nil && len(cfg.Spec.Sources) > 0 {
+		layers = append(layers, SourceLayer{Name: "mission " + cfg.MissionName, Sources: cfg.Spec.Sources})
+	}
+	return layers
+}
+
+// formatEffectiveSources renders merged sources as sources.yml, noting the
+// layer each entry came from.
+func formatEffectiveSources(sources []EffectiveSource) string {
+	var b strings.Builder
+	b.WriteString("sources:\n")
+	for _, s := range sources {
+		data, _ := yaml.Marshal([]Source{s.Source})
+		fmt.Fprintf(&b, "  # from %s\n", s.Layer)
+		for _, override := range s.Overrides {
+			fmt.Fprintf(&b, "  # %s\n", override)
+		}
+		for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+			b.WriteString("  " + line + "\n")
+		}
+	}
+	return b.String()
+}
+
+// loadOrgSources loads the organization layer from a local file, an https
+// URL, or a file in another repository given as owner/repo/path[@ref].
+func loadOrgSources(client HTTPClient, host GitHubHost, token, location string) ([]Source, error) {
+	if location == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(location); err == nil {
+		return readSources(location)
+	}
+
+	var req *http.Request
+	var err error
+	if strings.HasPrefix(location, "https://") {
+		req, err = http.NewRequest(http.MethodGet, location, nil)
+	} else {
+		spec, ref, _ := strings.Cut(location, "@")
+		parts := strings.SplitN(spec, "/", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("org sources %q is neither a file, an https URL nor owner/repo/path[@ref]", location)
+		}
+		endpoint := fmt.Sprintf("%s/repos/%s/%s/contents/%s", host.APIURL, parts[0], parts[1], parts[2])
+		if ref != "" {
+			endpoint += "?ref=" + url.QueryEscape(ref)
+		}
+		req, err = http.NewRequest(http.MethodGet, endpoint, nil)
+		if err == nil {
+			req.Header.Set("Accept", "application/vnd.github.raw")
+			if token != "" {
+				req.Header.Set("Authorization", "token "+token)
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch org sources: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch org sources %s: %s", location, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch org sources: %w", err)
+	}
+	sources, err := decodeSources(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid org sources %s: %w", location, err)
+	}
+	return sources, nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMergeSourceLayers(t *testing.T) {
+	layers := []SourceLayer{
+		{Name: "org", Sources: []Source{
+			{Name: "security", Type: "mcp", Package: "sec-mcp", Enabled: true, Mandatory: true},
+			{Name: "context7", Type: "mcp", Package: "@upstash/context7-mcp", Enabled: true},
+			{Name: "style-guide", Type: "web", URL: "https://org.example/style", Enabled: true},
+		}},
+		{Name: ".github/sources.yml", Sources: []Source{
+			{Name: "context7", Type: "mcp", Package: "@upstash/context7-mcp@^1", Enabled: true},
+			{Name: "style-guide", Remove: true},
+			{Name: "security", Enabled: false},
+			{Name: "repo-docs", Type: "web", URL: "https://repo.example", Enabled: true},
+		}},
+		{Name: "mission docs", Sources: []Source{
+			{Name: "context7", Type: "mcp", Package: "@upstash/context7-mcp@^1", Enabled: false},
+			{Name: "unknown", Remove: true},
+		}},
+	}
+
+	merged := mergeSourceLayers(layers)
+	var got []string
+	for _, s := range merged {
+		got = append(got, s.Name+"@"+s.Layer)
+	}
+	want := "security@org,context7@mission docs,repo-docs@.github/sources.yml"
+	if strings.Join(got, ",") != want {
+		t.Fatalf("merged = %v, want %s", got, want)
+	}
+	if !merged[0].Enabled || merged[1].Enabled || merged[1].Package != "@upstash/context7-mcp@^1" {
+		t.Errorf("unexpected merge result: %+v", merged)
+	}
+
+	out := formatEffectiveSources(merged)
+	for _, want := range []string{"sources:\n  # from org\n  - name: security\n", "    mandatory: true\n", "  # from mission docs\n  - name: context7\n", "    enabled: false\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in:\n%s", want, out)
+		}
+	}
+	if _, err := decodeSources([]byte(out)); err != nil {
+		t.Errorf("effective config should be valid sources.yml: %v", err)
+	}
+}
+
+func TestMergeSourceLayersFieldOverride(t *testing.T) {
+	org, err := decodeSources([]byte("- name: docs\n  type: web\n  url: https://org.example\n  enabled: true\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := decodeSources([]byte("- name: docs\n  url: https://repo.example\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	merged := mergeSourceLayers([]SourceLayer{{Name: "org", Sources: org}, {Name: "repo", Sources: repo}})
+	if len(merged) != 1 || !merged[0].Enabled || merged[0].Type != "web" || merged[0].URL != "https://repo.example" {
+		t.Fatalf("unset fields should be inherited, got %+v", merged)
+	}
+	out := formatEffectiveSources(merged)
+	if !strings.Contains(out, "  # from org\n  # url from repo\n  - name: docs\n") {
+		t.Errorf("expected the override to be noted in:\n%s", out)
+	}
+}
+
+func TestLoadOrgSources(t *testing.T) {
+	host := GitHubHost{Name: "github.com", APIURL: "https://api.github.com"}
+	orgYAML := "sources:\n  - name: security\n    type: mcp\n    package: sec-mcp\n    enabled: true\n"
+
+	t.Run("Local file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "org.yml")
+		os.WriteFile(path, []byte(orgYAML), 0644)
+		sources, err := loadOrgSources(&MockHTTPClient{}, host, "", path)
+		if err != nil || len(sources) != 1 || sources[0].Name != "security" {
+			t.Errorf("unexpected result %v (%v)", sources, err)
+		}
+	})
+
+	t.Run("Repository ref", func(t *testing.T) {
+		var requested *http.Request
+		client := &MockHTTPClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+			requested = req
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(orgYAML))}, nil
+		}}
+		sources, err := loadOrgSources(client, host, "tok", "my-org/.github/agentic/sources.yml@v2")
+		if err != nil || len(sources) != 1 {
+			t.Fatalf("unexpected result %v (%v)", sources, err)
+		}
+		if requested.URL.String() != "https://api.github.com/repos/my-org/.github/contents/agentic/sources.yml?ref=v2" {
+			t.Errorf("unexpected URL %s", requested.URL)
+		}
+		if requested.Header.Get("Authorization") != "token tok" || requested.Header.Get("Accept") != "application/vnd.github.raw" {
+			t.Errorf("unexpected headers %v", requested.Header)
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		notFound := &MockHTTPClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusNotFound, Status: "404 Not Found", Body: io.NopCloser(strings.NewReader(""))}, nil
+		}}
+		if _, err := loadOrgSources(notFound, host, "", "my-org/repo/sources.yml"); err == nil || !strings.Contains(err.Error(), "404") {
+			t.Errorf("expected 404 error, got %v", err)
+		}
+		if _, err := loadOrgSources(notFound, host, "", "missing.yml"); err == nil || !strings.Contains(err.Error(), "owner/repo/path") {
+			t.Errorf("expected format error, got %v", err)
+		}
+	})
+}
+
+func TestPrintSources(t *testing.T) {
+	dir := t.TempDir()
+	orgPath := filepath.Join(dir, "org.yml")
+	os.WriteFile(orgPath, []byte("- name: security\n  type: mcp\n  package: sec-mcp\n  enabled: true\n  mandatory: true\n"), 0644)
+	repoPath := filepath.Join(dir, "sources.yml")
+	os.WriteFile(repoPath, []byte("- name: security\n  remove: true\n- name: docs\n  type: web\n  url: https://example.com\n  enabled: true\n"), 0644)
+
+	var err error
+	out := captureStdout(t, func() {
+		err = run([]string{"--print-sources", "--org-sources", orgPath, "--sources-config", repoPath, "--mission", "x"}, &MockCommandExecutor{}, &MockHTTPClient{})
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{"# from org " + orgPath, "name: security", "# from " + repoPath, "name: docs", "is mandatory"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in:\n%s", want, out)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"strings"
 
@@ -10,18 +11,54 @@ import (
 type Source struct {
 	Name    string `yaml:"name"`
 	Type    string `yaml:"type"`
-	Package string `yaml:"package"`
-	URL     string `yaml:"url"`
+	Package string `yaml:"package,omitempty"`
+	URL     string `yaml:"url,omitempty"`
 	Enabled bool   `yaml:"enabled"`
+	// Optional MCP servers are dropped instead of failing the run when their health check fails.
+	Optional bool `yaml:"optional,omitempty"`
+	// When is a condition (see parseCondition) that must hold for the source to be used.
+	When string `yaml:"when,omitempty"`
+	// Remove deletes a source of the same name defined by an earlier layer.
+	Remove bool `yaml:"remove,omitempty"`
+	// Mandatory sources cannot be overridden, disabled or removed by later layers.
+	Mandatory bool `yaml:"mandatory,omitempty"`
+	// Env and Headers of MCP servers may reference secrets, see resolveSecretRefs.
+	Env     map[string]string `yaml:"env,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+
+	// keys are the YAML keys the entry set, in order; nil for sources built
+	// in code. Layers only override the fields an entry sets.
+	keys []string `yaml:"-"`
+}
+
+// sourceKeys are the YAML keys of a Source entry.
+var sourceKeys = []string{"name", "type", "package", "url", "enabled", "optional", "when", "remove", "mandatory", "env", "headers"}
+
+// UnmarshalYAML records which keys the entry sets.
+func (s *Source) UnmarshalYAML(node *yaml.Node) error {
+	type plain Source
+	if err := node.Decode((*plain)(s)); err != nil {
+		return err
+	}
+	s.keys = []string{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		s.keys = append(s.keys, node.Content[i].Value)
+	}
+	return nil
 }
 
 type Config struct {
 	Sources []Source `yaml:"sources"`
 }
 
+// MCPServer is a local (command) or remote (type http with url) MCP server.
 type MCPServer struct {
-	Command string   `json:"command"`
-	Args    []string `json:"args"`
+	Type    string            `json:"type,omitempty"`
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
 }
 
 type CopilotConfig struct {
@@ -31,52 +68,64 @@ type CopilotConfig struct {
 type ProcessedSources struct {
 	MCPServers  map[string]MCPServer
 	MCPPackages []string
+	Optional    map[string]bool
 	WebSources  string
+	Web         []Source
 }
 
 func parseSources(configPath string) (ProcessedSources, error) {
-	result := ProcessedSources{
-		MCPServers:  make(map[string]MCPServer),
-		MCPPackages: []string{},
+	sources, err := readSources(configPath)
+	if err != nil {
+		return ProcessedSources{
+			MCPServers:  make(map[string]MCPServer),
+			MCPPackages: []string{},
+		}, err
 	}
+	return processSources(sources), nil
+}
 
+// readSources loads the source list from configPath. A missing file has no sources.
+func readSources(configPath string) ([]Source, error) {
 	if configPath == "" {
-		return result, nil
+		return nil, nil
 	}
 
 	data, err := os.ReadFile(configPath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return result, nil
+			return nil, nil
 		}
-		return result, err
-	}
-
-	// The current logic in JS seems to manually parse YAML-like structure.
-	// We'll use a proper YAML parser.
-	var config struct {
-		Sources []Source `yaml:"sources"`
+		return nil, err
 	}
+	return decodeSources(data)
+}
 
-	// The JS script seems to expect a list of sources directly or under a 'sources' key?
-	// Let's check the JS logic again. It matches line by line:
-	// - name: ...
-	// type: ...
-	// package: ...
-	// url: ...
-	// enabled: ...
-	
-	// This structure is a slice of Source.
+// decodeSources accepts both a bare list of sources and a map with a 'sources' key.
+func decodeSources(data []byte) ([]Source, error) {
 	var sources []Source
-	err = yaml.Unmarshal(data, &sources)
-	if err != nil {
-		// Try parsing as a map with 'sources' key just in case
-		err = yaml.Unmarshal(data, &config)
-		if err != nil {
-			return result, err
+	if err := yaml.Unmarshal(data, &sources); err != nil {
+		var config Config
+		if err := yaml.Unmarshal(data, &config); err != nil {
+			return nil, err
 		}
 		sources = config.Sources
 	}
+	for _, source := range sources {
+		if source.When != "" {
+			if _, err := parseCondition(source.When); err != nil {
+				return nil, fmt.Errorf("source %s: %w", source.Name, err)
+			}
+		}
+	}
+	return sources, nil
+}
+
+// processSources turns enabled sources into MCP servers and prompt context.
+func processSources(sources []Source) ProcessedSources {
+	result := ProcessedSources{
+		MCPServers:  make(map[string]MCPServer),
+		MCPPackages: []string{},
+	}
 
 	var webUrls []string
 	for _, s := range sources {
@@ -86,16 +135,32 @@ func parseSources(configPath string) (ProcessedSources, error) {
 
 		switch s.Type {
 		case "mcp":
-			if s.Package != "" {
-				result.MCPServers[s.Name] = MCPServer{
-					Command: "npx",
-					Args:    []string{"-y", s.Package},
+			if s.Package != "" || s.URL != "" {
+				if s.Package != "" {
+					result.MCPServers[s.Name] = MCPServer{
+						Command: "npx",
+						Args:    []string{"-y", s.Package},
+						Env:     s.Env,
+					}
+					result.MCPPackages = append(result.MCPPackages, s.Package)
+				} else {
+					result.MCPServers[s.Name] = MCPServer{
+						Type:    "http",
+						URL:     s.URL,
+						Headers: s.Headers,
+					}
+				}
+				if s.Optional {
+					if result.Optional == nil {
+						result.Optional = make(map[string]bool)
+					}
+					result.Optional[s.Name] = true
 				}
-				result.MCPPackages = append(result.MCPPackages, s.Package)
 			}
 		case "web":
 			if s.URL != "" {
 				webUrls = append(webUrls, s.URL)
+				result.Web = append(result.Web, s)
 			}
 		}
 	}
@@ -104,5 +169,5 @@ func parseSources(configPath string) (ProcessedSources, error) {
 		result.WebSources = "Also consult these documentation sources: " + strings.Join(webUrls, ", ")
 	}
 
-	return result, nil
+	return result
 }
@@ -2,6 +2,8 @@ package main
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -27,6 +29,7 @@ func TestParseSources(t *testing.T) {
   type: mcp
   package: test-package
   enabled: true
+  optional: true
 - name: test-web
   type: web
   url: https://example.com
@@ -66,6 +69,12 @@ func TestParseSources(t *testing.T) {
 	if res.WebSources != "Also consult these documentation sources: https://example.com" {
 		t.Errorf("unexpected web sources: %s", res.WebSources)
 	}
+	if !res.Optional["test-mcp"] || res.Optional["disabled"] {
+		t.Errorf("unexpected optional servers: %v", res.Optional)
+	}
+	if len(res.Web) != 1 || res.Web[0].Name != "test-web" {
+		t.Errorf("expected test-web to be kept for fetching, got %v", res.Web)
+	}
 
 	// Test invalid YAML
 	invalidContent := `
@@ -127,3 +136,11 @@ func TestResolveMission(t *testing.T) {
 		t.Error("expected error for missing template")
 	}
 }
+
+func TestReadSourcesValidatesConditions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sources.yml")
+	os.WriteFile(path, []byte("sources:\n  - name: docs\n    type: web\n    url: https://example.com\n    enabled: true\n    when: template ==\n"), 0644)
+	if _, err := readSources(path); err == nil || !strings.Contains(err.Error(), "source docs") {
+		t.Errorf("expected condition error, got %v", err)
+	}
+}
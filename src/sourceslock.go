@@ -0,0 +1,393 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultSourcesLock = ".github/sources.lock"
+	defaultNPMRegistry = "https://registry.npmjs.org"
+)
+
+// SourcesLock pins every MCP package spec from the sources configs to an
+// exact version, keyed by the spec as written (e.g. "@scope/pkg@^1.2").
+type SourcesLock struct {
+	LockfileVersion int                      `json:"lockfileVersion"`
+	Packages        map[string]LockedPackage `json:"packages"`
+}
+
+type LockedPackage struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	Resolved  string `json:"resolved"`
+	Integrity string `json:"integrity"`
+}
+
+// Pinned is the spec npx is started with.
+func (p LockedPackage) Pinned() string {
+	return p.Name + "@" + p.Version
+}
+
+func readSourcesLock(path string) (*SourcesLock, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var lock SourcesLock
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("invalid lock file %s: %w", path, err)
+	}
+	return &lock, nil
+}
+
+func writeSourcesLock(path string, lock *SourcesLock) error {
+	data, _ := json.MarshalIndent(lock, "", "  ")
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// pinMCPPackages rewrites the npx arguments of every MCP server to the locked
+// package. Each locked tarball is downloaded into dir and checked against the
+// locked integrity hash, and npx is started from that verified tarball.
+// A missing lock only warns; a lock that does not cover the
+// configured packages is stale and fails the run.
+func pinMCPPackages(client HTTPClient, processed *ProcessedSources, lockPath, dir string) error {
+	if len(processed.MCPPackages) == 0 {
+		return nil
+	}
+	lock, err := readSourcesLock(lockPath)
+	if os.IsNotExist(err) {
+		logWarn("%s not found; MCP packages are not pinned. Run `agentic-audits update-lock` to create it.", lockPath)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	pinned := make(map[string]string, len(processed.MCPPackages))
+	tarballs := make(map[string]string, len(processed.MCPPackages))
+	var stale []string
+	for _, spec := range processed.MCPPackages {
+		locked, ok := lock.Packages[spec]
+		if !ok {
+			stale = append(stale, spec+" (not locked)")
+			continue
+		}
+		name, wanted := splitPackageSpec(spec)
+		if locked.Name != name || !versionSatisfies(locked.Version, wanted) {
+			stale = append(stale, fmt.Sprintf("%s (locked %s)", spec, locked.Pinned()))
+			continue
+		}
+		pinned[spec] = locked.Pinned()
+	}
+	if len(stale) > 0 {
+		return fmt.Errorf("%s is out of date, run `agentic-audits update-lock`: %s", lockPath, strings.Join(stale, ", "))
+	}
+	for _, spec := range processed.MCPPackages {
+		if _, ok := tarballs[spec]; ok {
+			continue
+		}
+		path, err := fetchLockedTarball(client, lock.Packages[spec], dir)
+		if err != nil {
+			return fmt.Errorf("failed to verify %s: %w", pinned[spec], err)
+		}
+		tarballs[spec] = path
+	}
+
+	for name, server := range processed.MCPServers {
+		if len(server.Args) == 2 && server.Args[0] == "-y" && tarballs[server.Args[1]] != "" {
+			server.Args = []string{"-y", tarballs[server.Args[1]]}
+			processed.MCPServers[name] = server
+		}
+	}
+	for i, spec := range processed.MCPPackages {
+		processed.MCPPackages[i] = pinned[spec]
+	}
+	return nil
+}
+
+// fetchLockedTarball downloads the locked tarball into dir and returns its
+// path once it matches the locked integrity hash.
+func fetchLockedTarball(client HTTPClient, locked LockedPackage, dir string) (string, error) {
+	if locked.Resolved == "" || locked.Integrity == "" {
+		return "", fmt.Errorf("the lock has no tarball or integrity hash, run `agentic-audits update-lock`")
+	}
+	req, err := http.NewRequest(http.MethodGet, locked.Resolved, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GET %s returned %s", locked.Resolved, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to download %s: %w", locked.Resolved, err)
+	}
+	if err := checkIntegrity(data, locked.Integrity); err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	name := strings.NewReplacer("@", "", "/", "-").Replace(locked.Name)
+	path, err := filepath.Abs(filepath.Join(dir, fmt.Sprintf("%s-%s.tgz", name, locked.Version)))
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// checkIntegrity verifies data against a Subresource Integrity string such as
+// npm's "sha512-<base64>". Any listed hash of a supported algorithm may match.
+func checkIntegrity(data []byte, integrity string) error {
+	algorithms := map[string]func() hash.Hash{"sha512": sha512.New, "sha384": sha512.New384, "sha256": sha256.New}
+	supported := false
+	for _, entry := range strings.Fields(integrity) {
+		algorithm, digest, _ := strings.Cut(entry, "-")
+		newHash, ok := algorithms[algorithm]
+		if !ok {
+			continue
+		}
+		supported = true
+		h := newHash()
+		h.Write(data)
+		if base64.StdEncoding.EncodeToString(h.Sum(nil)) == digest {
+			return nil
+		}
+	}
+	if !supported {
+		return fmt.Errorf("integrity %q uses no supported algorithm (sha512, sha384, sha256)", integrity)
+	}
+	return fmt.Errorf("tarball does not match the locked integrity %s", integrity)
+}
+
+// runUpdateLock implements the `update-lock` subcommand. With --check it only
+// reports whether the lock file matches a fresh resolution.
+func runUpdateLock(args []string, client HTTPClient) error {
+	fs := flag.NewFlagSet("update-lock", flag.ContinueOnError)
+	sourcesConfig := fs.String("sources-config", ".github/sources.yml", "Path to sources config")
+	missionsFile := fs.String("missions-file", defaultMissionsFile, "Missions file whose sources are locked too")
+	orgSources := fs.String("org-sources", "", "Organization sources layer: a file, an https URL or owner/repo/path[@ref]")
+	lockPath := fs.String("sources-lock", defaultSourcesLock, "Path to the lock file")
+	registry := fs.String("npm-registry", getEnvOrDefault("NPM_CONFIG_REGISTRY", defaultNPMRegistry), "npm registry to resolve packages from")
+	check := fs.Bool("check", false, "Fail if the lock file is out of date instead of writing it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected positional arguments %q", fs.Args())
+	}
+
+	host, err := resolveGitHubHost("")
+	if err != nil {
+		return err
+	}
+	org, err := loadOrgSources(client, host, os.Getenv("GITHUB_TOKEN"), *orgSources)
+	if err != nil {
+		return err
+	}
+	specs, err := lockableSpecs(*sourcesConfig, *missionsFile, org)
+	if err != nil {
+		return err
+	}
+	lock := &SourcesLock{LockfileVersion: 1, Packages: make(map[string]LockedPackage, len(specs))}
+	for _, spec := range specs {
+		locked, err := resolvePackage(client, *registry, spec)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", spec, err)
+		}
+		lock.Packages[spec] = locked
+		fmt.Printf("%s -> %s\n", spec, locked.Pinned())
+	}
+
+	if *check {
+		current, err := readSourcesLock(*lockPath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if current == nil {
+			current = &SourcesLock{}
+		}
+		if len(current.Packages)+len(lock.Packages) > 0 && !reflect.DeepEqual(current.Packages, lock.Packages) {
+			return fmt.Errorf("%s is out of date, run `agentic-audits update-lock`", *lockPath)
+		}
+		fmt.Printf("%s is up to date.\n", *lockPath)
+		return nil
+	}
+	if err := writeSourcesLock(*lockPath, lock); err != nil {
+		return fmt.Errorf("failed to write %s: %w", *lockPath, err)
+	}
+	fmt.Printf("Wrote %s (%d packages).\n", *lockPath, len(specs))
+	return nil
+}
+
+// lockableSpecs collects the MCP package specs of the org layer, the sources
+// config and every mission in the missions file, when it exists. Conditions
+// are ignored: every package that may run is locked.
+func lockableSpecs(sourcesConfig, missionsFile string, orgSources []Source) ([]string, error) {
+	seen := make(map[string]bool)
+	add := func(processed ProcessedSources) {
+		for _, spec := range processed.MCPPackages {
+			seen[spec] = true
+		}
+	}
+
+	add(processSources(orgSources))
+	processed, err := parseSources(sourcesConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", sourcesConfig, err)
+	}
+	add(processed)
+
+	if _, err := os.Stat(missionsFile); err == nil {
+		file, err := loadMissionsFile(missionsFile)
+		if err != nil {
+			return nil, err
+		}
+		for name := range file.Missions {
+			spec := file.Mission(name)
+			if len(spec.Sources) > 0 {
+				add(processSources(spec.Sources))
+			} else if spec.SourcesConfig != "" {
+				processed, err := parseSources(spec.SourcesConfig)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read %s: %w", spec.SourcesConfig, err)
+				}
+				add(processed)
+			}
+		}
+	}
+
+	specs := make([]string, 0, len(seen))
+	for spec := range seen {
+		specs = append(specs, spec)
+	}
+	sort.Strings(specs)
+	return specs, nil
+}
+
+// npmPackument is the part of the registry's package document we need.
+type npmPackument struct {
+	DistTags map[string]string `json:"dist-tags"`
+	Versions map[string]struct {
+		Dist struct {
+			Tarball   string `json:"tarball"`
+			Integrity string `json:"integrity"`
+		} `json:"dist"`
+	} `json:"versions"`
+}
+
+// resolvePackage picks the version spec asks for: a dist-tag (latest when
+// empty), an exact version, or a ^/~ range, which resolves to the highest
+// matching release.
+func resolvePackage(client HTTPClient, registry, spec string) (LockedPackage, error) {
+	name, wanted := splitPackageSpec(spec)
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(registry, "/")+"/"+url.PathEscape(name), nil)
+	if err != nil {
+		return LockedPackage{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return LockedPackage{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return LockedPackage{}, fmt.Errorf("registry returned %s", resp.Status)
+	}
+	var doc npmPackument
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return LockedPackage{}, fmt.Errorf("invalid registry response: %w", err)
+	}
+
+	version := doc.DistTags[firstNonEmpty(wanted, "latest")]
+	if version == "" {
+		for candidate := range doc.Versions {
+			if versionSatisfies(candidate, wanted) && (version == "" || compareVersions(candidate, version) > 0) {
+				version = candidate
+			}
+		}
+	}
+	info, ok := doc.Versions[version]
+	if version == "" || !ok {
+		return LockedPackage{}, fmt.Errorf("no version matches %q", firstNonEmpty(wanted, "latest"))
+	}
+	if info.Dist.Integrity == "" {
+		return LockedPackage{}, fmt.Errorf("%s@%s has no integrity hash", name, version)
+	}
+	return LockedPackage{Name: name, Version: version, Resolved: info.Dist.Tarball, Integrity: info.Dist.Integrity}, nil
+}
+
+// splitPackageSpec splits "@scope/pkg@^1.2" into name and version part.
+func splitPackageSpec(spec string) (string, string) {
+	if i := strings.LastIndex(spec, "@"); i > 0 {
+		return spec[:i], spec[i+1:]
+	}
+	return spec, ""
+}
+
+// versionSatisfies reports whether version matches wanted: empty or a dist-tag
+// matches any version (the tag was resolved when locking), otherwise an exact
+// version or a ^/~ range. Prereleases only match exactly.
+func versionSatisfies(version, wanted string) bool {
+	switch {
+	case wanted == "" || wanted == "*" || (wanted[0] != '^' && wanted[0] != '~' && (wanted[0] < '0' || wanted[0] > '9')):
+		return true
+	case wanted[0] == '^' || wanted[0] == '~':
+		v, vPre, ok := parseVersion(version)
+		w, _, wOK := parseVersion(wanted[1:])
+		if !ok || !wOK || vPre != "" || compareVersions(version, wanted[1:]) < 0 {
+			return false
+		}
+		if wanted[0] == '~' {
+			return v[0] == w[0] && v[1] == w[1]
+		}
+		if w[0] == 0 {
+			return v[0] == 0 && v[1] == w[1]
+		}
+		return v[0] == w[0]
+	default:
+		return version == wanted
+	}
+}
+
+// parseVersion parses "1.2.3-pre"; missing minor/patch parts count as 0.
+func parseVersion(version string) ([3]int, string, bool) {
+	var parts [3]int
+	version, pre, _ := strings.Cut(strings.TrimPrefix(version, "v"), "-")
+	fields := strings.Split(version, ".")
+	if len(fields) > 3 {
+		return parts, "", false
+	}
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return parts, "", false
+		}
+		parts[i] = n
+	}
+	return parts, pre, true
+}
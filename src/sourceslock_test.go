@@ -0,0 +1,219 @@
+package main
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testRegistry is a stand-in for the npm registry serving packuments.
+func testRegistry(t *testing.T, packuments map[string]string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		doc, ok := packuments[strings.TrimPrefix(r.URL.EscapedPath(), "/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, doc)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func packument(latest string, versions ...string) string {
+	var entries []string
+	for _, v := range versions {
+		entries = append(entries, fmt.Sprintf(`"%s":{"dist":{"tarball":"https://registry.test/pkg-%s.tgz","integrity":"sha512-%s"}}`, v, v, v))
+	}
+	return fmt.Sprintf(`{"dist-tags":{"latest":"%s","next":"3.0.0-beta.1"},"versions":{%s}}`, latest, strings.Join(entries, ","))
+}
+
+func TestResolvePackage(t *testing.T) {
+	registry := testRegistry(t, map[string]string{
+		"@upstash%2Fcontext7-mcp": packument("2.1.0", "1.0.0", "1.4.2", "1.5.0-rc.1", "2.0.0", "2.1.0", "3.0.0-beta.1"),
+		"noint":                   `{"dist-tags":{"latest":"1.0.0"},"versions":{"1.0.0":{"dist":{}}}}`,
+	})
+
+	tests := map[string]string{
+		"@upstash/context7-mcp":        "2.1.0",
+		"@upstash/context7-mcp@latest": "2.1.0",
+		"@upstash/context7-mcp@next":   "3.0.0-beta.1",
+		"@upstash/context7-mcp@^1.0":   "1.4.2",
+		"@upstash/context7-mcp@~1.0.0": "1.0.0",
+		"@upstash/context7-mcp@2.0.0":  "2.0.0",
+	}
+	for spec, want := range tests {
+		locked, err := resolvePackage(registry.Client(), registry.URL, spec)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", spec, err)
+			continue
+		}
+		if locked.Name != "@upstash/context7-mcp" || locked.Version != want || locked.Integrity != "sha512-"+want {
+			t.Errorf("%s: got %+v, want version %s", spec, locked, want)
+		}
+	}
+
+	for _, spec := range []string{"@upstash/context7-mcp@^4", "missing-pkg", "noint"} {
+		if _, err := resolvePackage(registry.Client(), registry.URL, spec); err == nil {
+			t.Errorf("%s: expected error", spec)
+		}
+	}
+}
+
+func TestVersionSatisfies(t *testing.T) {
+	tests := []struct {
+		version, wanted string
+		want            bool
+	}{
+		{"1.2.3", "", true},
+		{"1.2.3", "latest", true},
+		{"1.2.3", "1.2.3", true},
+		{"1.2.4", "1.2.3", false},
+		{"1.9.0", "^1.2", true},
+		{"2.0.0", "^1.2", false},
+		{"1.1.0", "^1.2", false},
+		{"0.2.5", "^0.2.1", true},
+		{"0.3.0", "^0.2.1", false},
+		{"1.2.9", "~1.2.3", true},
+		{"1.3.0", "~1.2.3", false},
+		{"1.3.0-rc.1", "^1.2", false},
+	}
+	for _, tt := range tests {
+		if got := versionSatisfies(tt.version, tt.wanted); got != tt.want {
+			t.Errorf("versionSatisfies(%s, %s) = %v, want %v", tt.version, tt.wanted, got, tt.want)
+		}
+	}
+}
+
+func sha512Integrity(data string) string {
+	sum := sha512.Sum512([]byte(data))
+	return "sha512-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func TestPinMCPPackages(t *testing.T) {
+	registry := testRegistry(t, map[string]string{
+		"context7-mcp-2.1.0.tgz": "context7 tarball",
+		"tool-1.4.0.tgz":         "tool tarball",
+	})
+	lockPath := filepath.Join(t.TempDir(), "sources.lock")
+	writeSourcesLock(lockPath, &SourcesLock{LockfileVersion: 1, Packages: map[string]LockedPackage{
+		"@upstash/context7-mcp": {Name: "@upstash/context7-mcp", Version: "2.1.0", Resolved: registry.URL + "/context7-mcp-2.1.0.tgz", Integrity: sha512Integrity("context7 tarball")},
+		"tool@^1.2":             {Name: "tool", Version: "1.4.0", Resolved: registry.URL + "/tool-1.4.0.tgz", Integrity: sha512Integrity("tool tarball")},
+		"tampered":              {Name: "tampered", Version: "1.0.0", Resolved: registry.URL + "/tool-1.4.0.tgz", Integrity: sha512Integrity("original tarball")},
+	}})
+	npmDir := t.TempDir()
+	sources := func(packages ...string) ProcessedSources {
+		var list []Source
+		for i, pkg := range packages {
+			list = append(list, Source{Name: fmt.Sprintf("s%d", i), Type: "mcp", Package: pkg, Enabled: true})
+		}
+		return processSources(list)
+	}
+
+	t.Run("Pins npx arguments", func(t *testing.T) {
+		processed := sources("@upstash/context7-mcp", "tool@^1.2")
+		if err := pinMCPPackages(registry.Client(), &processed, lockPath, npmDir); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		tarball := filepath.Join(npmDir, "upstash-context7-mcp-2.1.0.tgz")
+		if !reflect.DeepEqual(processed.MCPServers["s0"].Args, []string{"-y", tarball}) || processed.MCPServers["s1"].Args[1] != filepath.Join(npmDir, "tool-1.4.0.tgz") {
+			t.Errorf("npx should start the verified tarballs, got %v", processed.MCPServers)
+		}
+		if data, _ := os.ReadFile(tarball); string(data) != "context7 tarball" {
+			t.Errorf("unexpected tarball content: %q", data)
+		}
+		if !reflect.DeepEqual(processed.MCPPackages, []string{"@upstash/context7-mcp@2.1.0", "tool@1.4.0"}) {
+			t.Errorf("unexpected packages: %v", processed.MCPPackages)
+		}
+	})
+
+	t.Run("Stale lock fails", func(t *testing.T) {
+		for _, pkg := range []string{"new-package", "tool@^2"} {
+			processed := sources(pkg)
+			err := pinMCPPackages(registry.Client(), &processed, lockPath, npmDir)
+			if err == nil || !strings.Contains(err.Error(), "out of date") {
+				t.Errorf("%s: expected drift error, got %v", pkg, err)
+			}
+		}
+	})
+
+	t.Run("Tampered tarball fails", func(t *testing.T) {
+		processed := sources("tampered")
+		err := pinMCPPackages(registry.Client(), &processed, lockPath, npmDir)
+		if err == nil || !strings.Contains(err.Error(), "does not match the locked integrity") {
+			t.Errorf("expected integrity error, got %v", err)
+		}
+	})
+
+	t.Run("Missing lock only warns", func(t *testing.T) {
+		processed := sources("tool")
+		if err := pinMCPPackages(registry.Client(), &processed, filepath.Join(t.TempDir(), "missing.lock"), npmDir); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if processed.MCPServers["s0"].Args[1] != "tool" {
+			t.Errorf("expected unpinned package, got %v", processed.MCPServers["s0"].Args)
+		}
+	})
+}
+
+func TestUpdateLock(t *testing.T) {
+	registry := testRegistry(t, map[string]string{
+		"@upstash%2Fcontext7-mcp": packument("2.1.0", "2.1.0"),
+		"mission-tool":            packument("0.4.0", "0.3.0", "0.4.0"),
+	})
+	dir := t.TempDir()
+	sourcesConfig := filepath.Join(dir, "sources.yml")
+	os.WriteFile(sourcesConfig, []byte("- name: c7\n  type: mcp\n  package: \"@upstash/context7-mcp\"\n  enabled: true\n"), 0644)
+	missionsFile := writeMissionsFile(t, `
+missions:
+  audit:
+    prompt: Audit
+    sources:
+      - name: tool
+        type: mcp
+        package: mission-tool@~0.3.0
+        enabled: true
+`)
+	lockPath := filepath.Join(dir, "sources.lock")
+	args := []string{"--sources-config", sourcesConfig, "--missions-file", missionsFile, "--sources-lock", lockPath, "--npm-registry", registry.URL}
+
+	if err := run(append([]string{"update-lock", "--check"}, args...), &MockCommandExecutor{}, registry.Client()); err == nil {
+		t.Error("check should fail without a lock file")
+	}
+	if err := run(append([]string{"update-lock"}, args...), &MockCommandExecutor{}, registry.Client()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lock, err := readSourcesLock(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lock.Packages["@upstash/context7-mcp"].Version != "2.1.0" || lock.Packages["mission-tool@~0.3.0"].Version != "0.3.0" {
+		t.Errorf("unexpected lock: %+v", lock.Packages)
+	}
+	if err := run(append([]string{"update-lock", "--check"}, args...), &MockCommandExecutor{}, registry.Client()); err != nil {
+		t.Errorf("check should pass right after update: %v", err)
+	}
+
+	os.WriteFile(sourcesConfig, []byte("- name: c7\n  type: mcp\n  package: \"@upstash/context7-mcp@2.1.0\"\n  enabled: true\n"), 0644)
+	if err := run(append([]string{"update-lock", "--check"}, args...), &MockCommandExecutor{}, registry.Client()); err == nil || !strings.Contains(err.Error(), "out of date") {
+		t.Errorf("check should detect drift, got %v", err)
+	}
+}
+
+func TestCheckIntegrity(t *testing.T) {
+	if err := checkIntegrity([]byte("data"), "sha1-abc "+sha512Integrity("data")); err != nil {
+		t.Errorf("a matching sha512 hash should pass: %v", err)
+	}
+	if err := checkIntegrity([]byte("data"), "sha1-abc"); err == nil || !strings.Contains(err.Error(), "no supported algorithm") {
+		t.Errorf("expected an unsupported algorithm error, got %v", err)
+	}
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SpanData is a finished span as handed to exporters.
+type SpanData struct {
+	Name         string
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]interface{}
+	// Error is the status message of a failed span; empty means OK.
+	Error string
+}
+
+// SpanExporter receives the spans of a run when the tracer shuts down.
+type SpanExporter interface {
+	ExportSpans(spans []SpanData) error
+}
+
+// Tracer records the phases of one run as a trace. A nil Tracer and the nil
+// spans it starts are no-ops, so tracing costs nothing when it is off.
+type Tracer struct {
+	Exporter SpanExporter
+	traceID  string
+	parentID string
+	now      func() time.Time
+
+	mu       sync.Mutex
+	finished []SpanData
+}
+
+// Span is one timed phase of the run.
+type Span struct {
+	tracer *Tracer
+	data   SpanData
+}
+
+func newTracer(exporter SpanExporter) *Tracer {
+	return &Tracer{Exporter: exporter, traceID: randomHex(16), now: time.Now}
+}
+
+// Start begins a root span, joining the caller's trace when TRACEPARENT was given.
+func (t *Tracer) Start(name string) *Span {
+	if t == nil {
+		return nil
+	}
+	return t.start(name, t.parentID)
+}
+
+func (t *Tracer) start(name, parentID string) *Span {
+	return &Span{tracer: t, data: SpanData{
+		Name:         name,
+		TraceID:      t.traceID,
+		SpanID:       randomHex(8),
+		ParentSpanID: parentID,
+		Start:        t.now(),
+		Attributes:   make(map[string]interface{}),
+	}}
+}
+
+// Child begins a span nested under s.
+func (s *Span) Child(name string) *Span {
+	if s == nil {
+		return nil
+	}
+	return s.tracer.start(name, s.data.SpanID)
+}
+
+// SetAttribute records a string, bool, integer or float attribute.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.data.Attributes[key] = value
+}
+
+// End finishes the span, marking it failed when err is not nil.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.data.End = s.tracer.now()
+	if err != nil {
+		s.data.Error = err.Error()
+	}
+	s.tracer.mu.Lock()
+	s.tracer.finished = append(s.tracer.finished, s.data)
+	s.tracer.mu.Unlock()
+}
+
+// Shutdown exports the finished spans. Tracing never fails a run, so callers
+// only warn about the error.
+func (t *Tracer) Shutdown() error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	spans := t.finished
+	t.finished = nil
+	t.mu.Unlock()
+	if len(spans) == 0 || t.Exporter == nil {
+		return nil
+	}
+	return t.Exporter.ExportSpans(spans)
+}
+
+// InMemoryExporter keeps exported spans, for tests and debugging.
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	Spans []SpanData
+}
+
+func (e *InMemoryExporter) ExportSpans(spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.Spans = append(e.Spans, spans...)
+	return nil
+}
+
+// Find returns the exported spans with the given name.
+func (e *InMemoryExporter) Find(name string) []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var found []SpanData
+	for _, span := range e.Spans {
+		if span.Name == name {
+			found = append(found, span)
+		}
+	}
+	return found
+}
+
+// OTLPExporter posts spans as OTLP/HTTP JSON.
+type OTLPExporter struct {
+	Client   HTTPClient
+	Endpoint string
+	Headers  map[string]string
+	Timeout  time.Duration
+	Resource map[string]interface{}
+}
+
+func (e *OTLPExporter) ExportSpans(spans []SpanData) error {
+	body, err := json.Marshal(otlpTraceRequest(e.Resource, spans))
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), e.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.Headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := e.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to export traces: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("failed to export traces: %s returned %s", e.Endpoint, resp.Status)
+	}
+	return nil
+}
+
+// otlpTraceRequest builds an ExportTraceServiceRequest in the OTLP JSON encoding.
+func otlpTraceRequest(resource map[string]interface{}, spans []SpanData) map[string]interface{} {
+	encoded := make([]map[string]interface{}, 0, len(spans))
+	for _, span := range spans {
+		s := map[string]interface{}{
+			"traceId":           span.TraceID,
+			"spanId":            span.SpanID,
+			"name":              span.Name,
+			"kind":              1, // SPAN_KIND_INTERNAL
+			"startTimeUnixNano": strconv.FormatInt(span.Start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(span.End.UnixNano(), 10),
+			"attributes":        otlpAttributes(span.Attributes),
+		}
+		if span.ParentSpanID != "" {
+			s["parentSpanId"] = span.ParentSpanID
+		}
+		if span.Error != "" {
+			s["status"] = map[string]interface{}{"code": 2, "message": span.Error} // STATUS_CODE_ERROR
+		}
+		encoded = append(encoded, s)
+	}
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{"attributes": otlpAttributes(resource)},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": "agentic-audits", "version": version},
+				"spans": encoded,
+			}},
+		}},
+	}
+}
+
+func otlpAttributes(attributes map[string]interface{}) []interface{} {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	encoded := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		var value map[string]interface{}
+		switch v := attributes[key].(type) {
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		case int:
+			value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]interface{}{"doubleValue": v}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		encoded = append(encoded, map[string]interface{}{"key": key, "value": value})
+	}
+	return encoded
+}
+
+// tracerFromEnv configures tracing from the standard OpenTelemetry variables.
+// It returns nil, and tracing is off, unless an OTLP endpoint is set.
+// Only the http/json protocol is implemented; any other protocol turns
+// tracing off rather than sending JSON to a collector expecting something else.
+func tracerFromEnv(lookupEnv func(string) (string, bool), client HTTPClient) *Tracer {
+	env := func(name string) string {
+		value, _ := lookupEnv(name)
+		return strings.TrimSpace(value)
+	}
+	if strings.EqualFold(env("OTEL_SDK_DISABLED"), "true") {
+		return nil
+	}
+	switch exporter := env("OTEL_TRACES_EXPORTER"); exporter {
+	case "", "otlp":
+	case "none":
+		return nil
+	default:
+		logWarn("OTEL_TRACES_EXPORTER=%s is not supported; only otlp is", exporter)
+		return nil
+	}
+
+	endpoint := env("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		if base := env("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			endpoint = strings.TrimRight(base, "/") + "/v1/traces"
+		}
+	}
+	if endpoint == "" {
+		return nil
+	}
+	protocol := firstNonEmpty(env("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL"), env("OTEL_EXPORTER_OTLP_PROTOCOL"))
+	if protocol != "" && protocol != "http/json" {
+		logWarn("OTLP protocol %s is not supported (only http/json is); tracing is off", protocol)
+		return nil
+	}
+
+	timeout := 10 * time.Second
+	if ms, err := strconv.Atoi(firstNonEmpty(env("OTEL_EXPORTER_OTLP_TRACES_TIMEOUT"), env("OTEL_EXPORTER_OTLP_TIMEOUT"))); err == nil && ms > 0 {
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+
+	resource := map[string]interface{}{
+		"service.name":    firstNonEmpty(env("OTEL_SERVICE_NAME"), "agentic-audits"),
+		"service.version": version,
+	}
+	for key, value := range map[string]string{
+		"ci.provider":   ciProvider.Name(),
+		"ci.repository": ciProvider.Repository(),
+		"ci.run_id":     ciProvider.RunID(),
+		"ci.run_url":    ciProvider.RunURL(),
+	} {
+		if value != "" {
+			resource[key] = value
+		}
+	}
+	for key, value := range parseOTELPairs(env("OTEL_RESOURCE_ATTRIBUTES")) {
+		if key != "service.name" || env("OTEL_SERVICE_NAME") == "" {
+			resource[key] = value
+		}
+	}
+
+	tracer := newTracer(&OTLPExporter{
+		Client:   client,
+		Endpoint: endpoint,
+		Headers:  parseOTELPairs(firstNonEmpty(env("OTEL_EXPORTER_OTLP_TRACES_HEADERS"), env("OTEL_EXPORTER_OTLP_HEADERS"))),
+		Timeout:  timeout,
+		Resource: resource,
+	})
+	if traceID, parentID, ok := parseTraceparent(env("TRACEPARENT")); ok {
+		tracer.traceID, tracer.parentID = traceID, parentID
+	}
+	return tracer
+}
+
+// parseOTELPairs parses the key=value,key=value lists used by OTEL_*
+// variables; values are URL-decoded.
+func parseOTELPairs(s string) map[string]string {
+	pairs := make(map[string]string)
+	for _, item := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(item, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			continue
+		}
+		if decoded, err := url.QueryUnescape(strings.TrimSpace(value)); err == nil {
+			value = decoded
+		}
+		pairs[key] = strings.TrimSpace(value)
+	}
+	return pairs
+}
+
+// parseTraceparent reads a W3C traceparent such as
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01.
+func parseTraceparent(s string) (traceID, parentID string, ok bool) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return "", "", false
+	}
+	for _, id := range parts[1:3] {
+		if _, err := hex.DecodeString(id); err != nil || strings.Trim(id, "0") == "" {
+			return "", "", false
+		}
+	}
+	return strings.ToLower(parts[1]), strings.ToLower(parts[2]), true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
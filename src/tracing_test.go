@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTracer(t *testing.T) {
+	exporter := &InMemoryExporter{}
+	tracer := newTracer(exporter)
+	root := tracer.Start("run")
+	child := root.Child("setup")
+	child.SetAttribute("setup.skipped", true)
+	child.End(fmt.Errorf("boom"))
+	root.End(nil)
+	if err := tracer.Shutdown(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(exporter.Spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(exporter.Spans))
+	}
+	setup, run := exporter.Find("setup")[0], exporter.Find("run")[0]
+	if setup.ParentSpanID != run.SpanID || setup.TraceID != run.TraceID || run.ParentSpanID != "" {
+		t.Errorf("setup should be a child of run: %+v %+v", setup, run)
+	}
+	if setup.Error != "boom" || run.Error != "" {
+		t.Errorf("unexpected status: %q %q", setup.Error, run.Error)
+	}
+	if setup.Attributes["setup.skipped"] != true {
+		t.Errorf("unexpected attributes: %v", setup.Attributes)
+	}
+	if len(run.TraceID) != 32 || len(run.SpanID) != 16 {
+		t.Errorf("unexpected ids: %q %q", run.TraceID, run.SpanID)
+	}
+
+	t.Run("Nil tracer is a no-op", func(t *testing.T) {
+		var tracer *Tracer
+		span := tracer.Start("run")
+		span.Child("setup").End(nil)
+		span.SetAttribute("k", "v")
+		span.End(nil)
+		if err := tracer.Shutdown(); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var got *http.Request
+	var body map[string]interface{}
+	status := http.StatusOK
+	client := &MockHTTPClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			got = req
+			json.NewDecoder(req.Body).Decode(&body)
+			return &http.Response{StatusCode: status, Status: http.StatusText(status), Body: io.NopCloser(strings.NewReader(""))}, nil
+		},
+	}
+	exporter := &OTLPExporter{
+		Client:   client,
+		Endpoint: "http://collector:4318/v1/traces",
+		Headers:  map[string]string{"Authorization": "Bearer x"},
+		Timeout:  time.Second,
+		Resource: map[string]interface{}{"service.name": "agentic-audits"},
+	}
+	start := time.Unix(1700000000, 0)
+	span := SpanData{
+		Name: "agent.attempt", TraceID: strings.Repeat("a", 32), SpanID: strings.Repeat("b", 16), ParentSpanID: strings.Repeat("c", 16),
+		Start: start, End: start.Add(time.Second), Error: "exit status 1",
+		Attributes: map[string]interface{}{"agent.model": "gpt-5", "process.exit_code": 1, "agent.premium_requests": 1.5, "retry": true},
+	}
+	if err := exporter.ExportSpans([]SpanData{span}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Method != http.MethodPost || got.URL.String() != exporter.Endpoint || got.Header.Get("Authorization") != "Bearer x" || got.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected request: %s %s %v", got.Method, got.URL, got.Header)
+	}
+
+	data, _ := json.Marshal(body)
+	for _, want := range []string{
+		`"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"agentic-audits"}}]}`,
+		`"parentSpanId":"cccccccccccccccc"`,
+		`"startTimeUnixNano":"1700000000000000000"`,
+		`{"key":"process.exit_code","value":{"intValue":"1"}}`,
+		`{"key":"agent.premium_requests","value":{"doubleValue":1.5}}`,
+		`{"key":"retry","value":{"boolValue":true}}`,
+		`"status":{"code":2,"message":"exit status 1"}`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("expected %s in request:\n%s", want, data)
+		}
+	}
+
+	status = http.StatusBadRequest
+	if err := exporter.ExportSpans([]SpanData{span}); err == nil {
+		t.Error("expected error for a rejected export")
+	}
+}
+
+func TestTracerFromEnv(t *testing.T) {
+	lookup := func(env map[string]string) func(string) (string, bool) {
+		return func(name string) (string, bool) {
+			v, ok := env[name]
+			return v, ok
+		}
+	}
+
+	tests := []struct {
+		name     string
+		env      map[string]string
+		endpoint string
+	}{
+		{"Off without endpoint", map[string]string{"OTEL_SERVICE_NAME": "x"}, ""},
+		{"Disabled", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://c:4318", "OTEL_SDK_DISABLED": "true"}, ""},
+		{"Exporter none", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://c:4318", "OTEL_TRACES_EXPORTER": "none"}, ""},
+		{"Unsupported protocol", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://c:4317", "OTEL_EXPORTER_OTLP_PROTOCOL": "grpc"}, ""},
+		{"Unsupported traces protocol", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://c:4318", "OTEL_EXPORTER_OTLP_TRACES_PROTOCOL": "http/protobuf"}, ""},
+		{"JSON protocol", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://c:4318", "OTEL_EXPORTER_OTLP_PROTOCOL": "http/json"}, "http://c:4318/v1/traces"},
+		{"Base endpoint", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://c:4318/"}, "http://c:4318/v1/traces"},
+		{"Traces endpoint", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://c:4318", "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "http://t/traces"}, "http://t/traces"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracer := tracerFromEnv(lookup(tt.env), nil)
+			if tt.endpoint == "" {
+				if tracer != nil {
+					t.Error("expected tracing to be off")
+				}
+				return
+			}
+			if tracer == nil {
+				t.Fatal("expected a tracer")
+			}
+			if got := tracer.Exporter.(*OTLPExporter).Endpoint; got != tt.endpoint {
+				t.Errorf("endpoint = %q, want %q", got, tt.endpoint)
+			}
+		})
+	}
+
+	t.Run("Headers, resource and traceparent", func(t *testing.T) {
+		old := ciProvider
+		ciProvider = githubActions{lookup(map[string]string{"GITHUB_REPOSITORY": "acme/widgets", "GITHUB_RUN_ID": "42"})}
+		defer func() { ciProvider = old }()
+
+		tracer := tracerFromEnv(lookup(map[string]string{
+			"OTEL_EXPORTER_OTLP_ENDPOINT": "http://c:4318",
+			"OTEL_EXPORTER_OTLP_HEADERS":  "api-key=a%3Db, x-team = audits",
+			"OTEL_EXPORTER_OTLP_TIMEOUT":  "2500",
+			"OTEL_RESOURCE_ATTRIBUTES":    "deployment.environment=ci,service.name=ignored",
+			"OTEL_SERVICE_NAME":           "audits",
+			"TRACEPARENT":                 "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		}), nil)
+		exporter := tracer.Exporter.(*OTLPExporter)
+		if exporter.Headers["api-key"] != "a=b" || exporter.Headers["x-team"] != "audits" {
+			t.Errorf("unexpected headers: %v", exporter.Headers)
+		}
+		if exporter.Timeout != 2500*time.Millisecond {
+			t.Errorf("unexpected timeout: %s", exporter.Timeout)
+		}
+		if exporter.Resource["service.name"] != "audits" || exporter.Resource["deployment.environment"] != "ci" || exporter.Resource["ci.repository"] != "acme/widgets" || exporter.Resource["ci.run_url"] != "https://github.com/acme/widgets/actions/runs/42" {
+			t.Errorf("unexpected resource: %v", exporter.Resource)
+		}
+		root := tracer.Start("run")
+		if root.data.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || root.data.ParentSpanID != "00f067aa0ba902b7" {
+			t.Errorf("root span should join the TRACEPARENT trace: %+v", root.data)
+		}
+	})
+}
+
+func TestParseTraceparent(t *testing.T) {
+	for _, s := range []string{"", "00-abc-def-01", "00-" + strings.Repeat("0", 32) + "-00f067aa0ba902b7-01", "00-" + strings.Repeat("z", 32) + "-00f067aa0ba902b7-01"} {
+		if _, _, ok := parseTraceparent(s); ok {
+			t.Errorf("expected %q to be rejected", s)
+		}
+	}
+}
+
+func TestExecuteMissionSpans(t *testing.T) {
+	exporter := &InMemoryExporter{}
+	tracer := newTracer(exporter)
+	mission := tracer.Start("mission")
+
+	exitErr := exec.Command("sh", "-c", "exit 3").Run()
+	calls := 0
+	executor := &MockCommandExecutor{
+		RunFunc: func(name string, args []string, env []string, stdout, stderr io.Writer) error {
+			calls++
+			if calls == 1 {
+				return exitErr
+			}
+			return nil
+		},
+	}
+	if _, err := executeMission(AgentOptions{Executor: executor, Model: "primary", FallbackModel: "fallback", Span: mission}, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	mission.End(nil)
+	tracer.Shutdown()
+
+	attempts := exporter.Find("agent.attempt")
+	if len(attempts) != 2 {
+		t.Fatalf("expected 2 attempt spans, got %d", len(attempts))
+	}
+	primary, fallback := attempts[0], attempts[1]
+	if primary.Attributes["agent.model"] != "primary" || primary.Attributes["process.exit_code"] != 3 || primary.Error == "" {
+		t.Errorf("unexpected primary attempt: %+v", primary)
+	}
+	if fallback.Attributes["agent.model"] != "fallback" || fallback.Attributes["process.exit_code"] != 0 || fallback.Attributes["agent.fallback_reason"] != "exit status 3" {
+		t.Errorf("unexpected fallback attempt: %+v", fallback)
+	}
+	if fallback.ParentSpanID != exporter.Find("mission")[0].SpanID {
+		t.Error("attempts should be children of the mission span")
+	}
+}
+
+func TestRunTracing(t *testing.T) {
+	missionsFile := writeMissionsFile(t, testPipelineYAML)
+	var exported []byte
+	httpClient := &MockHTTPClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path == "/v1/traces" {
+				exported, _ = io.ReadAll(req.Body)
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(`{}`))}, nil
+		},
+	}
+	t.Setenv("GITHUB_REPOSITORY", "")
+	t.Setenv("GITHUB_ENV", filepath.Join(t.TempDir(), "env"))
+	t.Setenv("RUNNER_TEMP", t.TempDir())
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://collector:4318")
+
+	mock := &pipelineMock{}
+	args := []string{"--missions-file", missionsFile, "--mission-name", "docs", "--github-token", "tok", "--skip-setup", "--skip-preflight"}
+	if err := run(args, mock.executor(), httpClient); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var request struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []struct {
+					Name string `json:"name"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.Unmarshal(exported, &request); err != nil || len(request.ResourceSpans) != 1 {
+		t.Fatalf("expected an OTLP export, got %s (%v)", exported, err)
+	}
+	count := make(map[string]int)
+	for _, span := range request.ResourceSpans[0].ScopeSpans[0].Spans {
+		count[span.Name]++
+	}
+	for name, want := range map[string]int{"agentic-audits": 1, "auth": 1, "setup": 1, "mission": 2, "sources": 2, "config.write": 2, "agent.attempt": 2, "pull_request": 1} {
+		if count[name] != want {
+			t.Errorf("expected %d %s spans, got %d (%v)", want, name, count[name], count)
+		}
+	}
+}
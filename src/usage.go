@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Usage is what the agent backend reported for one or more requests.
+type Usage struct {
+	PremiumRequests  float64 `json:"premium_requests"`
+	InputTokens      int64   `json:"input_tokens"`
+	OutputTokens     int64   `json:"output_tokens"`
+	CacheReadTokens  int64   `json:"cache_read_tokens,omitempty"`
+	CacheWriteTokens int64   `json:"cache_write_tokens,omitempty"`
+}
+
+func (u *Usage) Add(other Usage) {
+	u.PremiumRequests += other.PremiumRequests
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.CacheReadTokens += other.CacheReadTokens
+	u.CacheWriteTokens += other.CacheWriteTokens
+}
+
+func (u Usage) Tokens() int64 {
+	return u.InputTokens + u.OutputTokens
+}
+
+func (u Usage) String() string {
+	return fmt.Sprintf("%s premium requests, %d input / %d output tokens", formatRequests(u.PremiumRequests), u.InputTokens, u.OutputTokens)
+}
+
+// AttemptUsage is the usage of one agent invocation.
+type AttemptUsage struct {
+	Attempt   int              `json:"attempt"`
+	Model     string           `json:"model"`
+	Succeeded bool             `json:"succeeded"`
+	Usage     Usage            `json:"usage"`
+	ByModel   map[string]Usage `json:"by_model,omitempty"`
+}
+
+// UsageReport aggregates attempts per model and in total.
+type UsageReport struct {
+	Attempts []AttemptUsage   `json:"attempts,omitempty"`
+	ByModel  map[string]Usage `json:"by_model,omitempty"`
+	Total    Usage            `json:"total"`
+}
+
+func (r *UsageReport) AddAttempt(attempt AttemptUsage) {
+	attempt.Attempt = len(r.Attempts) + 1
+	r.Attempts = append(r.Attempts, attempt)
+	r.addByModel(attempt.ByModel)
+	r.Total.Add(attempt.Usage)
+}
+
+// Merge adds another report's per-model numbers and totals, e.g. for a run.
+func (r *UsageReport) Merge(other UsageReport) {
+	r.addByModel(other.ByModel)
+	r.Total.Add(other.Total)
+}
+
+func (r *UsageReport) addByModel(byModel map[string]Usage) {
+	for model, usage := range byModel {
+		if r.ByModel == nil {
+			r.ByModel = make(map[string]Usage)
+		}
+		total := r.ByModel[model]
+		total.Add(usage)
+		r.ByModel[model] = total
+	}
+}
+
+// UsageBudget limits a mission's usage; zero values are unlimited. Usage is
+// only known once an attempt finishes, so a budget never stops a running
+// attempt: going over it skips the fallback model and the later missions.
+type UsageBudget struct {
+	MaxPremiumRequests float64
+	MaxTokens          int64
+}
+
+func (b UsageBudget) Check(total Usage) error {
+	if b.MaxPremiumRequests > 0 && total.PremiumRequests > b.MaxPremiumRequests {
+		return fmt.Errorf("usage budget exceeded: %s premium requests, more than the allowed %s", formatRequests(total.PremiumRequests), formatRequests(b.MaxPremiumRequests))
+	}
+	if b.MaxTokens > 0 && total.Tokens() > b.MaxTokens {
+		return fmt.Errorf("usage budget exceeded: %d tokens, more than the allowed %d", total.Tokens(), b.MaxTokens)
+	}
+	return nil
+}
+
+var (
+	totalRequestsLine = regexp.MustCompile(`(?i)total usage est:\s*([\d.]+)\s+premium requests?`)
+	modelUsageLine    = regexp.MustCompile(`(?i)^\s*(\S+)\s+([\d.]+[km]?) input,\s*([\d.]+[km]?) output(?:,\s*([\d.]+[km]?) cache read)?(?:,\s*([\d.]+[km]?) cache write)?(?:\s*\(Est\.\s*([\d.]+) premium requests?\))?`)
+)
+
+// parseUsage extracts usage from agent output. It understands the Copilot
+// CLI's closing summary ("Total usage est:" and the "Usage by model:" table)
+// and JSON lines with an OpenAI-style "usage" object, each counted as one
+// request. The model is used for usage that does not name one.
+func parseUsage(output, model string) (Usage, map[string]Usage) {
+	var total Usage
+	byModel := make(map[string]Usage)
+	add := func(name string, usage Usage) {
+		m := byModel[name]
+		m.Add(usage)
+		byModel[name] = m
+	}
+
+	reportedRequests := -1.0
+	inModelTable := false
+	for _, line := range strings.Split(output, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if m := totalRequestsLine.FindStringSubmatch(trimmed); m != nil {
+			reportedRequests, _ = strconv.ParseFloat(m[1], 64)
+			continue
+		}
+		if strings.EqualFold(trimmed, "usage by model:") {
+			inModelTable = true
+			continue
+		}
+		if inModelTable {
+			if m := modelUsageLine.FindStringSubmatch(line); m != nil {
+				requests, _ := strconv.ParseFloat(m[6], 64)
+				add(m[1], Usage{
+					PremiumRequests:  requests,
+					InputTokens:      parseTokenCount(m[2]),
+					OutputTokens:     parseTokenCount(m[3]),
+					CacheReadTokens:  parseTokenCount(m[4]),
+					CacheWriteTokens: parseTokenCount(m[5]),
+				})
+				continue
+			}
+			inModelTable = false
+		}
+		if strings.HasPrefix(trimmed, "{") && strings.Contains(trimmed, `"usage"`) {
+			var response struct {
+				Model string `json:"model"`
+				Usage struct {
+					PromptTokens     int64 `json:"prompt_tokens"`
+					CompletionTokens int64 `json:"completion_tokens"`
+				} `json:"usage"`
+			}
+			if json.Unmarshal([]byte(trimmed), &response) == nil {
+				add(firstNonEmpty(response.Model, model, "unknown"), Usage{
+					PremiumRequests: 1,
+					InputTokens:     response.Usage.PromptTokens,
+					OutputTokens:    response.Usage.CompletionTokens,
+				})
+			}
+		}
+	}
+
+	for _, usage := range byModel {
+		total.Add(usage)
+	}
+	if reportedRequests >= 0 {
+		total.PremiumRequests = reportedRequests
+		if len(byModel) == 0 {
+			byModel[firstNonEmpty(model, "default")] = total
+		}
+	}
+	if len(byModel) == 0 {
+		return total, nil
+	}
+	return total, byModel
+}
+
+// parseTokenCount parses counts like "1234", "12.3k" or "1.2m".
+func parseTokenCount(s string) int64 {
+	if s == "" {
+		return 0
+	}
+	multiplier := 1.0
+	switch strings.ToLower(s[len(s)-1:]) {
+	case "k":
+		multiplier, s = 1e3, s[:len(s)-1]
+	case "m":
+		multiplier, s = 1e6, s[:len(s)-1]
+	}
+	n, _ := strconv.ParseFloat(s, 64)
+	return int64(n*multiplier + 0.5)
+}
+
+func formatRequests(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// usageSummary formats a report as a per-model table for the log.
+func usageSummary(report UsageReport) string {
+	models := make([]string, 0, len(report.ByModel))
+	for model := range report.ByModel {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+
+	var b strings.Builder
+	for _, model := range models {
+		fmt.Fprintf(&b, "  %s: %s\n", model, report.ByModel[model])
+	}
+	fmt.Fprintf(&b, "  total: %s\n", report.Total)
+	return b.String()
+}
+
+// writeUsageReport saves per-mission and total usage for the run, tagged with
+// the repository and run so fleet numbers can be aggregated, and exports the
+// totals for later steps, also as step outputs.
+func writeUsageReport(outputs []MissionOutput) {
+	run := struct {
+		Repository string                 `json:"repository"`
+		RunID      string                 `json:"run_id,omitempty"`
+		Missions   map[string]UsageReport `json:"missions"`
+		UsageReport
+	}{
+		Repository: ciProvider.Repository(),
+		RunID:      ciProvider.RunID(),
+		Missions:   make(map[string]UsageReport),
+	}
+	for _, output := range outputs {
+		if output.Usage == nil {
+			continue
+		}
+		run.Missions[firstNonEmpty(output.Name, "mission")] = *output.Usage
+		run.Merge(*output.Usage)
+	}
+
+	logInfo("Usage:\n%s", usageSummary(run.UsageReport))
+	outputEnv("PREMIUM_REQUESTS", formatRequests(run.Total.PremiumRequests))
+	outputEnv("INPUT_TOKENS", strconv.FormatInt(run.Total.InputTokens, 10))
+	outputEnv("OUTPUT_TOKENS", strconv.FormatInt(run.Total.OutputTokens, 10))
+	outputStep("premium_requests", formatRequests(run.Total.PremiumRequests))
+	outputStep("input_tokens", strconv.FormatInt(run.Total.InputTokens, 10))
+	outputStep("output_tokens", strconv.FormatInt(run.Total.OutputTokens, 10))
+
+	data, _ := json.MarshalIndent(run, "", "  ")
+	path := filepath.Join(ciProvider.TempDir(), "agentic-audits-usage.json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		logWarn("Could not write usage report: %v", err)
+		return
+	}
+	outputEnv("USAGE_REPORT", path)
+	outputStep("usage_report", path)
+}
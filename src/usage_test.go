@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const copilotSummary = `Done.
+
+Total usage est:       2 Premium requests
+Total duration (API):  1m 2s
+Total code changes:    12 lines added, 3 lines removed
+Usage by model:
+    claude-sonnet-4.5    12.3k input, 456 output, 1.2k cache read, 0 cache write (Est. 1.5 Premium requests)
+    gpt-5                1k input, 44 output, 0 cache read, 0 cache write (Est. 0.5 Premium requests)
+`
+
+func TestParseUsage(t *testing.T) {
+	t.Run("Copilot summary", func(t *testing.T) {
+		total, byModel := parseUsage(copilotSummary, "claude-sonnet-4.5")
+		want := Usage{PremiumRequests: 2, InputTokens: 13300, OutputTokens: 500, CacheReadTokens: 1200}
+		if total != want {
+			t.Errorf("total = %+v, want %+v", total, want)
+		}
+		if got := byModel["claude-sonnet-4.5"]; got.InputTokens != 12300 || got.PremiumRequests != 1.5 {
+			t.Errorf("unexpected usage for claude-sonnet-4.5: %+v", got)
+		}
+		if got := byModel["gpt-5"]; got.OutputTokens != 44 || got.PremiumRequests != 0.5 {
+			t.Errorf("unexpected usage for gpt-5: %+v", got)
+		}
+	})
+
+	t.Run("Total only", func(t *testing.T) {
+		total, byModel := parseUsage("Total usage est: 1 Premium request\n", "gpt-5")
+		if total.PremiumRequests != 1 || byModel["gpt-5"].PremiumRequests != 1 {
+			t.Errorf("unexpected usage: %+v %+v", total, byModel)
+		}
+	})
+
+	t.Run("API responses", func(t *testing.T) {
+		output := `{"model":"gpt-4o","usage":{"prompt_tokens":100,"completion_tokens":20}}
+{"usage":{"prompt_tokens":50,"completion_tokens":5}}
+`
+		total, byModel := parseUsage(output, "fallback")
+		if total != (Usage{PremiumRequests: 2, InputTokens: 150, OutputTokens: 25}) {
+			t.Errorf("unexpected total: %+v", total)
+		}
+		if byModel["gpt-4o"].InputTokens != 100 || byModel["fallback"].InputTokens != 50 {
+			t.Errorf("unexpected usage by model: %+v", byModel)
+		}
+	})
+
+	t.Run("No usage", func(t *testing.T) {
+		total, byModel := parseUsage("nothing to see\n", "gpt-5")
+		if total != (Usage{}) || byModel != nil {
+			t.Errorf("expected no usage, got %+v %+v", total, byModel)
+		}
+	})
+}
+
+func TestParseTokenCount(t *testing.T) {
+	tests := map[string]int64{"": 0, "456": 456, "12.3k": 12300, "1.2M": 1200000, "0.5k": 500}
+	for in, want := range tests {
+		if got := parseTokenCount(in); got != want {
+			t.Errorf("parseTokenCount(%q) = %d, want %d", in, got, want)
+		}
+	}
+}
+
+func TestUsageBudget(t *testing.T) {
+	usage := Usage{PremiumRequests: 3, InputTokens: 800, OutputTokens: 300}
+	tests := []struct {
+		name    string
+		budget  UsageBudget
+		wantErr string
+	}{
+		{"Unlimited", UsageBudget{}, ""},
+		{"Within", UsageBudget{MaxPremiumRequests: 3, MaxTokens: 1100}, ""},
+		{"Requests", UsageBudget{MaxPremiumRequests: 2.5}, "3 premium requests, more than the allowed 2.5"},
+		{"Tokens", UsageBudget{MaxTokens: 1000}, "1100 tokens, more than the allowed 1000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.budget.Check(usage)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestExecuteMissionUsage(t *testing.T) {
+	summary := func(requests int) string {
+		return fmt.Sprintf("Total usage est: %d Premium requests\nUsage by model:\n    m 1k input, 100 output (Est. %d Premium requests)\n", requests, requests)
+	}
+
+	t.Run("Aggregates attempts", func(t *testing.T) {
+		calls := 0
+		executor := &MockCommandExecutor{
+			RunFunc: func(name string, args []string, env []string, stdout, stderr io.Writer) error {
+				calls++
+				fmt.Fprint(stdout, summary(calls))
+				if calls == 1 {
+					return fmt.Errorf("quota")
+				}
+				return nil
+			},
+		}
+		result, err := executeMission(AgentOptions{Executor: executor, Model: "primary", FallbackModel: "fallback"}, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		report := result.Usage
+		if len(report.Attempts) != 2 || report.Attempts[0].Succeeded || !report.Attempts[1].Succeeded {
+			t.Fatalf("unexpected attempts: %+v", report.Attempts)
+		}
+		if report.Attempts[1].Attempt != 2 || report.Attempts[1].Model != "fallback" {
+			t.Errorf("unexpected second attempt: %+v", report.Attempts[1])
+		}
+		if report.Total.PremiumRequests != 3 || report.Total.InputTokens != 2000 || report.ByModel["m"].OutputTokens != 200 {
+			t.Errorf("unexpected totals: %+v", report)
+		}
+	})
+
+	t.Run("Budget skips the fallback", func(t *testing.T) {
+		calls := 0
+		executor := &MockCommandExecutor{
+			RunFunc: func(name string, args []string, env []string, stdout, stderr io.Writer) error {
+				calls++
+				fmt.Fprint(stdout, summary(5))
+				return fmt.Errorf("quota")
+			},
+		}
+		opts := AgentOptions{Executor: executor, FallbackModel: "fallback", Budget: UsageBudget{MaxPremiumRequests: 4}}
+		result, err := executeMission(opts, "")
+		if err == nil || !strings.Contains(err.Error(), "usage budget exceeded") {
+			t.Fatalf("expected budget error, got %v", err)
+		}
+		if calls != 1 {
+			t.Errorf("expected the fallback to be skipped, got %d calls", calls)
+		}
+		if result.Usage.Total.PremiumRequests != 5 {
+			t.Errorf("usage of the failed mission should be kept, got %+v", result.Usage)
+		}
+	})
+
+	t.Run("Budget fails a successful attempt", func(t *testing.T) {
+		executor := &MockCommandExecutor{
+			RunFunc: func(name string, args []string, env []string, stdout, stderr io.Writer) error {
+				fmt.Fprint(stdout, summary(1))
+				return nil
+			},
+		}
+		_, err := executeMission(AgentOptions{Executor: executor, Budget: UsageBudget{MaxTokens: 500}}, "")
+		if err == nil || !strings.Contains(err.Error(), "1100 tokens") {
+			t.Errorf("expected token budget error, got %v", err)
+		}
+	})
+}
+
+func TestWriteUsageReport(t *testing.T) {
+	dir := t.TempDir()
+	envFile, outputFile := filepath.Join(dir, "env"), filepath.Join(dir, "output")
+	t.Setenv("RUNNER_TEMP", dir)
+	t.Setenv("GITHUB_ENV", envFile)
+	t.Setenv("GITHUB_OUTPUT", outputFile)
+	t.Setenv("GITHUB_REPOSITORY", "acme/widgets")
+	t.Setenv("GITHUB_RUN_ID", "42")
+
+	var a, b UsageReport
+	a.AddAttempt(AttemptUsage{Model: "m1", Succeeded: true, Usage: Usage{PremiumRequests: 1, InputTokens: 10, OutputTokens: 1}, ByModel: map[string]Usage{"m1": {PremiumRequests: 1, InputTokens: 10, OutputTokens: 1}}})
+	b.AddAttempt(AttemptUsage{Model: "m2", Usage: Usage{PremiumRequests: 0.5, InputTokens: 5, OutputTokens: 2}, ByModel: map[string]Usage{"m2": {PremiumRequests: 0.5, InputTokens: 5, OutputTokens: 2}}})
+
+	out := captureStdout(t, func() {
+		writeUsageReport([]MissionOutput{{Name: "docs", Usage: &a}, {Name: "skills", Usage: &b}, {Name: "skipped"}})
+	})
+	if !strings.Contains(out, "m2: 0.5 premium requests, 5 input / 2 output tokens") {
+		t.Errorf("expected per-model summary, got:\n%s", out)
+	}
+
+	env, err := os.ReadFile(envFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"PREMIUM_REQUESTS=1.5\n", "INPUT_TOKENS=15\n", "OUTPUT_TOKENS=3\n", "USAGE_REPORT="} {
+		if !strings.Contains(string(env), want) {
+			t.Errorf("expected %q in GITHUB_ENV, got:\n%s", want, env)
+		}
+	}
+	outputs, _ := os.ReadFile(outputFile)
+	for _, want := range []string{"premium_requests=1.5\n", "input_tokens=15\n", "output_tokens=3\n", "usage_report="} {
+		if !strings.Contains(string(outputs), want) {
+			t.Errorf("expected %q in GITHUB_OUTPUT, got:\n%s", want, outputs)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "agentic-audits-usage.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report struct {
+		Repository string                 `json:"repository"`
+		RunID      string                 `json:"run_id"`
+		Missions   map[string]UsageReport `json:"missions"`
+		ByModel    map[string]Usage       `json:"by_model"`
+		Total      Usage                  `json:"total"`
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Repository != "acme/widgets" || report.RunID != "42" || len(report.Missions) != 2 {
+		t.Errorf("unexpected report: %s", data)
+	}
+	if report.Total.PremiumRequests != 1.5 || report.ByModel["m1"].InputTokens != 10 {
+		t.Errorf("unexpected totals: %s", data)
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const defaultWebMaxBytes = 1 << 20
+
+// WebFetchOptions controls how web sources are fetched. An empty AllowedHosts
+// allows every host; entries starting with "." also match subdomains.
+type WebFetchOptions struct {
+	CacheDir     string
+	OutputDir    string
+	MaxBytes     int64
+	AllowedHosts []string
+}
+
+// FetchedSource is a web source converted to Markdown on disk.
+type FetchedSource struct {
+	Name      string
+	URL       string
+	Path      string
+	FromCache bool
+	Truncated bool
+}
+
+// webCacheEntry is the metadata stored next to each cached page.
+type webCacheEntry struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+	Truncated    bool      `json:"truncated,omitempty"`
+}
+
+// fetchWebSources downloads each web source into OutputDir as Markdown. Pages
+// are revalidated against the on-disk cache with ETag/Last-Modified, and a
+// cached copy is used if the server cannot be reached. Sources that fail are
+// returned separately so the caller can still mention them to the agent.
+func fetchWebSources(client HTTPClient, sources []Source, opts WebFetchOptions) ([]FetchedSource, []Source) {
+	var fetched []FetchedSource
+	var failed []Source
+	for _, source := range sources {
+		result, err := fetchWebSource(client, source, opts)
+		if err != nil {
+			logWarn("Could not fetch web source %s: %v", source.Name, err)
+			failed = append(failed, source)
+			continue
+		}
+		fetched = append(fetched, result)
+	}
+	return fetched, failed
+}
+
+func fetchWebSource(client HTTPClient, source Source, opts WebFetchOptions) (FetchedSource, error) {
+	u, err := url.Parse(source.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return FetchedSource{}, fmt.Errorf("invalid URL %q", source.URL)
+	}
+	if !hostAllowed(u.Hostname(), opts.AllowedHosts) {
+		return FetchedSource{}, fmt.Errorf("host %s is not in the allow-list", u.Hostname())
+	}
+
+	key := sha256.Sum256([]byte(source.URL))
+	cacheBase := filepath.Join(opts.CacheDir, hex.EncodeToString(key[:8]))
+	cached, cachedContent := readWebCache(cacheBase)
+
+	content, entry, fromCache, err := downloadWebSource(client, source.URL, cached, cachedContent, opts)
+	if err != nil {
+		if cachedContent == nil {
+			return FetchedSource{}, err
+		}
+		logWarn("Using cached copy of %s: %v", source.URL, err)
+		content, entry, fromCache = cachedContent, cached, true
+	}
+	if !fromCache && opts.CacheDir != "" {
+		writeWebCache(cacheBase, entry, content)
+	}
+
+	if err := os.MkdirAll(opts.OutputDir, 0755); err != nil {
+		return FetchedSource{}, fmt.Errorf("failed to create %s: %w", opts.OutputDir, err)
+	}
+	path := filepath.Join(opts.OutputDir, safeFileName(source.Name)+".md")
+	header := fmt.Sprintf("<!-- Source: %s (fetched %s) -->\n\n", source.URL, entry.FetchedAt.UTC().Format(time.RFC3339))
+	if err := os.WriteFile(path, append([]byte(header), content...), 0644); err != nil {
+		return FetchedSource{}, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	return FetchedSource{
+		Name:      source.Name,
+		URL:       source.URL,
+		Path:      path,
+		FromCache: fromCache,
+		Truncated: entry.Truncated,
+	}, nil
+}
+
+// allowListClient makes an *http.Client refuse every redirect hop to a host
+// outside the allow-list, before requesting it.
+func allowListClient(client HTTPClient, allowedHosts []string) HTTPClient {
+	c, ok := client.(*http.Client)
+	if !ok || len(allowedHosts) == 0 {
+		return client
+	}
+	checked := *c
+	checked.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if !hostAllowed(req.URL.Hostname(), allowedHosts) {
+			return fmt.Errorf("redirected to host %s, which is not in the allow-list", req.URL.Hostname())
+		}
+		if c.CheckRedirect != nil {
+			return c.CheckRedirect(req, via)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+	return &checked
+}
+
+// downloadWebSource performs a conditional GET and returns Markdown content.
+// A 304 returns the cached content unchanged. A redirect to or through a host
+// outside the allow-list is rejected.
+func downloadWebSource(client HTTPClient, rawURL string, cached webCacheEntry, cachedContent []byte, opts WebFetchOptions) ([]byte, webCacheEntry, bool, error) {
+	maxBytes := opts.MaxBytes
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, webCacheEntry{}, false, err
+	}
+	req.Header.Set("User-Agent", "agentic-audits/"+version)
+	req.Header.Set("Accept", "text/html, text/markdown;q=0.9, text/plain;q=0.8")
+	if cachedContent != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := allowListClient(client, opts.AllowedHosts).Do(req)
+	if err != nil {
+		return nil, webCacheEntry{}, false, err
+	}
+	defer resp.Body.Close()
+	// Clients other than *http.Client only get the final URL checked.
+	if resp.Request != nil && !hostAllowed(resp.Request.URL.Hostname(), opts.AllowedHosts) {
+		return nil, webCacheEntry{}, false, fmt.Errorf("%s redirected to host %s, which is not in the allow-list", rawURL, resp.Request.URL.Hostname())
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cachedContent != nil {
+		return cachedContent, cached, true, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, webCacheEntry{}, false, fmt.Errorf("GET %s returned %s", rawURL, resp.Status)
+	}
+
+	if maxBytes <= 0 {
+		maxBytes = defaultWebMaxBytes
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, webCacheEntry{}, false, fmt.Errorf("failed to read %s: %w", rawURL, err)
+	}
+	truncated := int64(len(body)) > maxBytes
+	if truncated {
+		body = body[:maxBytes]
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	var content string
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		content = htmlToMarkdown(string(body))
+	case strings.HasPrefix(mediaType, "text/"), mediaType == "":
+		content = string(body)
+	default:
+		return nil, webCacheEntry{}, false, fmt.Errorf("unsupported content type %q", mediaType)
+	}
+	if truncated {
+		content = strings.TrimRight(content, "\n") + fmt.Sprintf("\n\n_[Truncated at %d bytes]_\n", maxBytes)
+	}
+
+	return []byte(content), webCacheEntry{
+		URL:          rawURL,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		FetchedAt:    time.Now(),
+		Truncated:    truncated,
+	}, false, nil
+}
+
+func readWebCache(base string) (webCacheEntry, []byte) {
+	var entry webCacheEntry
+	meta, err := os.ReadFile(base + ".json")
+	if err != nil || json.Unmarshal(meta, &entry) != nil {
+		return webCacheEntry{}, nil
+	}
+	content, err := os.ReadFile(base + ".md")
+	if err != nil {
+		return webCacheEntry{}, nil
+	}
+	return entry, content
+}
+
+func writeWebCache(base string, entry webCacheEntry, content []byte) {
+	if err := os.MkdirAll(filepath.Dir(base), 0755); err != nil {
+		logWarn("Could not create web cache: %v", err)
+		return
+	}
+	meta, _ := json.MarshalIndent(entry, "", "  ")
+	if err := os.WriteFile(base+".md", content, 0644); err != nil {
+		logWarn("Could not write web cache: %v", err)
+		return
+	}
+	os.WriteFile(base+".json", meta, 0644)
+}
+
+func hostAllowed(host string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	host = strings.ToLower(host)
+	for _, entry := range allowed {
+		entry = strings.ToLower(entry)
+		if host == entry || (strings.HasPrefix(entry, ".") && (strings.HasSuffix(host, entry) || host == entry[1:])) {
+			return true
+		}
+	}
+	return false
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+func safeFileName(name string) string {
+	if name = strings.Trim(unsafeFileChars.ReplaceAllString(name, "-"), "-."); name == "" {
+		return "source"
+	}
+	return name
+}
+
+// webSourcesPrompt tells the agent where the fetched pages are and lists any
+// sources that could not be fetched so it can still consult them itself.
+func webSourcesPrompt(fetched []FetchedSource, failed []Source) string {
+	var parts []string
+	if len(fetched) > 0 {
+		var lines []string
+		for _, f := range fetched {
+			lines = append(lines, fmt.Sprintf("%s (%s)", f.Path, f.URL))
+		}
+		parts = append(parts, "Documentation from the configured web sources has been fetched as Markdown; read these files: "+strings.Join(lines, ", "))
+	}
+	if len(failed) > 0 {
+		var urls []string
+		for _, s := range failed {
+			urls = append(urls, s.URL)
+		}
+		parts = append(parts, "Also consult these documentation sources: "+strings.Join(urls, ", "))
+	}
+	return strings.Join(parts, ". ")
+}
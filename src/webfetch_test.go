@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFetchWebSources(t *testing.T) {
+	var requests, notModified, viaLocalhost int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if strings.HasPrefix(r.Host, "localhost") {
+			viaLocalhost++
+		}
+		switch r.URL.Path {
+		case "/guide":
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				notModified++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, "<h1>Guide</h1><p>Use the tool.</p>")
+		case "/big.txt":
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprint(w, strings.Repeat("x", 100))
+		case "/redirect":
+			// Same server, but under a host name the allow-list does not contain.
+			http.Redirect(w, r, "http://"+strings.Replace(r.Host, "127.0.0.1", "localhost", 1)+"/guide", http.StatusFound)
+		case "/bounce":
+			// Redirects through localhost and back to 127.0.0.1.
+			if strings.HasPrefix(r.Host, "localhost") {
+				http.Redirect(w, r, "http://"+strings.Replace(r.Host, "localhost", "127.0.0.1", 1)+"/guide", http.StatusFound)
+			} else {
+				http.Redirect(w, r, "http://"+strings.Replace(r.Host, "127.0.0.1", "localhost", 1)+"/bounce", http.StatusFound)
+			}
+		case "/image.png":
+			w.Header().Set("Content-Type", "image/png")
+			fmt.Fprint(w, "PNG")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	opts := WebFetchOptions{CacheDir: t.TempDir(), OutputDir: t.TempDir(), MaxBytes: 64}
+	guide := Source{Name: "guide docs", Type: "web", URL: server.URL + "/guide"}
+
+	t.Run("Converts HTML and caches with ETag", func(t *testing.T) {
+		fetched, failed := fetchWebSources(server.Client(), []Source{guide}, opts)
+		if len(fetched) != 1 || len(failed) != 0 {
+			t.Fatalf("expected one fetched source, got %v / %v", fetched, failed)
+		}
+		data, _ := os.ReadFile(fetched[0].Path)
+		if !strings.Contains(string(data), "# Guide") || !strings.Contains(string(data), "Source: "+guide.URL) {
+			t.Errorf("unexpected content:\n%s", data)
+		}
+		if !strings.HasSuffix(fetched[0].Path, "guide-docs.md") {
+			t.Errorf("unexpected file name %s", fetched[0].Path)
+		}
+
+		again, _ := fetchWebSources(server.Client(), []Source{guide}, opts)
+		if notModified != 1 || !again[0].FromCache {
+			t.Errorf("second fetch should revalidate with the ETag (304s: %d)", notModified)
+		}
+		data, _ = os.ReadFile(again[0].Path)
+		if !strings.Contains(string(data), "# Guide") {
+			t.Errorf("cached content lost:\n%s", data)
+		}
+	})
+
+	t.Run("Falls back to cache when offline", func(t *testing.T) {
+		offline := &MockHTTPClient{DoFunc: func(*http.Request) (*http.Response, error) {
+			return nil, fmt.Errorf("network down")
+		}}
+		fetched, failed := fetchWebSources(offline, []Source{guide}, opts)
+		if len(fetched) != 1 || len(failed) != 0 || !fetched[0].FromCache {
+			t.Errorf("expected cached copy, got %v / %v", fetched, failed)
+		}
+	})
+
+	t.Run("Size cap", func(t *testing.T) {
+		fetched, _ := fetchWebSources(server.Client(), []Source{{Name: "big", URL: server.URL + "/big.txt"}}, opts)
+		if len(fetched) != 1 || !fetched[0].Truncated {
+			t.Fatalf("expected truncated source, got %v", fetched)
+		}
+		data, _ := os.ReadFile(fetched[0].Path)
+		if !strings.Contains(string(data), "\n"+strings.Repeat("x", 64)+"\n") || !strings.Contains(string(data), "Truncated at 64 bytes") {
+			t.Errorf("unexpected truncated content:\n%s", data)
+		}
+	})
+
+	t.Run("Failures", func(t *testing.T) {
+		before := requests
+		restricted := opts
+		restricted.AllowedHosts = []string{"docs.example.com"}
+		_, failed := fetchWebSources(server.Client(), []Source{guide}, restricted)
+		if len(failed) != 1 || requests != before {
+			t.Error("hosts outside the allow-list must not be requested")
+		}
+
+		restricted.AllowedHosts = []string{"127.0.0.1"}
+		fetched, failed := fetchWebSources(server.Client(), []Source{{Name: "redirect", URL: server.URL + "/redirect"}}, restricted)
+		if len(fetched) != 0 || len(failed) != 1 {
+			t.Errorf("a redirect to a host outside the allow-list must fail, got %v", fetched)
+		}
+
+		fetched, failed = fetchWebSources(server.Client(), []Source{{Name: "bounce", URL: server.URL + "/bounce"}}, restricted)
+		if len(fetched) != 0 || len(failed) != 1 || viaLocalhost != 0 {
+			t.Errorf("a redirect through a host outside the allow-list must fail before requesting it, got %v (%d requests)", fetched, viaLocalhost)
+		}
+
+		_, failed = fetchWebSources(server.Client(), []Source{
+			{Name: "missing", URL: server.URL + "/missing"},
+			{Name: "image", URL: server.URL + "/image.png"},
+			{Name: "ftp", URL: "ftp://example.com/file"},
+		}, opts)
+		if len(failed) != 3 {
+			t.Errorf("expected 3 failures, got %v", failed)
+		}
+	})
+}
+
+func TestHostAllowed(t *testing.T) {
+	allowed := []string{"docs.github.com", ".example.com"}
+	tests := map[string]bool{
+		"docs.github.com":   true,
+		"github.com":        false,
+		"example.com":       true,
+		"api.example.com":   true,
+		"evilexample.com":   false,
+		"DOCS.GITHUB.COM":   true,
+		"docs.github.com.x": false,
+	}
+	for host, want := range tests {
+		if got := hostAllowed(host, allowed); got != want {
+			t.Errorf("hostAllowed(%s) = %v, want %v", host, got, want)
+		}
+	}
+	if !hostAllowed("anything.test", nil) {
+		t.Error("an empty allow-list should allow every host")
+	}
+}
+
+func TestWebSourcesPrompt(t *testing.T) {
+	prompt := webSourcesPrompt(
+		[]FetchedSource{{Path: "/tmp/web/guide.md", URL: "https://example.com/guide"}},
+		[]Source{{URL: "https://example.com/down"}},
+	)
+	if !strings.Contains(prompt, "/tmp/web/guide.md (https://example.com/guide)") || !strings.Contains(prompt, "Also consult these documentation sources: https://example.com/down") {
+		t.Errorf("unexpected prompt: %s", prompt)
+	}
+}